@@ -30,6 +30,7 @@ import (
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:resource:scope="Cluster"
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:JSONPath=`.status.kubeVersion`,name="Version",type=string
 // +kubebuilder:printcolumn:JSONPath=`.metadata.creationTimestamp`,name="Age",type=date
 
 // Cluster is the Schema for the clusters API
@@ -55,8 +56,116 @@ type ClusterSpec struct {
 	// SSHAuthRef stores ssh key and if it is empty ,then use sshpass.
 	// +optional
 	SSHAuthRef *api.SecretRef `json:"sshAuthRef"`
+	// SecretVarsRef stores the sensitive vars in its secret-vars.yml key, they override the vars of VarsConfRef.
+	// It is backed up as a Secret and never copied into a ConfigMap.
+	// +optional
+	SecretVarsRef *api.SecretRef `json:"secretVarsRef,omitempty"`
+	// VaultPasswordRef stores the ansible vault password in its vault-password key, for the vault encrypted vars.
+	// +optional
+	VaultPasswordRef *api.SecretRef `json:"vaultPasswordRef,omitempty"`
 	// +optional
 	PreCheckRef *api.ConfigMapRef `json:"preCheckRef"`
+	// DeletionPolicy decides how the Cluster is cleaned up when it is deleted.
+	// +optional
+	DeletionPolicy *DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// DataOwnership decides whether the Cluster becomes an owner of the referenced ConfigMaps and Secrets.
+	// Data annotated with clay.io/adopt-by-cluster="true" is adopted regardless of this value.
+	// +optional
+	// +kubebuilder:default="None"
+	// +kubebuilder:validation:Enum=None;Adopt
+	DataOwnership DataOwnershipPolicy `json:"dataOwnership,omitempty"`
+	// OpsRetention overrides the ClusterOperation retention configured in kubeonkube-config for the Cluster.
+	// +optional
+	OpsRetention *OpsRetentionPolicy `json:"opsRetention,omitempty"`
+	// Maintenance holds the disruptive ClusterOperations until a maintenance window opens.
+	// +optional
+	Maintenance *MaintenancePolicy `json:"maintenance,omitempty"`
+	// Runner is the default runner Job pod of the ClusterOperations, such as nodes routed to the datacenter and the proxy env.
+	// +optional
+	Runner *RunnerPodSpec `json:"runner,omitempty"`
+	// OSFamilies are the OS families of the nodes such as RedHat and Debian, checked against the runner image catalog.
+	// +optional
+	OSFamilies []string `json:"osFamilies,omitempty"`
+	// OperationsNamespace holds the backups, entrypoint ConfigMaps and Jobs of the ClusterOperations of the Cluster.
+	// It defaults to the jobNamespace of kubeonkube-config, a change applies to the ClusterOperations which have not started.
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	OperationsNamespace string `json:"operationsNamespace,omitempty"`
+}
+
+type MaintenancePolicy struct {
+	// Windows are the recurring maintenance windows, the disruptive ClusterOperations only start inside one of them.
+	// +optional
+	Windows []MaintenanceWindow `json:"windows,omitempty"`
+	// DisruptiveActions are the actions held by the windows, it defaults to cluster.yml, upgrade-cluster.yml, scale.yml and reset.yml.
+	// +optional
+	DisruptiveActions []string `json:"disruptiveActions,omitempty"`
+}
+
+type MaintenanceWindow struct {
+	// Schedule is a cron expression with five fields when the window opens, such as "0 22 * * 6".
+	// +required
+	Schedule string `json:"schedule"`
+	// Duration of the window, such as 4h.
+	// +required
+	Duration metav1.Duration `json:"duration"`
+	// TimeZone is the IANA time zone of the schedule, it defaults to the time zone of the controller.
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+}
+
+type OpsRetentionPolicy struct {
+	// SucceededLimit keeps the last N succeeded ClusterOperations.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	SucceededLimit *int32 `json:"succeededLimit,omitempty"`
+	// FailedLimit keeps the last N failed ClusterOperations.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	FailedLimit *int32 `json:"failedLimit,omitempty"`
+	// TTL deletes the finished ClusterOperations older than it, such as 720h. Zero keeps them.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+}
+
+type DataOwnershipPolicy string
+
+const (
+	// NoneDataOwnershipPolicy only labels the referenced data with the Cluster.
+	NoneDataOwnershipPolicy DataOwnershipPolicy = "None"
+	// AdoptDataOwnershipPolicy adds the Cluster to the owner references of the referenced data.
+	AdoptDataOwnershipPolicy DataOwnershipPolicy = "Adopt"
+)
+
+type ConfigDeletionPolicy string
+
+const (
+	// OrphanConfigDeletionPolicy keeps the referenced ConfigMaps and Secrets and releases them from the Cluster.
+	OrphanConfigDeletionPolicy ConfigDeletionPolicy = "Orphan"
+	// DeleteConfigDeletionPolicy deletes the referenced ConfigMaps and Secrets together with the Cluster.
+	DeleteConfigDeletionPolicy ConfigDeletionPolicy = "Delete"
+)
+
+type DeletionPolicy struct {
+	// Configs applies to hostsConfRef, varsConfRef, kubeConfRef, preCheckRef and sshAuthRef.
+	// +optional
+	// +kubebuilder:default="Orphan"
+	// +kubebuilder:validation:Enum=Orphan;Delete
+	Configs ConfigDeletionPolicy `json:"configs,omitempty"`
+	// ResetHosts runs reset.yml against the hosts before the Cluster is removed.
+	// +optional
+	ResetHosts bool `json:"resetHosts,omitempty"`
+	// ResetImage is used by the reset ClusterOperation, it defaults to the image of the latest ClusterOperation.
+	// +optional
+	ResetImage string `json:"resetImage,omitempty"`
+}
+
+func (spec *ClusterSpec) GetConfigDeletionPolicy() ConfigDeletionPolicy {
+	if spec.DeletionPolicy == nil || len(spec.DeletionPolicy.Configs) == 0 {
+		return OrphanConfigDeletionPolicy
+	}
+	return spec.DeletionPolicy.Configs
 }
 
 func (spec *ClusterSpec) ConfigDataList() []*api.ConfigMapRef {
@@ -64,7 +173,7 @@ func (spec *ClusterSpec) ConfigDataList() []*api.ConfigMapRef {
 }
 
 func (spec *ClusterSpec) SecretDataList() []*api.SecretRef {
-	return []*api.SecretRef{spec.SSHAuthRef}
+	return []*api.SecretRef{spec.SSHAuthRef, spec.SecretVarsRef, spec.VaultPasswordRef}
 }
 
 type ClusterConditionType string
@@ -90,9 +199,47 @@ type ClusterCondition struct {
 	EndTime *metav1.Time `json:"endTime,omitempty"`
 }
 
+// ClusterVersionRecord records a version of the Cluster set by a ClusterUpgrade.
+type ClusterVersionRecord struct {
+	// +required
+	Version string `json:"version"`
+	// +optional
+	FromVersion string `json:"fromVersion,omitempty"`
+	// ClusterUpgrade is the name of the ClusterUpgrade.
+	// +optional
+	ClusterUpgrade string `json:"clusterUpgrade,omitempty"`
+	// ClusterOps is the name of the upgrade-cluster.yml ClusterOperation.
+	// +optional
+	ClusterOps string `json:"clusterOps,omitempty"`
+	// +optional
+	Time *metav1.Time `json:"time,omitempty"`
+}
+
 // ClusterStatus defines the observed state of Cluster
 type ClusterStatus struct {
 	Conditions []ClusterCondition `json:"conditions"`
+	// KubeVersion is the version verified by the last ClusterUpgrade.
+	// +optional
+	KubeVersion string `json:"kubeVersion,omitempty"`
+	// VersionHistory lists the upgrades of the Cluster, the oldest first.
+	// +optional
+	VersionHistory []ClusterVersionRecord `json:"versionHistory,omitempty"`
+	// Deletion reports what the deletion of the Cluster waits for, such as the reset ClusterOperation.
+	// +optional
+	Deletion *ClusterDeletionStatus `json:"deletion,omitempty"`
+}
+
+type ClusterDeletionStatus struct {
+	// ResetClusterOps is the ClusterOperation running reset.yml for deletionPolicy.resetHosts.
+	// +optional
+	ResetClusterOps string `json:"resetClusterOps,omitempty"`
+	// ResetStatus is the status of the reset ClusterOperation, it follows the maintenance windows and the approval rules
+	// like any other ClusterOperation.
+	// +optional
+	ResetStatus OpsStatus `json:"resetStatus,omitempty"`
+	// Message explains what the deletion waits for.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -20,6 +20,7 @@ import (
 	"github.com/clay-wangzhi/kube-on-kube/api"
 
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -72,6 +73,12 @@ type ClusterOperationSpec struct {
 	// SSHAuthRef will be filled by operator when it performs backup.
 	// +optional
 	SSHAuthRef *api.SecretRef `json:"sshAuthRef,omitempty"`
+	// SecretVarsRef will be filled by operator when it performs backup.
+	// +optional
+	SecretVarsRef *api.SecretRef `json:"secretVarsRef,omitempty"`
+	// VaultPasswordRef will be filled by operator when it performs backup.
+	// +optional
+	VaultPasswordRef *api.SecretRef `json:"vaultPasswordRef,omitempty"`
 	// +optional
 	// EntrypointSHRef will be filled by operator when it renders entrypoint.sh.
 	EntrypointSHRef *api.ConfigMapRef `json:"entrypointSHRef,omitempty"`
@@ -86,6 +93,19 @@ type ClusterOperationSpec struct {
 	ActionSourceRef *api.ConfigMapRef `json:"actionSourceRef,omitempty"`
 	// +optional
 	ExtraArgs string `json:"extraArgs"`
+	// PlaybookOptions are rendered before ExtraArgs.
+	PlaybookOptions `json:",inline"`
+	// ExtraVars are passed to every playbook with -e @file, they override the vars of the Cluster.
+	// The values are any JSON such as numbers, booleans, lists and maps, they keep their types in the vars file.
+	// +optional
+	ExtraVars map[string]apiextensionsv1.JSON `json:"extraVars,omitempty"`
+	// ExtraVarsFrom reads extra vars from the keys of ConfigMaps and Secrets, the later sources and ExtraVars override the earlier ones.
+	// The values of the sources are always strings.
+	// +optional
+	ExtraVarsFrom []ExtraVarsSource `json:"extraVarsFrom,omitempty"`
+	// ExtraVarsRef will be filled by operator when it renders the extra vars file.
+	// +optional
+	ExtraVarsRef *api.SecretRef `json:"extraVarsRef,omitempty"`
 	// +required
 	Image string `json:"image"`
 	// +optional
@@ -96,6 +116,47 @@ type ClusterOperationSpec struct {
 	Resources corev1.ResourceRequirements `json:"resources"`
 	// +optional
 	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// Runner configures the runner Job pod, each field set overrides the one of Cluster.spec.runner.
+	// +optional
+	Runner *RunnerPodSpec `json:"runner,omitempty"`
+	// RunnerBackup will be filled by operator when it backs up the ansible.cfg and the envFrom sources of the runner.
+	// +optional
+	RunnerBackup *RunnerBackup `json:"runnerBackup,omitempty"`
+	// Volumes are added to the runner pod, such as CA bundles, offline package repos and binaries.
+	// +optional
+	Volumes []RunnerVolume `json:"volumes,omitempty"`
+	// VolumeMounts mount the Volumes into the runner, they must not collide with /conf, /auth or /bin/entrypoint.sh.
+	// +optional
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// Priority orders the queued ClusterOperations, the higher runs first and ties run by creation time.
+	// Running ClusterOperations are never preempted.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+	// Approved approves the ClusterOperation when it matches an approval rule of the controller config.
+	// It must be set by a user other than the one who created the ClusterOperation.
+	// +optional
+	Approved bool `json:"approved,omitempty"`
+	// DryRun runs the playbook with --check --diff and skips the hooks, it changes nothing on the hosts.
+	// A succeeded dry run is promoted to a real run with the clay.io/promote="true" annotation,
+	// the real run reuses the hosts, vars and ssh auth backed up by the dry run.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+	// RenderOnly renders entrypoint.sh and the Job into status.preview without backing up the data or creating the Job.
+	// +optional
+	RenderOnly bool `json:"renderOnly,omitempty"`
+}
+
+// Actions returns every action the ClusterOperation runs, the preHooks, the action and the postHooks in order.
+func (spec *ClusterOperationSpec) Actions() []string {
+	result := []string{}
+	for i := range spec.PreHook {
+		result = append(result, spec.PreHook[i].Action)
+	}
+	result = append(result, spec.Action)
+	for i := range spec.PostHook {
+		result = append(result, spec.PostHook[i].Action)
+	}
+	return result
 }
 
 func (spec *ClusterOperationSpec) ConfigDataList() []*api.ConfigMapRef {
@@ -106,11 +167,45 @@ func (spec *ClusterOperationSpec) ConfigDataList() []*api.ConfigMapRef {
 	for i := range spec.PostHook {
 		result = append(result, spec.PostHook[i].ActionSourceRef)
 	}
+	for i := range spec.ExtraVarsFrom {
+		result = append(result, spec.ExtraVarsFrom[i].ConfigMapRef)
+	}
+	for i := range spec.Volumes {
+		if spec.Volumes[i].ConfigMapRef != nil {
+			result = append(result, spec.Volumes[i].BackupRef)
+		}
+	}
+	if backup := spec.RunnerBackup; backup != nil {
+		if backup.AnsibleCfgRef != nil {
+			result = append(result, &api.ConfigMapRef{NameSpace: backup.NameSpace, Name: backup.AnsibleCfgRef.Name})
+		}
+		for _, source := range backup.EnvFrom {
+			if source.ConfigMapRef != nil {
+				result = append(result, &api.ConfigMapRef{NameSpace: backup.NameSpace, Name: source.ConfigMapRef.Name})
+			}
+		}
+	}
 	return result
 }
 
 func (spec *ClusterOperationSpec) SecretDataList() []*api.SecretRef {
-	return []*api.SecretRef{spec.SSHAuthRef}
+	result := []*api.SecretRef{spec.SSHAuthRef, spec.SecretVarsRef, spec.VaultPasswordRef, spec.ExtraVarsRef}
+	for i := range spec.ExtraVarsFrom {
+		result = append(result, spec.ExtraVarsFrom[i].SecretRef)
+	}
+	for i := range spec.Volumes {
+		if spec.Volumes[i].SecretRef != nil {
+			result = append(result, spec.Volumes[i].BackupRef)
+		}
+	}
+	if backup := spec.RunnerBackup; backup != nil {
+		for _, source := range backup.EnvFrom {
+			if source.SecretRef != nil {
+				result = append(result, &api.SecretRef{NameSpace: backup.NameSpace, Name: source.SecretRef.Name})
+			}
+		}
+	}
+	return result
 }
 
 type HookAction struct {
@@ -125,24 +220,175 @@ type HookAction struct {
 	ActionSourceRef *api.ConfigMapRef `json:"actionSourceRef,omitempty"`
 	// +optional
 	ExtraArgs string `json:"extraArgs"`
+	// PlaybookOptions are rendered before ExtraArgs.
+	PlaybookOptions `json:",inline"`
+}
+
+// RunnerPodSpec configures the pod of the runner Job.
+type RunnerPodSpec struct {
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// ServiceAccountName must exist in the namespace of the Job.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// ImagePullSecrets must exist in the namespace of the Job.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// Env of the runner such as HTTP_PROXY, NO_PROXY and ANSIBLE_*, the ClusterOperation overrides the Cluster by name.
+	// CLUSTER_NAME is set by the operator.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+	// EnvFrom of the runner, the sources of the ClusterOperation follow the ones of the Cluster and override them.
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+	// AnsibleCfgRef is a ConfigMap in the namespace of the Job whose ansible.cfg key replaces the ansible.cfg of the image.
+	// +optional
+	AnsibleCfgRef *corev1.LocalObjectReference `json:"ansibleCfgRef,omitempty"`
+}
+
+// RunnerBackup are the copies of the ConfigMaps and Secrets of the runner made when the ClusterOperation starts,
+// the Job reads them instead of the sources, which may change or be deleted while it runs.
+type RunnerBackup struct {
+	// NameSpace holds the copies, it is the namespace of the Job.
+	// +required
+	NameSpace string `json:"namespace"`
+	// AnsibleCfgRef is the copy of the ConfigMap of ansibleCfgRef.
+	// +optional
+	AnsibleCfgRef *corev1.LocalObjectReference `json:"ansibleCfgRef,omitempty"`
+	// EnvFrom are the envFrom sources in order referring to the copies, the missing optional sources are dropped.
+	// +optional
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+}
+
+// RunnerVolume is a volume of the runner with exactly one source.
+// The ConfigMaps and Secrets are backed up when the ClusterOperation starts, like the data of the Cluster.
+type RunnerVolume struct {
+	// +required
+	Name string `json:"name"`
+	// +optional
+	ConfigMapRef *api.ConfigMapRef `json:"configMapRef,omitempty"`
+	// +optional
+	SecretRef *api.SecretRef `json:"secretRef,omitempty"`
+	// PersistentVolumeClaim in the namespace of the Job.
+	// +optional
+	PersistentVolumeClaim *corev1.PersistentVolumeClaimVolumeSource `json:"persistentVolumeClaim,omitempty"`
+	// +optional
+	EmptyDir *corev1.EmptyDirVolumeSource `json:"emptyDir,omitempty"`
+	// BackupRef will be filled by operator when it backs up the ConfigMap or the Secret.
+	// +optional
+	BackupRef *api.DataRef `json:"backupRef,omitempty"`
+}
+
+// ExtraVarsSource is a ConfigMap or a Secret whose keys are the names of the extra vars.
+type ExtraVarsSource struct {
+	// +optional
+	ConfigMapRef *api.ConfigMapRef `json:"configMapRef,omitempty"`
+	// +optional
+	SecretRef *api.SecretRef `json:"secretRef,omitempty"`
+}
+
+// PlaybookOptions are the typed arguments of ansible-playbook, they only apply to the playbook action type.
+type PlaybookOptions struct {
+	// Tags runs only the tasks tagged with them.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+	// SkipTags skips the tasks tagged with them.
+	// +optional
+	SkipTags []string `json:"skipTags,omitempty"`
+	// Limit runs on the listed nodes only, they must be hosts of the inventory.
+	// +optional
+	Limit []string `json:"limit,omitempty"`
+	// Verbosity is the number of -v.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=4
+	Verbosity int32 `json:"verbosity,omitempty"`
+	// Forks is the number of parallel processes of ansible.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Forks int32 `json:"forks,omitempty"`
 }
 
 type OpsStatus string
 
 const (
-	RunningStatus   OpsStatus = "Running"
-	SucceededStatus OpsStatus = "Succeeded"
-	FailedStatus    OpsStatus = "Failed"
+	// QueuedStatus waits for the concurrency limits before running.
+	QueuedStatus OpsStatus = "Queued"
+	// WaitingStatus holds a disruptive operation until the next maintenance window of the Cluster opens.
+	WaitingStatus OpsStatus = "Waiting"
+	// AwaitingApprovalStatus holds an operation matching an approval rule until spec.approved is set by another user.
+	AwaitingApprovalStatus OpsStatus = "AwaitingApproval"
+	RunningStatus          OpsStatus = "Running"
+	SucceededStatus        OpsStatus = "Succeeded"
+	FailedStatus           OpsStatus = "Failed"
 )
 
+// ClusterOperationPreview is what a ClusterOperation would run.
+type ClusterOperationPreview struct {
+	// HostsConfRef, VarsConfRef, SSHAuthRef, SecretVarsRef and VaultPasswordRef are the data of the Cluster which a run backs up.
+	// +optional
+	HostsConfRef *api.ConfigMapRef `json:"hostsConfRef,omitempty"`
+	// +optional
+	VarsConfRef *api.ConfigMapRef `json:"varsConfRef,omitempty"`
+	// +optional
+	SSHAuthRef *api.SecretRef `json:"sshAuthRef,omitempty"`
+	// +optional
+	SecretVarsRef *api.SecretRef `json:"secretVarsRef,omitempty"`
+	// +optional
+	VaultPasswordRef *api.SecretRef `json:"vaultPasswordRef,omitempty"`
+	// EntrypointSH is the rendered entrypoint.sh.
+	// +optional
+	EntrypointSH string `json:"entrypointSH,omitempty"`
+	// Job is the yaml of the Job, it mounts the data of the Cluster instead of the backups.
+	// +optional
+	Job string `json:"job,omitempty"`
+	// Error is why the entrypoint.sh can not be rendered.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
 // ClusterOperationStatus defines the observed state of ClusterOperation
 type ClusterOperationStatus struct {
 	// +optional
 	Action string `json:"action"`
 	// +optional
 	JobRef *api.JobRef `json:"jobRef,omitempty"`
+	// OperationsNamespace is pinned from the Cluster before the ClusterOperation runs,
+	// its backups, entrypoint ConfigMap and Job are all in it.
+	// +optional
+	OperationsNamespace string `json:"operationsNamespace,omitempty"`
 	// +optional
 	Status OpsStatus `json:"status"`
+	// QueuePosition is the 1-based position in the queue while the status is Queued.
+	// +optional
+	QueuePosition int32 `json:"queuePosition,omitempty"`
+	// NextWindowTime is when the next maintenance window opens while the status is Waiting.
+	// +optional
+	NextWindowTime *metav1.Time `json:"nextWindowTime,omitempty"`
+	// ApprovedBy is the user who approved the ClusterOperation.
+	// +optional
+	ApprovedBy string `json:"approvedBy,omitempty"`
+	// ApprovedTime is when the approval was observed.
+	// +optional
+	ApprovedTime *metav1.Time `json:"approvedTime,omitempty"`
+	// DryRun is true when the Job ran in check mode.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+	// UncheckedHooks are the preHook and postHook actions skipped by the dry run, the promoted ClusterOperation runs them unchecked.
+	// +optional
+	UncheckedHooks []string `json:"uncheckedHooks,omitempty"`
+	// PromotedTo is the ClusterOperation created by promoting the dry run.
+	// +optional
+	PromotedTo string `json:"promotedTo,omitempty"`
+	// Preview is filled instead of running the Job when spec.renderOnly is true.
+	// +optional
+	Preview *ClusterOperationPreview `json:"preview,omitempty"`
 	// +optional
 	StartTime *metav1.Time `json:"startTime,omitempty"`
 	// +optional
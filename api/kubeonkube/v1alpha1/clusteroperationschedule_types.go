@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope="Cluster"
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:JSONPath=`.spec.schedule`,name="Schedule",type=string
+// +kubebuilder:printcolumn:JSONPath=`.spec.suspend`,name="Suspend",type=boolean
+// +kubebuilder:printcolumn:JSONPath=`.status.lastScheduleTime`,name="Last Schedule",type=date
+// +kubebuilder:printcolumn:JSONPath=`.metadata.creationTimestamp`,name="Age",type=date
+
+// ClusterOperationSchedule creates ClusterOperations from a template on a cron schedule, as a CronJob creates Jobs.
+type ClusterOperationSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterOperationScheduleSpec   `json:"spec,omitempty"`
+	Status ClusterOperationScheduleStatus `json:"status,omitempty"`
+}
+
+// ConcurrencyPolicy decides what happens when a ClusterOperation of the schedule is still active on a Cluster at the next run.
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent creates the new ClusterOperation beside the active ones.
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+	// ForbidConcurrent skips the run on the Cluster.
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+	// ReplaceConcurrent deletes the pending ClusterOperations before creating the new one,
+	// the run is skipped as with ForbidConcurrent while one of them has started.
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+// ClusterOperationScheduleSpec defines the desired state of ClusterOperationSchedule
+type ClusterOperationScheduleSpec struct {
+	// Schedule is a cron expression with five fields or a macro such as @daily.
+	// +required
+	Schedule string `json:"schedule"`
+	// TimeZone is the IANA time zone of the schedule, such as Asia/Shanghai, it defaults to the time zone of the controller.
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+	// Suspend stops creating ClusterOperations, the ones already created are not affected.
+	// +optional
+	Suspend *bool `json:"suspend,omitempty"`
+	// ConcurrencyPolicy applies to every target Cluster on its own.
+	// +optional
+	// +kubebuilder:default="Forbid"
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// StartingDeadlineSeconds skips a run missed by more than it, such as when the controller was down.
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+	// SuccessfulHistoryLimit keeps the last N succeeded ClusterOperations of each Cluster, it defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulHistoryLimit *int32 `json:"successfulHistoryLimit,omitempty"`
+	// FailedHistoryLimit keeps the last N failed ClusterOperations of each Cluster, it defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	FailedHistoryLimit *int32 `json:"failedHistoryLimit,omitempty"`
+	// Clusters are the names of the target Clusters.
+	// +optional
+	Clusters []string `json:"clusters,omitempty"`
+	// ClusterSelector adds the Clusters matching it to the targets.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// Template of the ClusterOperations, its spec.cluster is replaced by every target Cluster,
+	// it is the only target when neither clusters nor clusterSelector is set.
+	// The approval of the template is ignored, the ClusterOperations are approved by spec.approved of the schedule.
+	// +required
+	Template ClusterOperationTemplate `json:"template"`
+	// Approved approves the ClusterOperations of the schedule requiring approval once for every run.
+	// It must be set by a user other than the creator of the schedule, the spec can not be changed while it is approved
+	// except suspend, withdraw the approval first.
+	// +optional
+	Approved bool `json:"approved,omitempty"`
+}
+
+// ClusterOperationTemplate describes the ClusterOperations created by a schedule.
+type ClusterOperationTemplate struct {
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// +required
+	Spec ClusterOperationSpec `json:"spec"`
+}
+
+// ClusterOperationScheduleStatus defines the observed state of ClusterOperationSchedule
+type ClusterOperationScheduleStatus struct {
+	// Active lists the names of the ClusterOperations of the schedule not finished yet.
+	// +optional
+	Active []string `json:"active,omitempty"`
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+	// Message explains why the schedule does not run, such as an invalid cron expression.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterOperationScheduleList contains a list of ClusterOperationSchedule
+type ClusterOperationScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterOperationSchedule `json:"items"`
+}
+
+func (spec *ClusterOperationScheduleSpec) GetConcurrencyPolicy() ConcurrencyPolicy {
+	if len(spec.ConcurrencyPolicy) == 0 {
+		return ForbidConcurrent
+	}
+	return spec.ConcurrencyPolicy
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:scope="Cluster"
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:JSONPath=`.spec.cluster`,name="Cluster",type=string
+// +kubebuilder:printcolumn:JSONPath=`.status.fromVersion`,name="From",type=string
+// +kubebuilder:printcolumn:JSONPath=`.spec.kubeVersion`,name="To",type=string
+// +kubebuilder:printcolumn:JSONPath=`.status.phase`,name="Phase",type=string
+// +kubebuilder:printcolumn:JSONPath=`.metadata.creationTimestamp`,name="Age",type=date
+
+// ClusterUpgrade upgrades the Kubernetes version of a Cluster: it checks the version skew and the nodes,
+// runs the precheck and upgrade-cluster.yml as ClusterOperations and verifies the new version.
+type ClusterUpgrade struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterUpgradeSpec   `json:"spec,omitempty"`
+	Status ClusterUpgradeStatus `json:"status,omitempty"`
+}
+
+// ClusterUpgradeSpec defines the desired state of ClusterUpgrade
+type ClusterUpgradeSpec struct {
+	// Cluster the name of Cluster.kubeonkube.clay.io, its kubeConfRef is required to detect and verify the version.
+	// +required
+	Cluster string `json:"cluster"`
+	// KubeVersion is the target Kubernetes version such as v1.28.6, it is passed to upgrade-cluster.yml as kube_version.
+	// +required
+	// +kubebuilder:validation:Pattern=`^v?[0-9]+\.[0-9]+\.[0-9]+$`
+	KubeVersion string `json:"kubeVersion"`
+	// Image is the runner image, it defaults to the first image of the runner image catalog supporting the target version
+	// and then to the defaultRunnerImage of kubeonkube-config.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// MaxMinorVersionSkew is how many minor versions the upgrade may move at once, kubespray upgrades one minor version at a time.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	MaxMinorVersionSkew int32 `json:"maxMinorVersionSkew,omitempty"`
+	// PreCheck runs a playbook before the upgrade, the version skew and the nodes are always checked.
+	// +optional
+	PreCheck *ClusterUpgradePreCheck `json:"preCheck,omitempty"`
+	// ExtraVars are passed to the precheck and upgrade-cluster.yml, kube_version is always the target version.
+	// +optional
+	ExtraVars map[string]apiextensionsv1.JSON `json:"extraVars,omitempty"`
+	// VerifyTimeoutSeconds waits for the new version and the Ready nodes after upgrade-cluster.yml, it defaults to 600.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	VerifyTimeoutSeconds *int64 `json:"verifyTimeoutSeconds,omitempty"`
+}
+
+type ClusterUpgradePreCheck struct {
+	// Disabled skips the precheck playbook.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+	// Action is the builtin precheck playbook, it defaults to precheck.yml.
+	// +optional
+	Action string `json:"action,omitempty"`
+}
+
+type ClusterUpgradePhase string
+
+const (
+	UpgradePendingPhase     ClusterUpgradePhase = "Pending"
+	UpgradePreCheckingPhase ClusterUpgradePhase = "PreChecking"
+	UpgradeUpgradingPhase   ClusterUpgradePhase = "Upgrading"
+	UpgradeVerifyingPhase   ClusterUpgradePhase = "Verifying"
+	UpgradeSucceededPhase   ClusterUpgradePhase = "Succeeded"
+	UpgradeFailedPhase      ClusterUpgradePhase = "Failed"
+)
+
+// ClusterUpgradeStatus defines the observed state of ClusterUpgrade
+type ClusterUpgradeStatus struct {
+	// +optional
+	Phase ClusterUpgradePhase `json:"phase,omitempty"`
+	// FromVersion is the version detected from the Cluster before the upgrade.
+	// +optional
+	FromVersion string `json:"fromVersion,omitempty"`
+	// Image is the runner image of the ClusterOperations.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// PreCheckOps is the name of the precheck ClusterOperation.
+	// +optional
+	PreCheckOps string `json:"preCheckOps,omitempty"`
+	// UpgradeOps is the name of the upgrade-cluster.yml ClusterOperation.
+	// +optional
+	UpgradeOps string `json:"upgradeOps,omitempty"`
+	// Message explains the current phase, such as why the upgrade failed or what the verification waits for.
+	// +optional
+	Message string `json:"message,omitempty"`
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// VerifyStartTime is when upgrade-cluster.yml succeeded and the verification started.
+	// +optional
+	VerifyStartTime *metav1.Time `json:"verifyStartTime,omitempty"`
+	// +optional
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ClusterUpgradeList contains a list of ClusterUpgrade
+type ClusterUpgradeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterUpgrade `json:"items"`
+}
+
+// IsFinished reports whether the upgrade has succeeded or failed.
+func (status *ClusterUpgradeStatus) IsFinished() bool {
+	return status.Phase == UpgradeSucceededPhase || status.Phase == UpgradeFailedPhase
+}
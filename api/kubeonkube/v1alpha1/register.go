@@ -33,6 +33,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&ClusterList{},
 		&ClusterOperation{},
 		&ClusterOperationList{},
+		&ClusterOperationSchedule{},
+		&ClusterOperationScheduleList{},
+		&ClusterUpgrade{},
+		&ClusterUpgradeList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -23,6 +23,9 @@ package v1alpha1
 
 import (
 	"github.com/clay-wangzhi/kube-on-kube/api"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -76,6 +79,21 @@ func (in *ClusterCondition) DeepCopy() *ClusterCondition {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterDeletionStatus) DeepCopyInto(out *ClusterDeletionStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterDeletionStatus.
+func (in *ClusterDeletionStatus) DeepCopy() *ClusterDeletionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDeletionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterList) DeepCopyInto(out *ClusterList) {
 	*out = *in
@@ -167,6 +185,188 @@ func (in *ClusterOperationList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOperationPreview) DeepCopyInto(out *ClusterOperationPreview) {
+	*out = *in
+	if in.HostsConfRef != nil {
+		in, out := &in.HostsConfRef, &out.HostsConfRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.VarsConfRef != nil {
+		in, out := &in.VarsConfRef, &out.VarsConfRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.SSHAuthRef != nil {
+		in, out := &in.SSHAuthRef, &out.SSHAuthRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.SecretVarsRef != nil {
+		in, out := &in.SecretVarsRef, &out.SecretVarsRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.VaultPasswordRef != nil {
+		in, out := &in.VaultPasswordRef, &out.VaultPasswordRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOperationPreview.
+func (in *ClusterOperationPreview) DeepCopy() *ClusterOperationPreview {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOperationPreview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOperationSchedule) DeepCopyInto(out *ClusterOperationSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOperationSchedule.
+func (in *ClusterOperationSchedule) DeepCopy() *ClusterOperationSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOperationSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterOperationSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOperationScheduleList) DeepCopyInto(out *ClusterOperationScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterOperationSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOperationScheduleList.
+func (in *ClusterOperationScheduleList) DeepCopy() *ClusterOperationScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOperationScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterOperationScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOperationScheduleSpec) DeepCopyInto(out *ClusterOperationScheduleSpec) {
+	*out = *in
+	if in.TimeZone != nil {
+		in, out := &in.TimeZone, &out.TimeZone
+		*out = new(string)
+		**out = **in
+	}
+	if in.Suspend != nil {
+		in, out := &in.Suspend, &out.Suspend
+		*out = new(bool)
+		**out = **in
+	}
+	if in.StartingDeadlineSeconds != nil {
+		in, out := &in.StartingDeadlineSeconds, &out.StartingDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SuccessfulHistoryLimit != nil {
+		in, out := &in.SuccessfulHistoryLimit, &out.SuccessfulHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedHistoryLimit != nil {
+		in, out := &in.FailedHistoryLimit, &out.FailedHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ClusterSelector != nil {
+		in, out := &in.ClusterSelector, &out.ClusterSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOperationScheduleSpec.
+func (in *ClusterOperationScheduleSpec) DeepCopy() *ClusterOperationScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOperationScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOperationScheduleStatus) DeepCopyInto(out *ClusterOperationScheduleStatus) {
+	*out = *in
+	if in.Active != nil {
+		in, out := &in.Active, &out.Active
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextScheduleTime != nil {
+		in, out := &in.NextScheduleTime, &out.NextScheduleTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOperationScheduleStatus.
+func (in *ClusterOperationScheduleStatus) DeepCopy() *ClusterOperationScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOperationScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterOperationSpec) DeepCopyInto(out *ClusterOperationSpec) {
 	*out = *in
@@ -185,6 +385,16 @@ func (in *ClusterOperationSpec) DeepCopyInto(out *ClusterOperationSpec) {
 		*out = new(api.DataRef)
 		**out = **in
 	}
+	if in.SecretVarsRef != nil {
+		in, out := &in.SecretVarsRef, &out.SecretVarsRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.VaultPasswordRef != nil {
+		in, out := &in.VaultPasswordRef, &out.VaultPasswordRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
 	if in.EntrypointSHRef != nil {
 		in, out := &in.EntrypointSHRef, &out.EntrypointSHRef
 		*out = new(api.DataRef)
@@ -200,6 +410,26 @@ func (in *ClusterOperationSpec) DeepCopyInto(out *ClusterOperationSpec) {
 		*out = new(api.DataRef)
 		**out = **in
 	}
+	in.PlaybookOptions.DeepCopyInto(&out.PlaybookOptions)
+	if in.ExtraVars != nil {
+		in, out := &in.ExtraVars, &out.ExtraVars
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.ExtraVarsFrom != nil {
+		in, out := &in.ExtraVarsFrom, &out.ExtraVarsFrom
+		*out = make([]ExtraVarsSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExtraVarsRef != nil {
+		in, out := &in.ExtraVarsRef, &out.ExtraVarsRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
 	if in.PreHook != nil {
 		in, out := &in.PreHook, &out.PreHook
 		*out = make([]HookAction, len(*in))
@@ -220,6 +450,30 @@ func (in *ClusterOperationSpec) DeepCopyInto(out *ClusterOperationSpec) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.Runner != nil {
+		in, out := &in.Runner, &out.Runner
+		*out = new(RunnerPodSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RunnerBackup != nil {
+		in, out := &in.RunnerBackup, &out.RunnerBackup
+		*out = new(RunnerBackup)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Volumes != nil {
+		in, out := &in.Volumes, &out.Volumes
+		*out = make([]RunnerVolume, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VolumeMounts != nil {
+		in, out := &in.VolumeMounts, &out.VolumeMounts
+		*out = make([]corev1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOperationSpec.
@@ -240,6 +494,24 @@ func (in *ClusterOperationStatus) DeepCopyInto(out *ClusterOperationStatus) {
 		*out = new(api.DataRef)
 		**out = **in
 	}
+	if in.NextWindowTime != nil {
+		in, out := &in.NextWindowTime, &out.NextWindowTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ApprovedTime != nil {
+		in, out := &in.ApprovedTime, &out.ApprovedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.UncheckedHooks != nil {
+		in, out := &in.UncheckedHooks, &out.UncheckedHooks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Preview != nil {
+		in, out := &in.Preview, &out.Preview
+		*out = new(ClusterOperationPreview)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.StartTime != nil {
 		in, out := &in.StartTime, &out.StartTime
 		*out = (*in).DeepCopy()
@@ -260,6 +532,36 @@ func (in *ClusterOperationStatus) DeepCopy() *ClusterOperationStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterOperationTemplate) DeepCopyInto(out *ClusterOperationTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterOperationTemplate.
+func (in *ClusterOperationTemplate) DeepCopy() *ClusterOperationTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterOperationTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 	*out = *in
@@ -283,11 +585,46 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 		*out = new(api.DataRef)
 		**out = **in
 	}
+	if in.SecretVarsRef != nil {
+		in, out := &in.SecretVarsRef, &out.SecretVarsRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.VaultPasswordRef != nil {
+		in, out := &in.VaultPasswordRef, &out.VaultPasswordRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
 	if in.PreCheckRef != nil {
 		in, out := &in.PreCheckRef, &out.PreCheckRef
 		*out = new(api.DataRef)
 		**out = **in
 	}
+	if in.DeletionPolicy != nil {
+		in, out := &in.DeletionPolicy, &out.DeletionPolicy
+		*out = new(DeletionPolicy)
+		**out = **in
+	}
+	if in.OpsRetention != nil {
+		in, out := &in.OpsRetention, &out.OpsRetention
+		*out = new(OpsRetentionPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Maintenance != nil {
+		in, out := &in.Maintenance, &out.Maintenance
+		*out = new(MaintenancePolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Runner != nil {
+		in, out := &in.Runner, &out.Runner
+		*out = new(RunnerPodSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OSFamilies != nil {
+		in, out := &in.OSFamilies, &out.OSFamilies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterSpec.
@@ -310,6 +647,18 @@ func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.VersionHistory != nil {
+		in, out := &in.VersionHistory, &out.VersionHistory
+		*out = make([]ClusterVersionRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Deletion != nil {
+		in, out := &in.Deletion, &out.Deletion
+		*out = new(ClusterDeletionStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterStatus.
@@ -322,6 +671,198 @@ func (in *ClusterStatus) DeepCopy() *ClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterUpgrade) DeepCopyInto(out *ClusterUpgrade) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterUpgrade.
+func (in *ClusterUpgrade) DeepCopy() *ClusterUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterUpgrade) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterUpgradeList) DeepCopyInto(out *ClusterUpgradeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterUpgrade, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterUpgradeList.
+func (in *ClusterUpgradeList) DeepCopy() *ClusterUpgradeList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterUpgradeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterUpgradeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterUpgradePreCheck) DeepCopyInto(out *ClusterUpgradePreCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterUpgradePreCheck.
+func (in *ClusterUpgradePreCheck) DeepCopy() *ClusterUpgradePreCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterUpgradePreCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterUpgradeSpec) DeepCopyInto(out *ClusterUpgradeSpec) {
+	*out = *in
+	if in.PreCheck != nil {
+		in, out := &in.PreCheck, &out.PreCheck
+		*out = new(ClusterUpgradePreCheck)
+		**out = **in
+	}
+	if in.ExtraVars != nil {
+		in, out := &in.ExtraVars, &out.ExtraVars
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.VerifyTimeoutSeconds != nil {
+		in, out := &in.VerifyTimeoutSeconds, &out.VerifyTimeoutSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterUpgradeSpec.
+func (in *ClusterUpgradeSpec) DeepCopy() *ClusterUpgradeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterUpgradeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterUpgradeStatus) DeepCopyInto(out *ClusterUpgradeStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.VerifyStartTime != nil {
+		in, out := &in.VerifyStartTime, &out.VerifyStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.EndTime != nil {
+		in, out := &in.EndTime, &out.EndTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterUpgradeStatus.
+func (in *ClusterUpgradeStatus) DeepCopy() *ClusterUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterVersionRecord) DeepCopyInto(out *ClusterVersionRecord) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterVersionRecord.
+func (in *ClusterVersionRecord) DeepCopy() *ClusterVersionRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterVersionRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeletionPolicy) DeepCopyInto(out *DeletionPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeletionPolicy.
+func (in *DeletionPolicy) DeepCopy() *DeletionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(DeletionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtraVarsSource) DeepCopyInto(out *ExtraVarsSource) {
+	*out = *in
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtraVarsSource.
+func (in *ExtraVarsSource) DeepCopy() *ExtraVarsSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtraVarsSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HookAction) DeepCopyInto(out *HookAction) {
 	*out = *in
@@ -335,6 +876,7 @@ func (in *HookAction) DeepCopyInto(out *HookAction) {
 		*out = new(api.DataRef)
 		**out = **in
 	}
+	in.PlaybookOptions.DeepCopyInto(&out.PlaybookOptions)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HookAction.
@@ -346,3 +888,236 @@ func (in *HookAction) DeepCopy() *HookAction {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenancePolicy) DeepCopyInto(out *MaintenancePolicy) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]MaintenanceWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DisruptiveActions != nil {
+		in, out := &in.DisruptiveActions, &out.DisruptiveActions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenancePolicy.
+func (in *MaintenancePolicy) DeepCopy() *MaintenancePolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenancePolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	if in.TimeZone != nil {
+		in, out := &in.TimeZone, &out.TimeZone
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OpsRetentionPolicy) DeepCopyInto(out *OpsRetentionPolicy) {
+	*out = *in
+	if in.SucceededLimit != nil {
+		in, out := &in.SucceededLimit, &out.SucceededLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedLimit != nil {
+		in, out := &in.FailedLimit, &out.FailedLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpsRetentionPolicy.
+func (in *OpsRetentionPolicy) DeepCopy() *OpsRetentionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(OpsRetentionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookOptions) DeepCopyInto(out *PlaybookOptions) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SkipTags != nil {
+		in, out := &in.SkipTags, &out.SkipTags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Limit != nil {
+		in, out := &in.Limit, &out.Limit
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookOptions.
+func (in *PlaybookOptions) DeepCopy() *PlaybookOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerBackup) DeepCopyInto(out *RunnerBackup) {
+	*out = *in
+	if in.AnsibleCfgRef != nil {
+		in, out := &in.AnsibleCfgRef, &out.AnsibleCfgRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]corev1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerBackup.
+func (in *RunnerBackup) DeepCopy() *RunnerBackup {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerBackup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerPodSpec) DeepCopyInto(out *RunnerPodSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]corev1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AnsibleCfgRef != nil {
+		in, out := &in.AnsibleCfgRef, &out.AnsibleCfgRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerPodSpec.
+func (in *RunnerPodSpec) DeepCopy() *RunnerPodSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerPodSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerVolume) DeepCopyInto(out *RunnerVolume) {
+	*out = *in
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(corev1.PersistentVolumeClaimVolumeSource)
+		**out = **in
+	}
+	if in.EmptyDir != nil {
+		in, out := &in.EmptyDir, &out.EmptyDir
+		*out = new(corev1.EmptyDirVolumeSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BackupRef != nil {
+		in, out := &in.BackupRef, &out.BackupRef
+		*out = new(api.DataRef)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerVolume.
+func (in *RunnerVolume) DeepCopy() *RunnerVolume {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerVolume)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kok-archive lists and restores the ClusterOperations archived by the manager.
+//
+//	kok-archive list --store file:///data/archive [--cluster my-cluster]
+//	kok-archive show --store file:///data/archive --key my-cluster/ops-1-1700000000.yaml
+//	kok-archive restore --store file:///data/archive --key my-cluster/ops-1-1700000000.yaml
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	storeURL := flags.String("store", os.Getenv("ARCHIVE_STORE"), "The archive store, file:///path or s3://bucket/prefix?endpoint=...&region=...")
+	clusterName := flags.String("cluster", "", "Only list the archives of the cluster.")
+	key := flags.String("key", "", "The archive key.")
+	_ = flags.Parse(os.Args[2:])
+
+	if len(*storeURL) == 0 {
+		exit(fmt.Errorf("--store is required"))
+	}
+	store, err := archive.NewStore(*storeURL)
+	if err != nil {
+		exit(err)
+	}
+	archiver := &archive.Archiver{Store: store}
+	ctx := context.Background()
+
+	switch command {
+	case "list":
+		keys, err := archiver.List(ctx, *clusterName)
+		if err != nil {
+			exit(err)
+		}
+		for _, item := range keys {
+			fmt.Println(item)
+		}
+	case "show":
+		bundle, err := archiver.Load(ctx, requireKey(*key))
+		if err != nil {
+			exit(err)
+		}
+		data, err := yaml.Marshal(bundle)
+		if err != nil {
+			exit(err)
+		}
+		fmt.Print(string(data))
+	case "restore":
+		scheme := runtime.NewScheme()
+		utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+		utilruntime.Must(kubeonkubev1alpha1.AddToScheme(scheme))
+		config, err := ctrl.GetConfig()
+		if err != nil {
+			exit(err)
+		}
+		archiver.Client, err = client.New(config, client.Options{Scheme: scheme})
+		if err != nil {
+			exit(err)
+		}
+		clusterOps, err := archiver.Restore(ctx, requireKey(*key))
+		if err != nil {
+			exit(err)
+		}
+		fmt.Printf("clusteroperation %s restored\n", clusterOps.Name)
+	default:
+		usage()
+	}
+}
+
+func requireKey(key string) string {
+	if len(key) == 0 {
+		exit(fmt.Errorf("--key is required"))
+	}
+	return key
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: kok-archive list|show|restore --store URL [--cluster NAME] [--key KEY]")
+	os.Exit(2)
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
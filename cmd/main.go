@@ -17,26 +17,34 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	// Embed the IANA time zone database for the time zones of the schedules.
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
-	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
-	kokClientSet "github.com/clay-wangzhi/kube-on-kube/generated/clientset/versioned"
 	kubeonkubecontroller "github.com/clay-wangzhi/kube-on-kube/internal/controller/kubeonkube"
+	kubeonkubewebhook "github.com/clay-wangzhi/kube-on-kube/internal/webhook/kubeonkube"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -56,11 +64,29 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var archiveStore string
+	var configFile string
+	var configMapName string
+	var enableWebhooks bool
+	var controllerUsername string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&archiveStore, "archive-store", "",
+		"Archive the pruned ClusterOperations to file:///path or s3://bucket/prefix?endpoint=...&region=... "+
+			"The archive is disabled when it is empty.")
+	flag.StringVar(&configFile, "config", "",
+		"The config file of the controller, it is watched for changes. The ConfigMap is used when it is empty.")
+	flag.StringVar(&configMapName, "config-map", config.DefaultConfigMapName,
+		"The ConfigMap holding the config of the controller in the namespace the controller runs in.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Serve the ClusterOperation admission webhooks, which record the requester and the approver. "+
+			"It requires the serving certificate and the webhook configurations in config/webhook.")
+	flag.StringVar(&controllerUsername, "controller-username", "",
+		"The user the controller runs as, the webhooks keep the requester it records on the ClusterOperations it creates. "+
+			"It defaults to the service account of the pod.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -69,8 +95,20 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	namespace := util.GetCurrentNSOrDefault()
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
+		Scheme: scheme,
+		// Secret 和 ConfigMap 直接读取 API server，避免全集群 informer 把所有 Secret 缓存到内存
+		ClientDisableCacheFor: []client.Object{&corev1.Secret{}, &corev1.ConfigMap{}, &corev1.PersistentVolumeClaim{}},
+		// 配置热更新只 watch 控制器自身的 ConfigMap
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.ConfigMap{}: {Field: fields.SelectorFromSet(fields.Set{
+					"metadata.namespace": namespace,
+					"metadata.name":      configMapName,
+				})},
+			},
+		}),
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
@@ -93,42 +131,126 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 获取认证文件
-	kuebeConfig, err := rest.InClusterConfig()
-	if err != nil {
-		kuebeConfig, err = clientcmd.BuildConfigFromFlags("", os.Getenv("HOME")+"/.kube/config")
+	// 注册缓存索引，除 Secret 和 ConfigMap 外 reconciler 均通过 informer cache 读取
+	if err = kubeonkubecontroller.SetupIndexers(context.Background(), mgr); err != nil {
+		setupLog.Error(err, "unable to set up field indexers")
+		os.Exit(1)
+	}
+
+	// 加载并校验配置，配置变化时热更新，通过 /debug/config 查看当前配置
+	var provider *config.Provider
+	if len(configFile) > 0 {
+		cfg, err := config.LoadFile(configFile)
 		if err != nil {
-			setupLog.Error(err, "unable to set up kube config")
+			setupLog.Error(err, "unable to load config", "file", configFile)
+			os.Exit(1)
+		}
+		provider = config.NewProvider(cfg, configFile)
+		if err := mgr.Add(provider.WatchFile(configFile)); err != nil {
+			setupLog.Error(err, "unable to watch config", "file", configFile)
+			os.Exit(1)
+		}
+	} else {
+		cfg, err := config.LoadConfigMap(context.Background(), mgr.GetAPIReader(), namespace, configMapName)
+		if err != nil {
+			setupLog.Error(err, "unable to load config", "configmap", configMapName)
+			os.Exit(1)
+		}
+		provider = config.NewProvider(cfg, namespace+"/"+configMapName)
+		if err := provider.SetupConfigMapWatch(mgr, namespace, configMapName); err != nil {
+			setupLog.Error(err, "unable to watch config", "configmap", configMapName)
+			os.Exit(1)
 		}
 	}
-	clientSet, err := kubernetes.NewForConfig(kuebeConfig)
-	if err != nil {
-		setupLog.Error(err, "unable to set up clientset")
+	if err := mgr.AddMetricsExtraHandler("/debug/config", provider); err != nil {
+		setupLog.Error(err, "unable to serve config")
+		os.Exit(1)
 	}
-	kokClientSet, err := kokClientSet.NewForConfig(kuebeConfig)
+
+	clientSet, err := kubernetes.NewForConfig(mgr.GetConfig())
 	if err != nil {
-		setupLog.Error(err, "unable to set up kokClientSet")
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+	// 配置 runner 后端，默认以 Job 运行，local 只用于开发和测试
+	backend := provider.Get().RunnerBackend
+	runner := kubeonkubecontroller.NewRunner(backend, mgr.GetClient(), clientSet)
+	if backend.Type == config.RunnerBackendLocal {
+		setupLog.Info("WARNING: the local runner runs the ClusterOperations on the controller host, for development and tests only")
+	}
+
+	// 配置归档，清理 ClusterOps 之前先归档
+	var archiver *archive.Archiver
+	if len(archiveStore) > 0 {
+		store, err := archive.NewStore(archiveStore)
+		if err != nil {
+			setupLog.Error(err, "unable to create archive store")
+			os.Exit(1)
+		}
+		archiver = &archive.Archiver{Store: store, Client: mgr.GetClient(), Logs: kubeonkubecontroller.RunnerLogFetcher(runner)}
 	}
 
-	// 添加 clientset 和 kokclientset
 	if err = (&kubeonkubecontroller.ClusterReconciler{
-		Client:       mgr.GetClient(),
-		Scheme:       mgr.GetScheme(),
-		ClientSet:    clientSet,
-		KokClientSet: kokClientSet,
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Config:   provider,
+		Archiver: archiver,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Cluster")
 		os.Exit(1)
 	}
 	if err = (&kubeonkubecontroller.ClusterOperationReconciler{
-		Client:       mgr.GetClient(),
-		Scheme:       mgr.GetScheme(),
-		ClientSet:    clientSet,
-		KokClientSet: kokClientSet,
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Config:          provider,
+		Scheduler:       kubeonkubecontroller.NewScheduler(mgr.GetClient(), provider),
+		Runner:          runner,
+		ApprovalWebhook: enableWebhooks,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterOperation")
 		os.Exit(1)
 	}
+	if err = (&kubeonkubecontroller.ClusterOperationScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Config:   provider,
+		Archiver: archiver,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterOperationSchedule")
+		os.Exit(1)
+	}
+	if err = (&kubeonkubecontroller.ClusterUpgradeReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Config: provider,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterUpgrade")
+		os.Exit(1)
+	}
+	if enableWebhooks {
+		if len(controllerUsername) == 0 {
+			if controllerUsername, err = util.GetCurrentUsername(); err != nil {
+				setupLog.Error(err, "unable to get the service account of the controller, "+
+					"the ClusterOperations it creates are recorded as requested by it")
+			}
+		}
+		if err = (&kubeonkubewebhook.ClusterOperationWebhook{
+			Client:             mgr.GetAPIReader(),
+			Config:             provider,
+			ControllerUsername: controllerUsername,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterOperation")
+			os.Exit(1)
+		}
+		if err = (&kubeonkubewebhook.ClusterOperationScheduleWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterOperationSchedule")
+			os.Exit(1)
+		}
+		if err = (&kubeonkubewebhook.ClusterUpgradeWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterUpgrade")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -35,6 +35,14 @@ func (c *FakeKubeonkubeV1alpha1) ClusterOperations() v1alpha1.ClusterOperationIn
 	return &FakeClusterOperations{c}
 }
 
+func (c *FakeKubeonkubeV1alpha1) ClusterOperationSchedules() v1alpha1.ClusterOperationScheduleInterface {
+	return &FakeClusterOperationSchedules{c}
+}
+
+func (c *FakeKubeonkubeV1alpha1) ClusterUpgrades() v1alpha1.ClusterUpgradeInterface {
+	return &FakeClusterUpgrades{c}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeKubeonkubeV1alpha1) RESTClient() rest.Interface {
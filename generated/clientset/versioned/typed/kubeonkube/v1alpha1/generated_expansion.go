@@ -20,3 +20,7 @@ package v1alpha1
 type ClusterExpansion interface{}
 
 type ClusterOperationExpansion interface{}
+
+type ClusterOperationScheduleExpansion interface{}
+
+type ClusterUpgradeExpansion interface{}
@@ -29,6 +29,8 @@ type KubeonkubeV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	ClustersGetter
 	ClusterOperationsGetter
+	ClusterOperationSchedulesGetter
+	ClusterUpgradesGetter
 }
 
 // KubeonkubeV1alpha1Client is used to interact with features provided by the kubeonkube.clay.io group.
@@ -44,6 +46,14 @@ func (c *KubeonkubeV1alpha1Client) ClusterOperations() ClusterOperationInterface
 	return newClusterOperations(c)
 }
 
+func (c *KubeonkubeV1alpha1Client) ClusterOperationSchedules() ClusterOperationScheduleInterface {
+	return newClusterOperationSchedules(c)
+}
+
+func (c *KubeonkubeV1alpha1Client) ClusterUpgrades() ClusterUpgradeInterface {
+	return newClusterUpgrades(c)
+}
+
 // NewForConfig creates a new KubeonkubeV1alpha1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
@@ -56,6 +56,10 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubeonkube().V1alpha1().Clusters().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("clusteroperations"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubeonkube().V1alpha1().ClusterOperations().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("clusteroperationschedules"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubeonkube().V1alpha1().ClusterOperationSchedules().Informer()}, nil
+	case v1alpha1.SchemeGroupVersion.WithResource("clusterupgrades"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Kubeonkube().V1alpha1().ClusterUpgrades().Informer()}, nil
 
 	}
 
@@ -27,6 +27,10 @@ type Interface interface {
 	Clusters() ClusterInformer
 	// ClusterOperations returns a ClusterOperationInformer.
 	ClusterOperations() ClusterOperationInformer
+	// ClusterOperationSchedules returns a ClusterOperationScheduleInformer.
+	ClusterOperationSchedules() ClusterOperationScheduleInformer
+	// ClusterUpgrades returns a ClusterUpgradeInformer.
+	ClusterUpgrades() ClusterUpgradeInformer
 }
 
 type version struct {
@@ -49,3 +53,13 @@ func (v *version) Clusters() ClusterInformer {
 func (v *version) ClusterOperations() ClusterOperationInformer {
 	return &clusterOperationInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
+
+// ClusterOperationSchedules returns a ClusterOperationScheduleInformer.
+func (v *version) ClusterOperationSchedules() ClusterOperationScheduleInformer {
+	return &clusterOperationScheduleInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
+// ClusterUpgrades returns a ClusterUpgradeInformer.
+func (v *version) ClusterUpgrades() ClusterUpgradeInformer {
+	return &clusterUpgradeInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
@@ -24,3 +24,11 @@ type ClusterListerExpansion interface{}
 // ClusterOperationListerExpansion allows custom methods to be added to
 // ClusterOperationLister.
 type ClusterOperationListerExpansion interface{}
+
+// ClusterOperationScheduleListerExpansion allows custom methods to be added to
+// ClusterOperationScheduleLister.
+type ClusterOperationScheduleListerExpansion interface{}
+
+// ClusterUpgradeListerExpansion allows custom methods to be added to
+// ClusterUpgradeLister.
+type ClusterUpgradeListerExpansion interface{}
@@ -0,0 +1,164 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// Runner runs the rendered Job of a ClusterOperation, the run is found by Status.JobRef.
+type Runner interface {
+	// Check rejects the ClusterOperations the runner can not run, runner is the merged runner of the Cluster and the ClusterOperation.
+	Check(clusterOps *kubeonkubev1alpha1.ClusterOperation, runner kubeonkubev1alpha1.RunnerPodSpec) error
+	// Start runs the Job, it must tolerate a run started by the previous loop.
+	Start(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, job *batchv1.Job) error
+	// Status returns Running until the run is finished, and then its result and completion time.
+	Status(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (kubeonkubev1alpha1.OpsStatus, *metav1.Time, error)
+	// Logs returns the output of the run.
+	Logs(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (string, error)
+	// Cancel stops the run, it does nothing when the run is not found.
+	Cancel(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) error
+}
+
+// NewRunner returns the runner of the backend, clientSet reads the logs of the Jobs.
+func NewRunner(backend config.RunnerBackend, c client.Client, clientSet kubernetes.Interface) Runner {
+	if backend.Type == config.RunnerBackendLocal {
+		workDir := backend.WorkDir
+		if len(workDir) == 0 {
+			workDir = filepath.Join(os.TempDir(), "kubeonkube")
+		}
+		return NewLocalRunner(c, workDir, backend.KubesprayDir)
+	}
+	runner := &JobRunner{Client: c}
+	if clientSet != nil {
+		runner.LogFetcher = &archive.PodLogFetcher{ClientSet: clientSet}
+	}
+	return runner
+}
+
+// JobRunner runs the ClusterOperations as Jobs.
+type JobRunner struct {
+	Client client.Client
+	// LogFetcher is optional, the logs are unavailable when it is nil.
+	LogFetcher archive.LogFetcher
+}
+
+func (j *JobRunner) Check(_ *kubeonkubev1alpha1.ClusterOperation, _ kubeonkubev1alpha1.RunnerPodSpec) error {
+	return nil
+}
+
+func (j *JobRunner) Start(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, job *batchv1.Job) error {
+	if err := j.Client.Get(ctx, client.ObjectKey{Namespace: job.Namespace, Name: job.Name}, &batchv1.Job{}); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return err
+	}
+	klog.Warningf("create job %s for kubeonkubeClusterOp %s", job.Name, clusterOps.Name)
+	// the cache may lag behind a job created by the previous loop.
+	if err := j.Client.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (j *JobRunner) Status(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (kubeonkubev1alpha1.OpsStatus, *metav1.Time, error) {
+	if clusterOps.Status.JobRef.IsEmpty() {
+		return "", nil, fmt.Errorf("clusterOps %s no job", clusterOps.Name)
+	}
+	targetJob := &batchv1.Job{}
+	err := j.Client.Get(ctx, client.ObjectKey{Namespace: clusterOps.Status.JobRef.NameSpace, Name: clusterOps.Status.JobRef.Name}, targetJob)
+	if apierrors.IsNotFound(err) {
+		// maybe the job is removed.
+		klog.Errorf("clusterOps %s  job %s not found", clusterOps.Name, clusterOps.Status.JobRef.Name)
+		return kubeonkubev1alpha1.FailedStatus, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	// according to the job condtions, return success or failed
+	for _, contion := range targetJob.Status.Conditions {
+		if contion.Type == batchv1.JobComplete && contion.Status == corev1.ConditionTrue {
+			return kubeonkubev1alpha1.SucceededStatus, targetJob.Status.CompletionTime, nil
+		}
+		if contion.Type == batchv1.JobFailed && contion.Status == corev1.ConditionTrue {
+			return kubeonkubev1alpha1.FailedStatus, targetJob.Status.CompletionTime, nil
+		}
+		if contion.Type == batchv1.JobFailureTarget && contion.Status == corev1.ConditionTrue {
+			return kubeonkubev1alpha1.FailedStatus, targetJob.Status.CompletionTime, nil
+		}
+		if contion.Type == batchv1.JobSuspended && contion.Status == corev1.ConditionTrue {
+			return kubeonkubev1alpha1.FailedStatus, targetJob.Status.CompletionTime, nil
+		}
+	}
+
+	return kubeonkubev1alpha1.RunningStatus, nil, nil
+}
+
+func (j *JobRunner) Logs(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (string, error) {
+	if j.LogFetcher == nil {
+		return "", fmt.Errorf("logs of job runner are unavailable")
+	}
+	if clusterOps.Status.JobRef.IsEmpty() {
+		return "", fmt.Errorf("clusterOps %s no job", clusterOps.Name)
+	}
+	return j.LogFetcher.FetchLogs(ctx, clusterOps.Status.JobRef.NameSpace, clusterOps.Status.JobRef.Name)
+}
+
+// Cancel deletes the Job with its pods, the Job of a deleted ClusterOperation has no namespace and is left to the garbage collector.
+func (j *JobRunner) Cancel(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	if clusterOps.Status.JobRef.IsEmpty() || len(clusterOps.Status.JobRef.NameSpace) == 0 {
+		return nil
+	}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: clusterOps.Status.JobRef.NameSpace, Name: clusterOps.Status.JobRef.Name}}
+	err := j.Client.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// RunnerLogFetcher lets the archive read the logs from the runner.
+func RunnerLogFetcher(runner Runner) archive.LogFetcher {
+	return runnerLogFetcher{runner: runner}
+}
+
+type runnerLogFetcher struct {
+	runner Runner
+}
+
+func (f runnerLogFetcher) FetchLogs(ctx context.Context, namespace, jobName string) (string, error) {
+	clusterOps := &kubeonkubev1alpha1.ClusterOperation{}
+	clusterOps.Status.JobRef = &api.JobRef{NameSpace: namespace, Name: jobName}
+	return f.runner.Logs(ctx, clusterOps)
+}
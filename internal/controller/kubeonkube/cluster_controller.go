@@ -18,21 +18,26 @@ package kubeonkube
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"reflect"
 	"sort"
 	"strconv"
 	"time"
 
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
 	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/entrypoint"
 
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
-	kokClientSet "github.com/clay-wangzhi/kube-on-kube/generated/clientset/versioned"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -40,24 +45,32 @@ import (
 )
 
 const (
-	RequeueAfter                         = time.Second * 15
-	KubeonkubeConfigMapName              = "kubeonkube-config"
-	DefaultClusterOperationsBackEndLimit = 30
-	MaxClusterOperationsBackEndLimit     = 200
-	EliminateScoreAnno                   = "clay.io/eliminate-score"
+	RequeueAfter       = time.Second * 15
+	EliminateScoreAnno = "clay.io/eliminate-score"
+	RetainAnno         = "clay.io/retain"
+	ClusterFinalizer   = "clay.io/cluster-cleanup"
+	// ResetLabelKey is set on the ClusterOperation which resets the hosts of a deleted Cluster, the value is the Cluster.
+	ResetLabelKey = "clay.io/deletion-reset"
 )
 
 // ClusterReconciler reconciles a Cluster object
 type ClusterReconciler struct {
-	Client       client.Client
-	Scheme       *runtime.Scheme
-	ClientSet    kubernetes.Interface
-	KokClientSet kokClientSet.Interface
+	Client client.Client
+	Scheme *runtime.Scheme
+	// Config is the hot-reloaded controller configuration, the defaults are used when it is nil.
+	Config *config.Provider
+	// Archiver is optional, pruned ClusterOperations are archived before deletion when it is set.
+	Archiver *archive.Archiver
 }
 
 //+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusters,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusters/finalizers,verbs=update
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperations,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods/log,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -80,10 +93,25 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
 	}
 
-	// 判断是否需要备份清理
-	OpsBackupNum := r.FetchKubeonkubeConfigProperty().GetClusterOperationsBackEndLimit()
-	// 清理多余的 ClusterOps
-	needRequeue, err := r.CleanExcessClusterOps(cluster, OpsBackupNum)
+	// Cluster 删除中，按照 DeletionPolicy 清理后移除 finalizer
+	if !cluster.DeletionTimestamp.IsZero() {
+		return r.ReconcileDelete(ctx, cluster)
+	}
+
+	// 添加 finalizer，删除时由 controller 负责清理
+	if !controllerutil.ContainsFinalizer(cluster, ClusterFinalizer) {
+		controllerutil.AddFinalizer(cluster, ClusterFinalizer)
+		if err := r.Client.Update(ctx, cluster); err != nil {
+			klog.ErrorS(err, "failed to add finalizer", "cluster", cluster.Name)
+			return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// 获取全局和 Cluster 级别的保留策略
+	retention := GetOpsRetention(r.Config.Get(), cluster)
+	// 清理多余和过期的 ClusterOps
+	needRequeue, nextExpiry, err := r.CleanExcessClusterOps(ctx, cluster, retention)
 	if err != nil {
 		klog.ErrorS(err, "failed to clean excess cluster ops", "cluster", cluster.Name)
 		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
@@ -94,87 +122,175 @@ func (r *ClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	}
 
 	// 更新状态
-	if err := r.UpdateStatus(cluster); err != nil {
+	if err := r.UpdateStatus(ctx, cluster); err != nil {
 		klog.ErrorS(err, "failed to update cluster status", "cluster", cluster.Name)
 		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
 	}
 
-	// 更新 configData 和 secretData 的 OwnReference
-	if err := r.UpdateOwnReferenceToCluster(cluster); err != nil {
+	// 记录 configData 和 secretData 的引用关系，按需更新 OwnReference
+	if err := r.UpdateOwnReferenceToCluster(ctx, cluster); err != nil {
 		klog.ErrorS(err, "failed to update the ownReference configData or secretData", "cluster", cluster.Name)
 		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
 	}
 
-	// loop ，循环监听，当有新的 ClusterOps 任务进来后， 处理删除旧 ClusterOps 任务
-	return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	// 无需轮询，ClusterOps 的变化会通过 watch 触发调谐，处理删除旧 ClusterOps 任务；设置了 TTL 时在最早过期的时间再次调谐
+	return ctrl.Result{RequeueAfter: nextExpiry}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// ClusterOperation events are mapped to their Cluster through spec.cluster, so the status is refreshed without polling.
 func (r *ClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubeonkubev1alpha1.Cluster{}).
+		Watches(&source.Kind{Type: &kubeonkubev1alpha1.ClusterOperation{}}, handler.EnqueueRequestsFromMapFunc(clusterOpsToCluster)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Config.Get().Concurrency.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
-// 定义配置属性结构体
-type ConfigProperty struct {
-	ClusterOperationsBackEndLimit string `json:"CLUSTER_OPERATIONS_BACKEND_LIMIT"`
+// OpsRetention is the effective ClusterOperation retention of a Cluster, a negative limit or zero TTL is unlimited.
+type OpsRetention struct {
+	BackEndLimit   int
+	SucceededLimit int
+	FailedLimit    int
+	TTL            time.Duration
 }
 
-// 获取 kubeonkube 配置文件
-func (r *ClusterReconciler) FetchKubeonkubeConfigProperty() *ConfigProperty {
-	configData, err := r.ClientSet.CoreV1().ConfigMaps(util.GetCurrentNSOrDefault()).Get(context.Background(), KubeonkubeConfigMapName, metav1.GetOptions{})
-	if err != nil {
-		return &ConfigProperty{}
+// GetOpsRetention merges the global retention with the opsRetention of the Cluster, the Cluster takes precedence.
+func GetOpsRetention(cfg *config.Config, cluster *kubeonkubev1alpha1.Cluster) OpsRetention {
+	retention := OpsRetention{
+		BackEndLimit:   cfg.Retention.BackEndLimit,
+		SucceededLimit: -1,
+		FailedLimit:    -1,
+		TTL:            cfg.Retention.TTL.Duration,
 	}
-	jsonData, err := json.Marshal(configData.Data)
-	if err != nil {
-		return &ConfigProperty{}
+	if cfg.Retention.SucceededLimit != nil {
+		retention.SucceededLimit = *cfg.Retention.SucceededLimit
 	}
-	result := &ConfigProperty{}
-	err = json.Unmarshal(jsonData, result)
-	if err != nil {
-		return &ConfigProperty{}
+	if cfg.Retention.FailedLimit != nil {
+		retention.FailedLimit = *cfg.Retention.FailedLimit
 	}
-	return result
-}
-
-// 备份限制 校验
-func (config *ConfigProperty) GetClusterOperationsBackEndLimit() int {
-	value, _ := strconv.Atoi(config.ClusterOperationsBackEndLimit)
-	if value <= 0 {
-		klog.Warningf("GetClusterOperationsBackEndLimit and use default value %d", DefaultClusterOperationsBackEndLimit)
-		return DefaultClusterOperationsBackEndLimit
+	policy := cluster.Spec.OpsRetention
+	if policy == nil {
+		return retention
 	}
-	if value >= MaxClusterOperationsBackEndLimit {
-		klog.Warningf("GetClusterOperationsBackEndLimit and use max value %d", MaxClusterOperationsBackEndLimit)
-		return MaxClusterOperationsBackEndLimit
+	if policy.SucceededLimit != nil {
+		retention.SucceededLimit = int(*policy.SucceededLimit)
 	}
-	return value
+	if policy.FailedLimit != nil {
+		retention.FailedLimit = int(*policy.FailedLimit)
+	}
+	if policy.TTL != nil {
+		retention.TTL = policy.TTL.Duration
+	}
+	return retention
 }
 
-// CleanExcessClusterOps clean up excess ClusterOperation.
-func (r *ClusterReconciler) CleanExcessClusterOps(cluster *kubeonkubev1alpha1.Cluster, OpsBackupNum int) (bool, error) {
-	listOpt := metav1.ListOptions{LabelSelector: fmt.Sprintf("clusterName=%s", cluster.Name)}
-	clusterOpsList, err := r.KokClientSet.KubeonkubeV1alpha1().ClusterOperations().List(context.Background(), listOpt)
+// CleanExcessClusterOps clean up excess and expired ClusterOperation.
+// Queued and running ClusterOperations, the ones annotated with clay.io/retain and the latest succeeded install or upgrade are always kept.
+// It returns whether any ClusterOperation is deleted or has to be retried and the duration until the next one expires.
+func (r *ClusterReconciler) CleanExcessClusterOps(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, retention OpsRetention) (bool, time.Duration, error) {
+	clusterOpsList, err := ListClusterOperations(ctx, r.Client, cluster.Name)
 	if err != nil {
-		return false, err
+		return false, 0, err
 	}
-	if len(clusterOpsList.Items) <= OpsBackupNum {
-		return false, nil
+
+	r.SortClusterOperationsByCreation(clusterOpsList)
+	lifecycleOps := LatestLifecycleClusterOps(clusterOpsList)
+
+	deleted, retry := false, false
+	var nextExpiry time.Duration
+	total, succeeded, failed := 0, 0, 0
+	for i := range clusterOpsList {
+		item := &clusterOpsList[i]
+		if IsActiveClusterOps(item) { // keep running job
+			total++
+			continue
+		}
+		if item.Annotations[RetainAnno] == "true" || item.Name == lifecycleOps {
+			continue
+		}
+		// 从归档恢复的 ClusterOps 只作记录，不计入保留数量，由用户自行删除
+		if _, ok := item.Annotations[archive.RestoredAnno]; ok {
+			continue
+		}
+		total++
+		reason := ""
+		switch {
+		case total > retention.BackEndLimit:
+			reason = "exceed backend limit"
+		case item.Status.Status == kubeonkubev1alpha1.SucceededStatus && retention.SucceededLimit >= 0 && succeeded >= retention.SucceededLimit:
+			reason = "exceed succeeded limit"
+		case item.Status.Status == kubeonkubev1alpha1.FailedStatus && retention.FailedLimit >= 0 && failed >= retention.FailedLimit:
+			reason = "exceed failed limit"
+		case retention.TTL > 0:
+			finishedTime := item.CreationTimestamp.Time
+			if item.Status.EndTime != nil {
+				finishedTime = item.Status.EndTime.Time
+			}
+			if expiry := time.Until(finishedTime.Add(retention.TTL)); expiry <= 0 {
+				reason = "expired"
+			} else if nextExpiry == 0 || expiry < nextExpiry {
+				nextExpiry = expiry
+			}
+		}
+		if len(reason) > 0 {
+			if ArchiveAndDeleteClusterOps(ctx, r.Client, r.Archiver, item, reason) {
+				total--
+				deleted = true
+				continue
+			}
+			// 归档或删除失败，重新调谐重试
+			retry = true
+		}
+		// 保留的 ClusterOps（包括归档或删除失败的）计入保留数量
+		if item.Status.Status == kubeonkubev1alpha1.SucceededStatus {
+			succeeded++
+		} else if item.Status.Status == kubeonkubev1alpha1.FailedStatus {
+			failed++
+		}
 	}
+	return deleted || retry, nextExpiry, nil
+}
 
-	r.SortClusterOperationsByCreation(clusterOpsList.Items)
+// ArchiveAndDeleteClusterOps archives the clusterOps when archiver is set and then deletes it, it reports whether the clusterOps is gone.
+// Every pruning goes through it, so no ClusterOperation is deleted without its archive.
+func ArchiveAndDeleteClusterOps(ctx context.Context, c client.Client, archiver *archive.Archiver, item *kubeonkubev1alpha1.ClusterOperation, reason string) bool {
+	// 先归档，归档失败则保留，等待下次调谐重试
+	if archiver != nil {
+		key, err := archiver.Archive(ctx, item)
+		if err != nil {
+			klog.ErrorS(err, "failed to archive cluster ops", "clusterOps", item.Name)
+			return false
+		}
+		klog.Infof("archive ClusterOperation %s to %s", item.Name, key)
+	}
+	klog.Warningf("Delete ClusterOperation: name: %s, createTime: %s, status: %s, reason: %s", item.Name, item.CreationTimestamp.String(), item.Status.Status, reason)
+	if err := c.Delete(ctx, item); client.IgnoreNotFound(err) != nil {
+		klog.ErrorS(err, "failed to delete cluster ops", "clusterOps", item.Name)
+		return false
+	}
+	return true
+}
 
-	excessClusterOpsList := clusterOpsList.Items[OpsBackupNum:]
-	for _, item := range excessClusterOpsList {
-		if item.Status.Status == kubeonkubev1alpha1.RunningStatus { // keep running job
+// LatestLifecycleClusterOps returns the name of the latest succeeded ClusterOperation which installed or upgraded the cluster.
+func LatestLifecycleClusterOps(clusterOpsList []kubeonkubev1alpha1.ClusterOperation) string {
+	var latest *kubeonkubev1alpha1.ClusterOperation
+	for i := range clusterOpsList {
+		item := &clusterOpsList[i]
+		if item.Status.Status != kubeonkubev1alpha1.SucceededStatus || item.Spec.ActionType != kubeonkubev1alpha1.PlaybookActionType || item.Spec.DryRun || item.Spec.RenderOnly {
+			continue
+		}
+		if item.Spec.Action != entrypoint.ClusterPB && item.Spec.Action != entrypoint.UpgradeClusterPB {
 			continue
 		}
-		klog.Warningf("Delete ClusterOperation: name: %s, createTime: %s, status: %s", item.Name, item.CreationTimestamp.String(), item.Status.Status)
-		r.KokClientSet.KubeonkubeV1alpha1().ClusterOperations().Delete(context.Background(), item.Name, metav1.DeleteOptions{})
+		if latest == nil || item.CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = item
+		}
+	}
+	if latest == nil {
+		return ""
 	}
-	return true, nil
+	return latest.Name
 }
 
 // SortClusterOperationsByCreation sort operations order by EliminateScore ascend , createTime desc.
@@ -196,16 +312,15 @@ func (r *ClusterReconciler) GetEliminateScoreValue(operation kubeonkubev1alpha1.
 	return value
 }
 
-func (r *ClusterReconciler) UpdateStatus(cluster *kubeonkubev1alpha1.Cluster) error {
-	listOpt := metav1.ListOptions{LabelSelector: fmt.Sprintf("clusterName=%s", cluster.Name)}
-	clusterOpslist, err := r.KokClientSet.KubeonkubeV1alpha1().ClusterOperations().List(context.Background(), listOpt)
+func (r *ClusterReconciler) UpdateStatus(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster) error {
+	clusterOpslist, err := ListClusterOperations(ctx, r.Client, cluster.Name)
 	if err != nil {
 		return err
 	}
 	// clusterOps list sort by creation timestamp
-	r.SortClusterOperationsByCreation(clusterOpslist.Items)
+	r.SortClusterOperationsByCreation(clusterOpslist)
 	newConditions := make([]kubeonkubev1alpha1.ClusterCondition, 0)
-	for _, item := range clusterOpslist.Items {
+	for _, item := range clusterOpslist {
 		newConditions = append(newConditions, kubeonkubev1alpha1.ClusterCondition{
 			ClusterOps: item.Name,
 			Status:     kubeonkubev1alpha1.ClusterConditionType(item.Status.Status),
@@ -217,7 +332,7 @@ func (r *ClusterReconciler) UpdateStatus(cluster *kubeonkubev1alpha1.Cluster) er
 		// 不一样，就更新
 		cluster.Status.Conditions = newConditions
 		klog.Warningf("update cluster %s status.condition", cluster.Name)
-		return r.Client.Status().Update(context.Background(), cluster)
+		return r.Client.Status().Update(ctx, cluster)
 	}
 	return nil
 }
@@ -258,6 +373,165 @@ func CompareClusterCondition(conditionA, conditionB kubeonkubev1alpha1.ClusterCo
 	return true
 }
 
-func (r *ClusterReconciler) UpdateOwnReferenceToCluster(cluster *kubeonkubev1alpha1.Cluster) error {
-	return util.UpdateOwnReference(r.ClientSet, cluster.Spec.ConfigDataList(), cluster.Spec.SecretDataList(), *metav1.NewControllerRef(cluster, kubeonkubev1alpha1.SchemeGroupVersion.WithKind("Cluster")))
+// UpdateOwnReferenceToCluster tracks the configData and secretData, the Cluster only owns them when dataOwnership is Adopt.
+func (r *ClusterReconciler) UpdateOwnReferenceToCluster(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster) error {
+	adopt := cluster.Spec.DataOwnership == kubeonkubev1alpha1.AdoptDataOwnershipPolicy
+	return util.TrackDataRef(ctx, r.Client, cluster.Spec.ConfigDataList(), cluster.Spec.SecretDataList(), *metav1.NewControllerRef(cluster, kubeonkubev1alpha1.SchemeGroupVersion.WithKind("Cluster")), adopt)
+}
+
+// ReconcileDelete blocks the deletion while a ClusterOperation is running, resets the hosts if required,
+// then applies the config deletion policy and removes the finalizer. What it waits for is reported in status.deletion.
+func (r *ClusterReconciler) ReconcileDelete(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(cluster, ClusterFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	clusterOpsList, err := ListClusterOperations(ctx, r.Client, cluster.Name)
+	if err != nil {
+		klog.ErrorS(err, "failed to list cluster ops", "cluster", cluster.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	deletion := &kubeonkubev1alpha1.ClusterDeletionStatus{}
+	// 有正在运行的 ClusterOps，阻塞删除
+	for i := range clusterOpsList {
+		item := &clusterOpsList[i]
+		if !IsResetClusterOps(cluster, item) && item.Status.Status == kubeonkubev1alpha1.RunningStatus {
+			klog.Warningf("cluster %s is being deleted and waits for running clusterOps %s", cluster.Name, item.Name)
+			deletion.Message = fmt.Sprintf("waiting for the running clusterOps %s", item.Name)
+			r.updateDeletionStatus(ctx, cluster, deletion)
+			return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+		}
+	}
+
+	// 执行 reset.yml 清理节点，状态记录到 status.deletion
+	if cluster.Spec.DeletionPolicy != nil && cluster.Spec.DeletionPolicy.ResetHosts {
+		done, err := r.ResetHosts(ctx, cluster, clusterOpsList, deletion)
+		if err != nil {
+			klog.ErrorS(err, "failed to reset hosts", "cluster", cluster.Name)
+			deletion.Message = err.Error()
+		}
+		r.updateDeletionStatus(ctx, cluster, deletion)
+		if err != nil || !done {
+			return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+		}
+	}
+
+	// 处理 configData 和 secretData
+	if err := r.CleanupDataRef(ctx, cluster); err != nil {
+		klog.ErrorS(err, "failed to clean up configData or secretData", "cluster", cluster.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+
+	controllerutil.RemoveFinalizer(cluster, ClusterFinalizer)
+	if err := r.Client.Update(ctx, cluster); err != nil {
+		klog.ErrorS(err, "failed to remove finalizer", "cluster", cluster.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// updateDeletionStatus records what the deletion waits for, a failed update is retried with the next requeue.
+func (r *ClusterReconciler) updateDeletionStatus(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, deletion *kubeonkubev1alpha1.ClusterDeletionStatus) {
+	if reflect.DeepEqual(cluster.Status.Deletion, deletion) {
+		return
+	}
+	cluster.Status.Deletion = deletion
+	if err := r.Client.Status().Update(ctx, cluster); err != nil {
+		klog.ErrorS(err, "failed to update cluster deletion status", "cluster", cluster.Name)
+	}
+}
+
+// ResetClusterOpsName is the name of the ClusterOperation which resets the hosts before the Cluster is removed.
+func ResetClusterOpsName(cluster *kubeonkubev1alpha1.Cluster) string {
+	return fmt.Sprintf("%s-deletion-reset", cluster.Name)
+}
+
+// IsResetClusterOps reports whether the ClusterOperation was created by the deletion of the Cluster to reset its hosts:
+// it is labeled with and controlled by the Cluster and was created after the deletion started.
+func IsResetClusterOps(cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
+	if clusterOps.Name != ResetClusterOpsName(cluster) || clusterOps.Labels[ResetLabelKey] != cluster.Name {
+		return false
+	}
+	if cluster.DeletionTimestamp != nil && clusterOps.CreationTimestamp.Before(cluster.DeletionTimestamp) {
+		return false
+	}
+	owner := metav1.GetControllerOf(clusterOps)
+	return owner != nil && owner.Kind == "Cluster" && owner.UID == cluster.UID
+}
+
+// ResetHosts creates the reset ClusterOperation and reports whether it has succeeded, its state is written to deletion.
+// The reset ClusterOperation runs reset.yml, so it waits for the maintenance windows and the approval like any other.
+func (r *ClusterReconciler) ResetHosts(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOpsList []kubeonkubev1alpha1.ClusterOperation, deletion *kubeonkubev1alpha1.ClusterDeletionStatus) (bool, error) {
+	resetOpsName := ResetClusterOpsName(cluster)
+	deletion.ResetClusterOps = resetOpsName
+	var latest *kubeonkubev1alpha1.ClusterOperation
+	for i := range clusterOpsList {
+		item := &clusterOpsList[i]
+		if item.Name == resetOpsName {
+			if !IsResetClusterOps(cluster, item) {
+				return false, fmt.Errorf("clusterOps %s was not created by the deletion of the cluster, delete it to reset the hosts", resetOpsName)
+			}
+			deletion.ResetStatus = item.Status.Status
+			switch item.Status.Status {
+			case kubeonkubev1alpha1.SucceededStatus:
+				deletion.Message = fmt.Sprintf("clusterOps %s has reset the hosts", resetOpsName)
+				return true, nil
+			case kubeonkubev1alpha1.FailedStatus:
+				return false, fmt.Errorf("clusterOps %s failed, check its logs and delete it to reset the hosts again, or disable deletionPolicy.resetHosts", resetOpsName)
+			case kubeonkubev1alpha1.WaitingStatus:
+				deletion.Message = fmt.Sprintf("clusterOps %s is waiting for the maintenance window of the cluster", resetOpsName)
+			case kubeonkubev1alpha1.AwaitingApprovalStatus:
+				deletion.Message = fmt.Sprintf("clusterOps %s is awaiting approval, spec.approved must be set by another user", resetOpsName)
+			default:
+				deletion.Message = fmt.Sprintf("waiting for clusterOps %s to reset the hosts", resetOpsName)
+			}
+			return false, nil
+		}
+		if latest == nil || item.CreationTimestamp.After(latest.CreationTimestamp.Time) {
+			latest = item
+		}
+	}
+	// 默认使用最近一次 ClusterOps 的镜像，没有则使用全局配置的默认镜像
+	image := cluster.Spec.DeletionPolicy.ResetImage
+	if len(image) == 0 && latest != nil {
+		image = latest.Spec.Image
+	}
+	if len(image) == 0 {
+		image = r.Config.Get().DefaultRunnerImage
+	}
+	if len(image) == 0 {
+		return false, fmt.Errorf("no image to run %s, set deletionPolicy.resetImage or defaultRunnerImage", entrypoint.ResetPB)
+	}
+	resetOps := NewResetClusterOps(cluster, image)
+	klog.Warningf("cluster %s is being deleted and creates clusterOps %s to reset hosts", cluster.Name, resetOpsName)
+	if err := r.Client.Create(ctx, resetOps); err != nil && !apierrors.IsAlreadyExists(err) {
+		return false, err
+	}
+	deletion.Message = fmt.Sprintf("waiting for clusterOps %s to reset the hosts", resetOpsName)
+	return false, nil
+}
+
+// NewResetClusterOps runs reset.yml against the hosts of the Cluster, it is labeled with and controlled by the Cluster.
+func NewResetClusterOps(cluster *kubeonkubev1alpha1.Cluster, image string) *kubeonkubev1alpha1.ClusterOperation {
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ResetClusterOpsName(cluster),
+			Labels:          map[string]string{ClusterLabelKey: cluster.Name, ResetLabelKey: cluster.Name},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(cluster, kubeonkubev1alpha1.SchemeGroupVersion.WithKind("Cluster"))},
+		},
+		Spec: kubeonkubev1alpha1.ClusterOperationSpec{
+			Cluster:    cluster.Name,
+			ActionType: kubeonkubev1alpha1.PlaybookActionType,
+			Action:     entrypoint.ResetPB,
+			ExtraArgs:  "-e reset_confirmation=yes",
+			Image:      image,
+		},
+	}
+}
+
+// CleanupDataRef deletes or releases the configData and secretData according to the deletion policy.
+func (r *ClusterReconciler) CleanupDataRef(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster) error {
+	if cluster.Spec.GetConfigDeletionPolicy() == kubeonkubev1alpha1.DeleteConfigDeletionPolicy {
+		return util.DeleteDataRef(ctx, r.Client, cluster.Spec.ConfigDataList(), cluster.Spec.SecretDataList(), cluster.Name, cluster.UID)
+	}
+	return util.UntrackDataRef(ctx, r.Client, cluster.Spec.ConfigDataList(), cluster.Spec.SecretDataList(), cluster.Name, cluster.UID)
 }
@@ -0,0 +1,410 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/entrypoint"
+)
+
+func newDeletingCluster(resetHosts bool) *kubeonkubev1alpha1.Cluster {
+	deleted := metav1.NewTime(created)
+	return &kubeonkubev1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "c1",
+			UID:               types.UID("cluster-uid"),
+			DeletionTimestamp: &deleted,
+			Finalizers:        []string{ClusterFinalizer},
+		},
+		Spec: kubeonkubev1alpha1.ClusterSpec{
+			DeletionPolicy: &kubeonkubev1alpha1.DeletionPolicy{ResetHosts: resetHosts, ResetImage: "kubespray:v2.23.1"},
+		},
+	}
+}
+
+func newTestResetClusterOps(cluster *kubeonkubev1alpha1.Cluster, status kubeonkubev1alpha1.OpsStatus) *kubeonkubev1alpha1.ClusterOperation {
+	clusterOps := NewResetClusterOps(cluster, "kubespray:v2.23.1")
+	clusterOps.CreationTimestamp = metav1.NewTime(created.Add(time.Minute))
+	clusterOps.Status.Status = status
+	return clusterOps
+}
+
+func TestIsResetClusterOps(t *testing.T) {
+	cluster := newDeletingCluster(true)
+	if !IsResetClusterOps(cluster, newTestResetClusterOps(cluster, "")) {
+		t.Error("the reset clusterOps must belong to the deletion")
+	}
+	unlabeled := newTestResetClusterOps(cluster, "")
+	delete(unlabeled.Labels, ResetLabelKey)
+	otherOwner := newTestResetClusterOps(cluster, "")
+	otherOwner.OwnerReferences[0].UID = types.UID("other-uid")
+	unowned := newTestResetClusterOps(cluster, "")
+	unowned.OwnerReferences = nil
+	early := newTestResetClusterOps(cluster, "")
+	early.CreationTimestamp = metav1.NewTime(created.Add(-time.Minute))
+	renamed := newTestResetClusterOps(cluster, "")
+	renamed.Name = "other"
+	for name, clusterOps := range map[string]*kubeonkubev1alpha1.ClusterOperation{
+		"unlabeled": unlabeled, "other owner": otherOwner, "unowned": unowned, "created before the deletion": early, "renamed": renamed,
+	} {
+		if IsResetClusterOps(cluster, clusterOps) {
+			t.Errorf("%s: must not belong to the deletion", name)
+		}
+	}
+}
+
+func TestReconcileDelete(t *testing.T) {
+	tests := []struct {
+		name          string
+		resetHosts    bool
+		clusterOps    []*kubeonkubev1alpha1.ClusterOperation
+		wantRemoved   bool
+		wantCreated   bool
+		wantMessage   string
+		wantResetStat kubeonkubev1alpha1.OpsStatus
+	}{
+		{name: "no reset", wantRemoved: true},
+		{
+			name:        "running clusterOps",
+			clusterOps:  []*kubeonkubev1alpha1.ClusterOperation{newTestClusterOps("scale", "c1", kubeonkubev1alpha1.RunningStatus, 0, time.Hour)},
+			wantMessage: "waiting for the running clusterOps scale",
+		},
+		{name: "creates the reset", resetHosts: true, wantCreated: true, wantMessage: "waiting for clusterOps c1-deletion-reset"},
+		{
+			name:          "reset waits for the maintenance window",
+			resetHosts:    true,
+			clusterOps:    []*kubeonkubev1alpha1.ClusterOperation{newTestResetClusterOps(newDeletingCluster(true), kubeonkubev1alpha1.WaitingStatus)},
+			wantMessage:   "maintenance window",
+			wantResetStat: kubeonkubev1alpha1.WaitingStatus,
+		},
+		{
+			name:          "reset awaits approval",
+			resetHosts:    true,
+			clusterOps:    []*kubeonkubev1alpha1.ClusterOperation{newTestResetClusterOps(newDeletingCluster(true), kubeonkubev1alpha1.AwaitingApprovalStatus)},
+			wantMessage:   "awaiting approval",
+			wantResetStat: kubeonkubev1alpha1.AwaitingApprovalStatus,
+		},
+		{
+			name:          "reset failed",
+			resetHosts:    true,
+			clusterOps:    []*kubeonkubev1alpha1.ClusterOperation{newTestResetClusterOps(newDeletingCluster(true), kubeonkubev1alpha1.FailedStatus)},
+			wantMessage:   "delete it to reset the hosts again",
+			wantResetStat: kubeonkubev1alpha1.FailedStatus,
+		},
+		{
+			name:          "reset succeeded",
+			resetHosts:    true,
+			clusterOps:    []*kubeonkubev1alpha1.ClusterOperation{newTestResetClusterOps(newDeletingCluster(true), kubeonkubev1alpha1.SucceededStatus)},
+			wantRemoved:   true,
+			wantResetStat: kubeonkubev1alpha1.SucceededStatus,
+		},
+		{
+			name:       "forged reset",
+			resetHosts: true,
+			clusterOps: []*kubeonkubev1alpha1.ClusterOperation{func() *kubeonkubev1alpha1.ClusterOperation {
+				forged := newTestClusterOps("c1-deletion-reset", "c1", kubeonkubev1alpha1.SucceededStatus, 0, time.Hour)
+				forged.Labels = map[string]string{ResetLabelKey: "c1"}
+				return forged
+			}()},
+			wantMessage: "was not created by the deletion",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := newDeletingCluster(tt.resetHosts)
+			objs := []client.Object{cluster.DeepCopy()}
+			for _, item := range tt.clusterOps {
+				objs = append(objs, item)
+			}
+			c := newTestClient(t, objs...)
+			r := &ClusterReconciler{Client: c}
+			if err := c.Get(context.Background(), client.ObjectKey{Name: cluster.Name}, cluster); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.ReconcileDelete(context.Background(), cluster); err != nil {
+				t.Fatal(err)
+			}
+			if removed := !controllerutil.ContainsFinalizer(cluster, ClusterFinalizer); removed != tt.wantRemoved {
+				t.Errorf("finalizer removed %v, want %v", removed, tt.wantRemoved)
+			}
+			if tt.wantRemoved {
+				return
+			}
+			if cluster.Status.Deletion == nil || !strings.Contains(cluster.Status.Deletion.Message, tt.wantMessage) {
+				t.Errorf("deletion status %+v, want the message %q", cluster.Status.Deletion, tt.wantMessage)
+			} else if cluster.Status.Deletion.ResetStatus != tt.wantResetStat {
+				t.Errorf("reset status %q, want %q", cluster.Status.Deletion.ResetStatus, tt.wantResetStat)
+			}
+			resetOps := &kubeonkubev1alpha1.ClusterOperation{}
+			err := c.Get(context.Background(), client.ObjectKey{Name: ResetClusterOpsName(cluster)}, resetOps)
+			if tt.wantCreated {
+				if err != nil {
+					t.Fatalf("the reset clusterOps is not created: %v", err)
+				}
+				if resetOps.Spec.Action != entrypoint.ResetPB || resetOps.Spec.Image != "kubespray:v2.23.1" || resetOps.Labels[ResetLabelKey] != "c1" {
+					t.Errorf("unexpected reset clusterOps %+v", resetOps)
+				}
+				if owner := metav1.GetControllerOf(resetOps); owner == nil || owner.UID != cluster.UID {
+					t.Errorf("the reset clusterOps must be controlled by the cluster, got %v", owner)
+				}
+			}
+		})
+	}
+}
+
+func TestCleanExcessClusterOpsKeepsRestored(t *testing.T) {
+	restored := newTestClusterOps("restored", "c1", kubeonkubev1alpha1.SucceededStatus, 0, time.Minute)
+	restored.Annotations = map[string]string{archive.RestoredAnno: "c1/restored-1.yaml"}
+	kept := newTestClusterOps("kept", "c1", kubeonkubev1alpha1.SucceededStatus, 0, time.Hour)
+	pruned := newTestClusterOps("pruned", "c1", kubeonkubev1alpha1.SucceededStatus, 0, 2*time.Hour)
+	c := newTestClient(t, restored, kept, pruned)
+	r := &ClusterReconciler{Client: c}
+	cluster := &kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c1"}}
+	if _, _, err := r.CleanExcessClusterOps(context.Background(), cluster, OpsRetention{BackEndLimit: 10, SucceededLimit: 1, FailedLimit: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"restored": true, "kept": true, "pruned": false} {
+		err := c.Get(context.Background(), client.ObjectKey{Name: name}, &kubeonkubev1alpha1.ClusterOperation{})
+		if got := err == nil; got != want {
+			t.Errorf("clusterOps %s exists %v, want %v", name, got, want)
+		}
+	}
+}
+
+func newTestLifecycleOps(name, action string, status kubeonkubev1alpha1.OpsStatus, age time.Duration) *kubeonkubev1alpha1.ClusterOperation {
+	clusterOps := newTestClusterOps(name, "c1", status, 0, age)
+	clusterOps.Spec.ActionType = kubeonkubev1alpha1.PlaybookActionType
+	clusterOps.Spec.Action = action
+	return clusterOps
+}
+
+func TestLatestLifecycleClusterOps(t *testing.T) {
+	dryRun := newTestLifecycleOps("dry-run", entrypoint.UpgradeClusterPB, kubeonkubev1alpha1.SucceededStatus, time.Minute)
+	dryRun.Spec.DryRun = true
+	renderOnly := newTestLifecycleOps("render-only", entrypoint.ClusterPB, kubeonkubev1alpha1.SucceededStatus, time.Minute)
+	renderOnly.Spec.RenderOnly = true
+	shell := newTestLifecycleOps("shell", entrypoint.ClusterPB, kubeonkubev1alpha1.SucceededStatus, time.Minute)
+	shell.Spec.ActionType = kubeonkubev1alpha1.ShellActionType
+	tests := []struct {
+		name string
+		ops  []*kubeonkubev1alpha1.ClusterOperation
+		want string
+	}{
+		{name: "none"},
+		{
+			name: "latest install or upgrade",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestLifecycleOps("install", entrypoint.ClusterPB, kubeonkubev1alpha1.SucceededStatus, 3*time.Hour),
+				newTestLifecycleOps("upgrade", entrypoint.UpgradeClusterPB, kubeonkubev1alpha1.SucceededStatus, 2*time.Hour),
+				newTestLifecycleOps("scale", entrypoint.ScalePB, kubeonkubev1alpha1.SucceededStatus, time.Hour),
+			},
+			want: "upgrade",
+		},
+		{
+			name: "failed, dry run, render only and shell are skipped",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestLifecycleOps("install", entrypoint.ClusterPB, kubeonkubev1alpha1.SucceededStatus, 3*time.Hour),
+				newTestLifecycleOps("failed", entrypoint.UpgradeClusterPB, kubeonkubev1alpha1.FailedStatus, 2*time.Hour),
+				dryRun, renderOnly, shell,
+			},
+			want: "install",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := []kubeonkubev1alpha1.ClusterOperation{}
+			for _, item := range tt.ops {
+				list = append(list, *item)
+			}
+			if got := LatestLifecycleClusterOps(list); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetOpsRetention(t *testing.T) {
+	one, two := 1, 2
+	zero := int32(0)
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		cluster *kubeonkubev1alpha1.ClusterSpec
+		want    OpsRetention
+	}{
+		{name: "defaults", cfg: config.Default(), want: OpsRetention{BackEndLimit: config.DefaultClusterOperationsBackEndLimit, SucceededLimit: -1, FailedLimit: -1}},
+		{
+			name: "global",
+			cfg:  &config.Config{Retention: config.Retention{BackEndLimit: 10, SucceededLimit: &two, FailedLimit: &one, TTL: metav1.Duration{Duration: time.Hour}}},
+			want: OpsRetention{BackEndLimit: 10, SucceededLimit: 2, FailedLimit: 1, TTL: time.Hour},
+		},
+		{
+			name: "cluster takes precedence",
+			cfg:  &config.Config{Retention: config.Retention{BackEndLimit: 10, SucceededLimit: &two, FailedLimit: &one, TTL: metav1.Duration{Duration: time.Hour}}},
+			cluster: &kubeonkubev1alpha1.ClusterSpec{OpsRetention: &kubeonkubev1alpha1.OpsRetentionPolicy{
+				FailedLimit: &zero, TTL: &metav1.Duration{Duration: 24 * time.Hour},
+			}},
+			want: OpsRetention{BackEndLimit: 10, SucceededLimit: 2, FailedLimit: 0, TTL: 24 * time.Hour},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &kubeonkubev1alpha1.Cluster{}
+			if tt.cluster != nil {
+				cluster.Spec = *tt.cluster
+			}
+			if got := GetOpsRetention(tt.cfg, cluster); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanExcessClusterOps(t *testing.T) {
+	succeeded, failed := kubeonkubev1alpha1.SucceededStatus, kubeonkubev1alpha1.FailedStatus
+	unlimited := OpsRetention{BackEndLimit: 30, SucceededLimit: -1, FailedLimit: -1}
+	finished := func(clusterOps *kubeonkubev1alpha1.ClusterOperation, ago time.Duration) *kubeonkubev1alpha1.ClusterOperation {
+		clusterOps.Status.EndTime = &metav1.Time{Time: time.Now().Add(-ago)}
+		return clusterOps
+	}
+	retained := newTestClusterOps("retained", "c1", succeeded, 0, 4*time.Hour)
+	retained.Annotations = map[string]string{RetainAnno: "true"}
+	tests := []struct {
+		name       string
+		ops        []*kubeonkubev1alpha1.ClusterOperation
+		retention  OpsRetention
+		failing    bool
+		want       []string
+		wantRetry  bool
+		wantExpiry bool
+	}{
+		{
+			name: "backend limit counts the running ones",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("running", "c1", kubeonkubev1alpha1.RunningStatus, 0, time.Minute),
+				newTestClusterOps("new", "c1", succeeded, 0, time.Hour),
+				newTestClusterOps("old", "c1", succeeded, 0, 2*time.Hour),
+			},
+			retention: OpsRetention{BackEndLimit: 2, SucceededLimit: -1, FailedLimit: -1},
+			want:      []string{"running", "new"},
+			wantRetry: true,
+		},
+		{
+			name: "succeeded and failed limits",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("succeeded-new", "c1", succeeded, 0, time.Hour),
+				newTestClusterOps("succeeded-old", "c1", succeeded, 0, 2*time.Hour),
+				newTestClusterOps("failed-new", "c1", failed, 0, time.Hour),
+				newTestClusterOps("failed-old", "c1", failed, 0, 2*time.Hour),
+			},
+			retention: OpsRetention{BackEndLimit: 30, SucceededLimit: 1, FailedLimit: 0},
+			want:      []string{"succeeded-new"},
+			wantRetry: true,
+		},
+		{
+			name: "retained and the latest install are kept",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				retained,
+				newTestLifecycleOps("install", entrypoint.ClusterPB, succeeded, 3*time.Hour),
+				newTestClusterOps("scale", "c1", succeeded, 0, time.Hour),
+			},
+			retention: OpsRetention{BackEndLimit: 30, SucceededLimit: 0, FailedLimit: -1},
+			want:      []string{"retained", "install"},
+			wantRetry: true,
+		},
+		{
+			name: "expired",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				finished(newTestClusterOps("expired", "c1", succeeded, 0, 3*time.Hour), 2*time.Hour),
+				finished(newTestClusterOps("fresh", "c1", failed, 0, 2*time.Hour), 10*time.Minute),
+			},
+			retention:  OpsRetention{BackEndLimit: 30, SucceededLimit: -1, FailedLimit: -1, TTL: time.Hour},
+			want:       []string{"fresh"},
+			wantRetry:  true,
+			wantExpiry: true,
+		},
+		{
+			name: "nothing to clean",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("a", "c1", succeeded, 0, time.Hour),
+				newTestClusterOps("other-cluster", "c2", succeeded, 0, 2*time.Hour),
+			},
+			retention: unlimited,
+			want:      []string{"a", "other-cluster"},
+		},
+		{
+			name: "kept when the archive fails",
+			ops: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("new", "c1", succeeded, 0, time.Hour),
+				newTestClusterOps("old", "c1", succeeded, 0, 2*time.Hour),
+			},
+			retention: OpsRetention{BackEndLimit: 30, SucceededLimit: 1, FailedLimit: -1},
+			failing:   true,
+			want:      []string{"new", "old"},
+			wantRetry: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{}
+			for _, item := range tt.ops {
+				objs = append(objs, item.DeepCopy())
+			}
+			c := newTestClient(t, objs...)
+			r := &ClusterReconciler{Client: c}
+			if tt.failing {
+				r.Archiver = &archive.Archiver{Store: &failingStore{}, Client: c}
+			}
+			cluster := &kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c1"}}
+			retry, expiry, err := r.CleanExcessClusterOps(context.Background(), cluster, tt.retention)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if retry != tt.wantRetry || (expiry > 0) != tt.wantExpiry {
+				t.Errorf("got retry %v expiry %v, want retry %v expiry %v", retry, expiry, tt.wantRetry, tt.wantExpiry)
+			}
+			list := &kubeonkubev1alpha1.ClusterOperationList{}
+			if err := c.List(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+			kept := map[string]bool{}
+			for _, item := range list.Items {
+				kept[item.Name] = true
+			}
+			if len(kept) != len(tt.want) {
+				t.Errorf("kept %v, want %v", kept, tt.want)
+			}
+			for _, name := range tt.want {
+				if !kept[name] {
+					t.Errorf("clusterOps %s is deleted, kept %v", name, kept)
+				}
+			}
+		})
+	}
+}
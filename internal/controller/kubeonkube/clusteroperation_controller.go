@@ -19,6 +19,7 @@ package kubeonkube
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
@@ -26,20 +27,27 @@ import (
 	"unicode"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
 	klog "k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/clay-wangzhi/kube-on-kube/api"
 	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
-	kokClientSet "github.com/clay-wangzhi/kube-on-kube/generated/clientset/versioned"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
 	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
 	"github.com/clay-wangzhi/kube-on-kube/pkg/util/entrypoint"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/inventory"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/runnerimage"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -53,15 +61,27 @@ const (
 
 // ClusterOperationReconciler reconciles a ClusterOperation object
 type ClusterOperationReconciler struct {
-	Client       client.Client
-	Scheme       *runtime.Scheme
-	ClientSet    kubernetes.Interface
-	KokClientSet kokClientSet.Interface
+	Client client.Client
+	Scheme *runtime.Scheme
+	// Config is the hot-reloaded controller configuration, the defaults are used when it is nil.
+	Config *config.Provider
+	// Scheduler enforces the concurrency limits, every ClusterOperation runs at once when it is nil.
+	Scheduler *Scheduler
+	// Runner runs the ClusterOperations, the Job runner is used when it is nil.
+	Runner Runner
+	// ApprovalWebhook reports whether the admission webhook records the requester and the approver.
+	// Without it the annotations can be written by anyone, the ClusterOperations requiring approval are refused.
+	ApprovalWebhook bool
 }
 
 //+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperations,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperations/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperations/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,23 +96,47 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	clusterOps := &kubeonkubev1alpha1.ClusterOperation{}
 	if err := r.Client.Get(ctx, req.NamespacedName, clusterOps); err != nil {
 		if apierrors.IsNotFound(err) {
+			// the Job is garbage collected with the clusterOps, the other runners are cancelled by the name of the Job
+			clusterOps.Name = req.Name
+			clusterOps.Status.JobRef = &api.JobRef{Name: r.GenerateJobName(clusterOps)}
+			if err := r.runner().Cancel(ctx, clusterOps); err != nil {
+				klog.ErrorS(err, "failed to cancel the runner", "clusterOps", req.Name)
+			}
 			return ctrl.Result{}, nil
 		}
 		klog.ErrorS(err, "failed to get cluster ops", "clusterOps", req.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
-	// stop reconcile if the clusterOps has been already finished
+	// stop reconcile if the clusterOps has been already finished, a succeeded dry run may still be promoted
 	if clusterOps.Status.Status == kubeonkubev1alpha1.SucceededStatus || clusterOps.Status.Status == kubeonkubev1alpha1.FailedStatus {
+		if err := r.PromoteDryRun(ctx, clusterOps); err != nil {
+			klog.ErrorS(err, "failed to promote the dry run", "clusterOps", clusterOps.Name)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		return ctrl.Result{}, nil
+	}
+	// restored from the archive, it is a record only and never runs
+	if _, ok := clusterOps.Annotations[archive.RestoredAnno]; ok {
 		return ctrl.Result{}, nil
 	}
 
 	// 从 cluster 中获取一些必要信息
-	cluster, err := r.GetKubeOnkubeCluster(clusterOps)
+	cluster, err := r.GetKubeOnkubeCluster(ctx, clusterOps)
 	if err != nil {
 		klog.ErrorS(err, "failed to get kubeonkube cluster", "clusterOps", clusterOps.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
+	// Cluster 删除中，除了 reset 之外不再启动新的 ClusterOps
+	if !cluster.DeletionTimestamp.IsZero() && IsPendingClusterOps(clusterOps) && !IsResetClusterOps(cluster, clusterOps) {
+		klog.Errorf("cluster %s is being deleted, clusterOps %s update status Failed", cluster.Name, clusterOps.Name)
+		clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+		if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+			klog.Error(err)
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// 判断镜像名称是否合理, 镜像不合理就将状态设置为失败，终止调谐
 	if !IsValidImageName(clusterOps.Spec.Image) {
 		klog.Errorf("clusterOps %s has wrong image format and update status Failed", clusterOps.Name)
@@ -103,9 +147,27 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, nil
 	}
 
-	// 检查相关配置文件是否存在,不存在设置为失败，终止调谐
-	if err := r.CheckClusterDataRef(cluster, clusterOps); err != nil {
-		klog.Error(err.Error())
+	// 检查镜像是否支持目标 kube_version、操作系统和 playbook，不支持就将状态设置为失败，终止调谐
+	// 排队的 ClusterOps 在进入 Queued 之前已经检查过，不再重复读取 Cluster 的配置
+	if IsPendingClusterOps(clusterOps) && clusterOps.Status.Status != kubeonkubev1alpha1.QueuedStatus {
+		target, err := runnerimage.Target(ctx, r.Client, cluster, clusterOps)
+		if err != nil {
+			klog.ErrorS(err, "failed to resolve the target of runner image", "clusterOps", clusterOps.Name)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		if err := r.Config.Get().RunnerImages.Check(clusterOps.Spec.Image, target); err != nil {
+			klog.Errorf("clusterOps %s has incompatible image %s and update status Failed", clusterOps.Name, err.Error())
+			clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+			if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+				klog.Error(err)
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// 检查额外的 volume 是否合法，不合法就将状态设置为失败，终止调谐
+	if err := ValidateRunnerVolumes(clusterOps, r.writablePaths(clusterOps)); err != nil {
+		klog.Errorf("clusterOps %s has wrong volumes %s and update status Failed", clusterOps.Name, err.Error())
 		clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
 		if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
 			klog.Error(err)
@@ -113,8 +175,44 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, nil
 	}
 
+	// 检查 runner 使用的 ServiceAccount 是否在配置的 runnerServiceAccounts 中，不在就将状态设置为失败，终止调谐
+	if IsPendingClusterOps(clusterOps) {
+		if err := r.Config.Get().CheckRunnerServiceAccount(RunnerPodSpecFor(cluster, clusterOps).ServiceAccountName); err != nil {
+			klog.Errorf("clusterOps %s: %s and update status Failed", clusterOps.Name, err.Error())
+			clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+			if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+				klog.Error(err)
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// 检查 runner 后端能否执行 ClusterOps，例如 local 后端不支持 PVC 卷，不支持就将状态设置为失败，终止调谐
+	if IsPendingClusterOps(clusterOps) {
+		if err := r.runner().Check(clusterOps, RunnerPodSpecFor(cluster, clusterOps)); err != nil {
+			klog.Errorf("clusterOps %s: %s and update status Failed", clusterOps.Name, err.Error())
+			clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+			if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+				klog.Error(err)
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// 检查相关配置文件是否存在,不存在设置为失败，终止调谐，排队的 ClusterOps 已经检查过
+	if clusterOps.Status.Status != kubeonkubev1alpha1.QueuedStatus {
+		if err := r.CheckClusterDataRef(ctx, cluster, clusterOps); err != nil {
+			klog.Error(err.Error())
+			clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+			if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+				klog.Error(err)
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+
 	// 添加 OwnReference, 然后延迟加入队列，继续调谐
-	needRequeue, err := r.UpdateOperationOwnReferenceForCluster(cluster, clusterOps)
+	needRequeue, err := r.UpdateOperationOwnReferenceForCluster(ctx, cluster, clusterOps)
 	if err != nil {
 		klog.ErrorS(err, "failed to update ownreference", "cluster", cluster.Name, "clusterOps", clusterOps.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
@@ -123,8 +221,47 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
+	// 固定 ClusterOps 的运维 namespace，备份、entrypoint 和 Job 都位于其中
+	needRequeue, err = r.UpdateStatusOperationsNamespace(ctx, cluster, clusterOps)
+	if err != nil {
+		klog.ErrorS(err, "failed to update operations namespace", "cluster", cluster.Name, "clusterOps", clusterOps.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if needRequeue {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// 检查 volume 引用的 PVC 是否位于运维 namespace，不存在就将状态设置为失败，终止调谐
+	if clusterOps.Status.JobRef.IsEmpty() && IsPendingClusterOps(clusterOps) {
+		if err := r.CheckRunnerVolumeClaims(ctx, clusterOps); err != nil {
+			if !apierrors.IsNotFound(err) {
+				klog.ErrorS(err, "failed to check the persistentVolumeClaims", "clusterOps", clusterOps.Name)
+				return ctrl.Result{RequeueAfter: requeueAfter}, nil
+			}
+			klog.Errorf("clusterOps %s has wrong volumes %s and update status Failed", clusterOps.Name, err.Error())
+			clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+			if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+				klog.Error(err)
+			}
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// 只渲染 entrypoint.sh 和 Job 写入 status.preview，不备份配置，也不创建 Job
+	if clusterOps.Spec.RenderOnly {
+		if err := r.UpdateStatusPreview(ctx, cluster, clusterOps); err != nil {
+			klog.ErrorS(err, "failed to render clusterOps preview", "clusterOps", clusterOps.Name)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		if err := r.UpdateStatusForLabel(ctx, clusterOps); err != nil {
+			klog.Error(err)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// 更新 StatusDigest，然后延迟加入队列，继续调谐
-	needRequeue, err = r.UpdateClusterOpsStatusDigest(clusterOps)
+	needRequeue, err = r.UpdateClusterOpsStatusDigest(ctx, clusterOps)
 	if err != nil {
 		klog.ErrorS(err, "failed to get update clusterOps status digest", "clusterOps", clusterOps.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
@@ -134,7 +271,7 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	// 根基 Digest 判断 Yaml 文件创建后是否被修改过, 如果修改过，更新状态，然后延迟加入队列，继续调谐
-	needRequeue, err = r.UpdateStatusHasModified(clusterOps)
+	needRequeue, err = r.UpdateStatusHasModified(ctx, clusterOps)
 	if err != nil {
 		klog.ErrorS(err, "failed to update clusterOps status", "clusterOps", clusterOps.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
@@ -143,8 +280,115 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
+	// 审批，action 或任一钩子匹配审批策略的 ClusterOps 等到其他用户设置 spec.approved 后再执行
+	if clusterOps.Status.JobRef.IsEmpty() && !clusterOps.Spec.DryRun && r.Config.Get().Approval.Requires(clusterOps.Spec.Actions(), cluster.Labels) {
+		// 审批人只有 webhook 能够可信地记录，未启用 webhook 时拒绝执行
+		if !r.ApprovalWebhook {
+			klog.Errorf("clusterOps %s requires approval but the admission webhook is disabled, start the controller with --enable-webhooks, update status Failed", clusterOps.Name)
+			clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+			if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+				klog.Error(err)
+			}
+			return ctrl.Result{}, nil
+		}
+		needRequeue, err = r.UpdateStatusApproval(ctx, clusterOps)
+		if err != nil {
+			klog.ErrorS(err, "failed to update clusterOps approval", "clusterOps", clusterOps.Name)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		if needRequeue {
+			// 审批后 ClusterOps 的修改会触发调谐
+			return ctrl.Result{}, nil
+		}
+	}
+
+	// 维护窗口，破坏性的 ClusterOps 等到 Cluster 的下一个维护窗口开启后再执行，带有 clay.io/maintenance-override 注解时立即执行
+	if clusterOps.Status.JobRef.IsEmpty() && IsDisruptiveClusterOps(cluster, clusterOps) {
+		open, next, err := MaintenanceWindowOpen(cluster.Spec.Maintenance.Windows, time.Now())
+		if err != nil {
+			klog.ErrorS(err, "failed to check maintenance windows", "cluster", cluster.Name, "clusterOps", clusterOps.Name)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		if !open {
+			if clusterOps.Status.Status != kubeonkubev1alpha1.WaitingStatus || !nextWindowTimeEqual(clusterOps.Status.NextWindowTime, next) {
+				clusterOps.Status.Status = kubeonkubev1alpha1.WaitingStatus
+				clusterOps.Status.NextWindowTime = nil
+				if !next.IsZero() {
+					clusterOps.Status.NextWindowTime = &metav1.Time{Time: next}
+				}
+				if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+					klog.ErrorS(err, "failed to update clusterOps status Waiting", "clusterOps", clusterOps.Name)
+					return ctrl.Result{RequeueAfter: requeueAfter}, nil
+				}
+			}
+			// 窗口开启时再次调谐，Cluster 修改维护窗口或 ClusterOps 添加注解时由 watch 触发
+			if next.IsZero() {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{RequeueAfter: time.Until(next)}, nil
+		}
+	}
+	if clusterOps.Status.Status == kubeonkubev1alpha1.WaitingStatus {
+		clusterOps.Status.Status = ""
+		clusterOps.Status.NextWindowTime = nil
+		if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+			klog.ErrorS(err, "failed to update clusterOps status", "clusterOps", clusterOps.Name)
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// 并发控制，超出全局、集群或分组的限制时排队，备份在准入之后进行，保证使用运行时的配置
+	// 先标记为 Queued 再模拟准入，只有到达准入这一步的 ClusterOps 才参与排队
+	if clusterOps.Status.JobRef.IsEmpty() && r.Scheduler.Limited() && clusterOps.Status.Status != kubeonkubev1alpha1.QueuedStatus {
+		clusterOps.Status.Status = kubeonkubev1alpha1.QueuedStatus
+		clusterOps.Status.QueuePosition = 0
+		if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+			klog.ErrorS(err, "failed to update clusterOps status Queued", "clusterOps", clusterOps.Name)
+		}
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if clusterOps.Status.JobRef.IsEmpty() {
+		admitted, position, err := r.Scheduler.Admit(ctx, clusterOps)
+		if err != nil {
+			klog.ErrorS(err, "failed to schedule clusterOps", "clusterOps", clusterOps.Name)
+			return ctrl.Result{RequeueAfter: requeueAfter}, nil
+		}
+		if !admitted {
+			if clusterOps.Status.Status != kubeonkubev1alpha1.QueuedStatus || clusterOps.Status.QueuePosition != position {
+				clusterOps.Status.Status = kubeonkubev1alpha1.QueuedStatus
+				clusterOps.Status.QueuePosition = position
+				if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+					klog.ErrorS(err, "failed to update clusterOps queue position", "clusterOps", clusterOps.Name)
+					return ctrl.Result{RequeueAfter: requeueAfter}, nil
+				}
+			}
+			// 名额释放时由 watch 触发，较长的定时调谐只用于兜底并发配置的变化
+			return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+		}
+	}
+
+	// 不在运维 namespace 中的配置（如旧版本的备份）迁移到运维 namespace
+	needRequeue, err = r.MigrateDataRef(ctx, clusterOps)
+	if err != nil {
+		klog.ErrorS(err, "failed to migrate data ref", "clusterOps", clusterOps.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if needRequeue {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// runner 的备份同样迁移到运维 namespace
+	needRequeue, err = r.MigrateRunnerBackup(ctx, clusterOps)
+	if err != nil {
+		klog.ErrorS(err, "failed to migrate runner backup", "clusterOps", clusterOps.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if needRequeue {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
 	// 拷贝会用到的配置文件
-	needRequeue, err = r.BackUpDataRef(clusterOps, cluster)
+	needRequeue, err = r.BackUpDataRef(ctx, clusterOps, cluster)
 	if err != nil {
 		klog.ErrorS(err, "failed to backup data ref", "clusterOps", clusterOps.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
@@ -153,8 +397,38 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
+	// 拷贝额外 volume 用到的 configmap 和 secret
+	needRequeue, err = r.BackUpVolumes(ctx, clusterOps)
+	if err != nil {
+		klog.ErrorS(err, "failed to backup volumes", "clusterOps", clusterOps.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if needRequeue {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// 拷贝 runner 的 ansible.cfg 和 envFrom 用到的 configmap 和 secret
+	needRequeue, err = r.BackUpRunnerData(ctx, cluster, clusterOps)
+	if err != nil {
+		klog.ErrorS(err, "failed to backup runner data", "clusterOps", clusterOps.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if needRequeue {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
+	// 合并 extraVars 写入 secret，以 -e @file 的方式传给 playbook
+	needRequeue, err = r.CreateExtraVarsSecret(ctx, clusterOps)
+	if err != nil {
+		klog.ErrorS(err, "failed to create extra vars secret", "clusterOps", clusterOps.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if needRequeue {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
 	// 生成 entrypoint 命令,存入 configmap中
-	needRequeue, err = r.CreateEntryPointShellConfigMap(clusterOps)
+	needRequeue, err = r.CreateEntryPointShellConfigMap(ctx, clusterOps)
 	if argsErr, ok := err.(entrypoint.ArgsError); ok {
 		// preHook or postHook or action error args
 		klog.Errorf("clusterOps %s wrong args %s and update status Failed", clusterOps.Name, argsErr.Error())
@@ -173,7 +447,7 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	// 新增 Job
-	needRequeue, err = r.CreateKubeSprayJob(clusterOps)
+	needRequeue, err = r.CreateKubeSprayJob(ctx, clusterOps, cluster)
 	if err != nil {
 		klog.ErrorS(err, "failed to create kubespray job", "clusterOps", clusterOps.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
@@ -183,7 +457,7 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	// 更新状态
-	needRequeue, err = r.UpdateStatusLoop(clusterOps, r.FetchJobConditionStatusAndCompletionTime)
+	needRequeue, err = r.UpdateStatusLoop(ctx, clusterOps, r.runner().Status)
 	if err != nil {
 		klog.ErrorS(err, "failed to update status loop", "clusterOps", clusterOps.Name)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
@@ -192,7 +466,7 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
-	if err := r.UpdateStatusForLabel(clusterOps); err != nil {
+	if err := r.UpdateStatusForLabel(ctx, clusterOps); err != nil {
 		klog.Error(err)
 		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
@@ -201,15 +475,44 @@ func (r *ClusterOperationReconciler) Reconcile(ctx context.Context, req ctrl.Req
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Jobs are owned by their ClusterOperation, so job completion triggers a reconcile through the cache.
+// Every ClusterOperation event also wakes up the queued ones, so they are admitted as soon as a slot frees up.
+// Cluster events wake up the Waiting ones, so a change of the maintenance windows applies at once.
 func (r *ClusterOperationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubeonkubev1alpha1.ClusterOperation{}).
+		Owns(&batchv1.Job{}).
+		Watches(&source.Kind{Type: &kubeonkubev1alpha1.ClusterOperation{}}, handler.EnqueueRequestsFromMapFunc(r.Scheduler.queuedClusterOps)).
+		Watches(&source.Kind{Type: &kubeonkubev1alpha1.Cluster{}}, handler.EnqueueRequestsFromMapFunc(r.waitingClusterOps)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Config.Get().Concurrency.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
-func (r *ClusterOperationReconciler) GetKubeOnkubeCluster(clusterOps *kubeonkubev1alpha1.ClusterOperation) (*kubeonkubev1alpha1.Cluster, error) {
+func (r *ClusterOperationReconciler) GetKubeOnkubeCluster(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (*kubeonkubev1alpha1.Cluster, error) {
 	// cluster has many clusterOps.
-	return r.KokClientSet.KubeonkubeV1alpha1().Clusters().Get(context.Background(), clusterOps.Spec.Cluster, metav1.GetOptions{})
+	cluster := &kubeonkubev1alpha1.Cluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: clusterOps.Spec.Cluster}, cluster); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// IsPendingClusterOps reports whether the ClusterOperation has not started yet.
+func IsPendingClusterOps(clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
+	switch clusterOps.Status.Status {
+	case "", kubeonkubev1alpha1.QueuedStatus, kubeonkubev1alpha1.WaitingStatus, kubeonkubev1alpha1.AwaitingApprovalStatus:
+		return true
+	}
+	return false
+}
+
+// IsActiveClusterOps reports whether the ClusterOperation has not finished yet.
+func IsActiveClusterOps(clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
+	switch clusterOps.Status.Status {
+	case kubeonkubev1alpha1.SucceededStatus, kubeonkubev1alpha1.FailedStatus:
+		return false
+	}
+	return true
 }
 
 func IsValidImageName(image string) bool {
@@ -224,7 +527,7 @@ func IsValidImageName(image string) bool {
 }
 
 // 检查 Cluster 中是否存在配置文件
-func (r *ClusterOperationReconciler) CheckClusterDataRef(cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+func (r *ClusterOperationReconciler) CheckClusterDataRef(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
 	// 判断是否文件是否在同一个 namespace 内
 	namespaceSet := map[string]struct{}{}
 	if clusterOps.Spec.HostsConfRef.IsEmpty() {
@@ -233,7 +536,7 @@ func (r *ClusterOperationReconciler) CheckClusterDataRef(cluster *kubeonkubev1al
 		if hostsConfRef.IsEmpty() {
 			return fmt.Errorf("Cluster %s hostsConfRef is empty", cluster.Name)
 		}
-		if !r.CheckConfigMapExist(hostsConfRef.NameSpace, hostsConfRef.Name) {
+		if !r.CheckConfigMapExist(ctx, hostsConfRef.NameSpace, hostsConfRef.Name) {
 			return fmt.Errorf("Cluster %s hostsConfRef %s,%s not found", cluster.Name, hostsConfRef.NameSpace, hostsConfRef.Name)
 		}
 		namespaceSet[hostsConfRef.NameSpace] = struct{}{}
@@ -243,7 +546,7 @@ func (r *ClusterOperationReconciler) CheckClusterDataRef(cluster *kubeonkubev1al
 		if varsConfRef.IsEmpty() {
 			return fmt.Errorf("Cluster %s varsConfRef is empty", cluster.Name)
 		}
-		if !r.CheckConfigMapExist(varsConfRef.NameSpace, varsConfRef.Name) {
+		if !r.CheckConfigMapExist(ctx, varsConfRef.NameSpace, varsConfRef.Name) {
 			return fmt.Errorf("Cluster %s varsConfRef %s,%s not found", cluster.Name, varsConfRef.NameSpace, varsConfRef.Name)
 		}
 		namespaceSet[varsConfRef.NameSpace] = struct{}{}
@@ -251,32 +554,46 @@ func (r *ClusterOperationReconciler) CheckClusterDataRef(cluster *kubeonkubev1al
 	if clusterOps.Spec.SSHAuthRef.IsEmpty() && !cluster.Spec.SSHAuthRef.IsEmpty() {
 		// check SSHAuthRef optionally.
 		sshAuthRef := cluster.Spec.SSHAuthRef
-		if !r.CheckSecretExist(sshAuthRef.NameSpace, sshAuthRef.Name) {
+		if !r.CheckSecretExist(ctx, sshAuthRef.NameSpace, sshAuthRef.Name) {
 			return fmt.Errorf("Cluster %s sshAuthRef %s,%s not found", cluster.Name, sshAuthRef.NameSpace, sshAuthRef.Name)
 		}
 		namespaceSet[sshAuthRef.NameSpace] = struct{}{}
 	}
+	if clusterOps.Spec.SecretVarsRef.IsEmpty() && !cluster.Spec.SecretVarsRef.IsEmpty() {
+		secretVarsRef := cluster.Spec.SecretVarsRef
+		if !r.CheckSecretExist(ctx, secretVarsRef.NameSpace, secretVarsRef.Name) {
+			return fmt.Errorf("Cluster %s secretVarsRef %s,%s not found", cluster.Name, secretVarsRef.NameSpace, secretVarsRef.Name)
+		}
+		namespaceSet[secretVarsRef.NameSpace] = struct{}{}
+	}
+	if clusterOps.Spec.VaultPasswordRef.IsEmpty() && !cluster.Spec.VaultPasswordRef.IsEmpty() {
+		vaultPasswordRef := cluster.Spec.VaultPasswordRef
+		if !r.CheckSecretExist(ctx, vaultPasswordRef.NameSpace, vaultPasswordRef.Name) {
+			return fmt.Errorf("Cluster %s vaultPasswordRef %s,%s not found", cluster.Name, vaultPasswordRef.NameSpace, vaultPasswordRef.Name)
+		}
+		namespaceSet[vaultPasswordRef.NameSpace] = struct{}{}
+	}
 	if len(namespaceSet) > 1 {
-		return fmt.Errorf("Cluster %s hostsConfRef varsConfRef or sshAuthRef not in the same namespace", cluster.Name)
+		return fmt.Errorf("Cluster %s hostsConfRef varsConfRef sshAuthRef secretVarsRef or vaultPasswordRef not in the same namespace", cluster.Name)
 	}
 	return nil
 }
 
-func (r *ClusterOperationReconciler) CheckConfigMapExist(namespace, name string) bool {
-	if _, err := r.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.Background(), name, metav1.GetOptions{}); err != nil && apierrors.IsNotFound(err) {
+func (r *ClusterOperationReconciler) CheckConfigMapExist(ctx context.Context, namespace, name string) bool {
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &corev1.ConfigMap{}); err != nil && apierrors.IsNotFound(err) {
 		return false
 	}
 	return true
 }
 
-func (r *ClusterOperationReconciler) CheckSecretExist(namespace, name string) bool {
-	if _, err := r.ClientSet.CoreV1().Secrets(namespace).Get(context.Background(), name, metav1.GetOptions{}); err != nil && apierrors.IsNotFound(err) {
+func (r *ClusterOperationReconciler) CheckSecretExist(ctx context.Context, namespace, name string) bool {
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &corev1.Secret{}); err != nil && apierrors.IsNotFound(err) {
 		return false
 	}
 	return true
 }
 
-func (r *ClusterOperationReconciler) UpdateOperationOwnReferenceForCluster(cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+func (r *ClusterOperationReconciler) UpdateOperationOwnReferenceForCluster(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
 	for i := range clusterOps.OwnerReferences {
 		// 已经设置过了
 		if clusterOps.OwnerReferences[i].UID == cluster.UID {
@@ -284,20 +601,20 @@ func (r *ClusterOperationReconciler) UpdateOperationOwnReferenceForCluster(clust
 		}
 	}
 	clusterOps.OwnerReferences = append(clusterOps.OwnerReferences, *metav1.NewControllerRef(cluster, kubeonkubev1alpha1.SchemeGroupVersion.WithKind("Cluster")))
-	if err := r.Client.Update(context.Background(), clusterOps); err != nil {
+	if err := r.Client.Update(ctx, clusterOps); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func (r *ClusterOperationReconciler) UpdateClusterOpsStatusDigest(clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+func (r *ClusterOperationReconciler) UpdateClusterOpsStatusDigest(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
 	if len(clusterOps.Status.Digest) != 0 {
 		// 已经设置过了
 		return false, nil
 	}
 	// 初始化赋值
 	clusterOps.Status.Digest = r.CalSalt(clusterOps)
-	if err := r.Client.Status().Update(context.Background(), clusterOps); err != nil {
+	if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -318,10 +635,59 @@ func (r *ClusterOperationReconciler) CalSalt(clusterOps *kubeonkubev1alpha1.Clus
 		summaryStr += string(action.ActionType)
 		summaryStr += strings.TrimSpace(action.Action)
 	}
+	// 只在设置时追加，未使用这些字段的 ClusterOps 的 digest 与之前相同
+	if extra := saltExtra(&clusterOps.Spec); len(extra) > 0 {
+		summaryStr += extra
+	}
 	return fmt.Sprintf("%x", md5.Sum([]byte(summaryStr)))
 }
 
-func (r *ClusterOperationReconciler) UpdateStatusHasModified(clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+// saltSpec holds the fields of the spec which change what the runner does besides the actions and the image.
+type saltSpec struct {
+	PlaybookOptions []kubeonkubev1alpha1.PlaybookOptions `json:"playbookOptions,omitempty"`
+	ExtraVars       map[string]apiextensionsv1.JSON      `json:"extraVars,omitempty"`
+	ExtraVarsFrom   []kubeonkubev1alpha1.ExtraVarsSource `json:"extraVarsFrom,omitempty"`
+	Runner          *kubeonkubev1alpha1.RunnerPodSpec    `json:"runner,omitempty"`
+	Volumes         []kubeonkubev1alpha1.RunnerVolume    `json:"volumes,omitempty"`
+	VolumeMounts    []corev1.VolumeMount                 `json:"volumeMounts,omitempty"`
+}
+
+// saltExtra serializes the typed playbook args of the action and the hooks, the extra vars, the runner and the volumes,
+// it is empty when none of them is set. The backups filled by the operator are left out.
+func saltExtra(spec *kubeonkubev1alpha1.ClusterOperationSpec) string {
+	salt := saltSpec{
+		ExtraVars:     spec.ExtraVars,
+		ExtraVarsFrom: spec.ExtraVarsFrom,
+		Runner:        spec.Runner,
+		VolumeMounts:  spec.VolumeMounts,
+	}
+	options := []kubeonkubev1alpha1.PlaybookOptions{spec.PlaybookOptions}
+	for _, hooks := range [][]kubeonkubev1alpha1.HookAction{spec.PreHook, spec.PostHook} {
+		for _, hook := range hooks {
+			options = append(options, hook.PlaybookOptions)
+		}
+	}
+	for _, option := range options {
+		if !reflect.DeepEqual(option, kubeonkubev1alpha1.PlaybookOptions{}) {
+			salt.PlaybookOptions = options
+			break
+		}
+	}
+	for _, volume := range spec.Volumes {
+		volume.BackupRef = nil
+		salt.Volumes = append(salt.Volumes, volume)
+	}
+	if reflect.DeepEqual(salt, saltSpec{}) {
+		return ""
+	}
+	data, err := json.Marshal(salt)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (r *ClusterOperationReconciler) UpdateStatusHasModified(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
 	if len(clusterOps.Status.Digest) == 0 {
 		return false, nil
 	}
@@ -332,7 +698,7 @@ func (r *ClusterOperationReconciler) UpdateStatusHasModified(clusterOps *kubeonk
 	if same := r.compareDigest(clusterOps); !same {
 		// 不同，则更新状态
 		clusterOps.Status.HasModified = true
-		if err := r.Client.Status().Update(context.Background(), clusterOps); err != nil {
+		if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
 			return false, err
 		}
 		klog.Warningf("clusterOps %s Spec has been modified", clusterOps.Name)
@@ -341,12 +707,39 @@ func (r *ClusterOperationReconciler) UpdateStatusHasModified(clusterOps *kubeonk
 	return false, nil
 }
 
+// UpdateStatusApproval records the approver on status, or sets the status AwaitingApproval until it is approved.
+// It reports whether the ClusterOperation has to wait.
+func (r *ClusterOperationReconciler) UpdateStatusApproval(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+	approver := util.ApprovedBy(clusterOps.Annotations, clusterOps.Spec.Approved)
+	if len(approver) == 0 {
+		if clusterOps.Status.Status == kubeonkubev1alpha1.AwaitingApprovalStatus {
+			return true, nil
+		}
+		clusterOps.Status.Status = kubeonkubev1alpha1.AwaitingApprovalStatus
+		klog.Infof("clusterOps %s is awaiting approval", clusterOps.Name)
+		return true, r.Client.Status().Update(ctx, clusterOps)
+	}
+	if clusterOps.Status.ApprovedBy == approver {
+		return false, nil
+	}
+	if clusterOps.Status.Status == kubeonkubev1alpha1.AwaitingApprovalStatus {
+		clusterOps.Status.Status = ""
+	}
+	clusterOps.Status.ApprovedBy = approver
+	clusterOps.Status.ApprovedTime = &metav1.Time{Time: time.Now()}
+	klog.Infof("clusterOps %s is approved by %s", clusterOps.Name, approver)
+	if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
 func (r *ClusterOperationReconciler) compareDigest(clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
 	return clusterOps.Status.Digest == r.CalSalt(clusterOps)
 }
 
 // 执行配置文件的备份，浅拷贝，去使用
-func (r *ClusterOperationReconciler) BackUpDataRef(clusterOps *kubeonkubev1alpha1.ClusterOperation, cluster *kubeonkubev1alpha1.Cluster) (bool, error) {
+func (r *ClusterOperationReconciler) BackUpDataRef(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, cluster *kubeonkubev1alpha1.Cluster) (bool, error) {
 	timestamp := fmt.Sprintf("-%d", time.Now().UnixMilli())
 	if cluster.Spec.HostsConfRef.IsEmpty() || cluster.Spec.VarsConfRef.IsEmpty() {
 		return false, fmt.Errorf("cluster %s DataRef has empty value", cluster.Name)
@@ -356,9 +749,9 @@ func (r *ClusterOperationReconciler) BackUpDataRef(clusterOps *kubeonkubev1alpha
 	} else {
 		clusterOps.Labels[ClusterLabelKey] = cluster.Name
 	}
-	currentNS := util.GetCurrentNSOrDefault()
+	currentNS := r.OperationsNamespace(clusterOps)
 	if clusterOps.Spec.HostsConfRef.IsEmpty() {
-		newConfigMap, err := r.CopyConfigMap(clusterOps, cluster.Spec.HostsConfRef, cluster.Spec.HostsConfRef.Name+timestamp, currentNS)
+		newConfigMap, err := r.CopyConfigMap(ctx, clusterOps, cluster.Spec.HostsConfRef, cluster.Spec.HostsConfRef.Name+timestamp, currentNS)
 		if err != nil {
 			return false, err
 		}
@@ -366,13 +759,13 @@ func (r *ClusterOperationReconciler) BackUpDataRef(clusterOps *kubeonkubev1alpha
 			NameSpace: newConfigMap.Namespace,
 			Name:      newConfigMap.Name,
 		}
-		if err := r.Client.Update(context.Background(), clusterOps); err != nil {
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
 			return false, err
 		}
 		return true, nil
 	}
 	if clusterOps.Spec.VarsConfRef.IsEmpty() {
-		newConfigMap, err := r.CopyConfigMap(clusterOps, cluster.Spec.VarsConfRef, cluster.Spec.VarsConfRef.Name+timestamp, currentNS)
+		newConfigMap, err := r.CopyConfigMap(ctx, clusterOps, cluster.Spec.VarsConfRef, cluster.Spec.VarsConfRef.Name+timestamp, currentNS)
 		if err != nil {
 			return false, err
 		}
@@ -380,14 +773,14 @@ func (r *ClusterOperationReconciler) BackUpDataRef(clusterOps *kubeonkubev1alpha
 			NameSpace: newConfigMap.Namespace,
 			Name:      newConfigMap.Name,
 		}
-		if err := r.Client.Update(context.Background(), clusterOps); err != nil {
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
 			return false, err
 		}
 		return true, nil
 	}
 	if clusterOps.Spec.SSHAuthRef.IsEmpty() && !cluster.Spec.SSHAuthRef.IsEmpty() {
 		// clusterOps backups ssh data when cluster has ssh data.
-		newSecret, err := r.CopySecret(clusterOps, cluster.Spec.SSHAuthRef, cluster.Spec.SSHAuthRef.Name+timestamp, currentNS)
+		newSecret, err := r.CopySecret(ctx, clusterOps, cluster.Spec.SSHAuthRef, cluster.Spec.SSHAuthRef.Name+timestamp, currentNS)
 		if err != nil {
 			return false, err
 		}
@@ -395,7 +788,36 @@ func (r *ClusterOperationReconciler) BackUpDataRef(clusterOps *kubeonkubev1alpha
 			NameSpace: newSecret.Namespace,
 			Name:      newSecret.Name,
 		}
-		if err := r.Client.Update(context.Background(), clusterOps); err != nil {
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if clusterOps.Spec.SecretVarsRef.IsEmpty() && !cluster.Spec.SecretVarsRef.IsEmpty() {
+		// the secret vars are backed up as a Secret, never as a ConfigMap.
+		newSecret, err := r.CopySecret(ctx, clusterOps, cluster.Spec.SecretVarsRef, cluster.Spec.SecretVarsRef.Name+timestamp, currentNS)
+		if err != nil {
+			return false, err
+		}
+		clusterOps.Spec.SecretVarsRef = &api.SecretRef{
+			NameSpace: newSecret.Namespace,
+			Name:      newSecret.Name,
+		}
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if clusterOps.Spec.VaultPasswordRef.IsEmpty() && !cluster.Spec.VaultPasswordRef.IsEmpty() {
+		newSecret, err := r.CopySecret(ctx, clusterOps, cluster.Spec.VaultPasswordRef, cluster.Spec.VaultPasswordRef.Name+timestamp, currentNS)
+		if err != nil {
+			return false, err
+		}
+		clusterOps.Spec.VaultPasswordRef = &api.SecretRef{
+			NameSpace: newSecret.Namespace,
+			Name:      newSecret.Name,
+		}
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
 			return false, err
 		}
 		return true, nil
@@ -404,9 +826,9 @@ func (r *ClusterOperationReconciler) BackUpDataRef(clusterOps *kubeonkubev1alpha
 }
 
 // 拷贝配置文件
-func (r *ClusterOperationReconciler) CopyConfigMap(clusterOps *kubeonkubev1alpha1.ClusterOperation, oldConfigMapRef *api.ConfigMapRef, newName, newNamespace string) (*corev1.ConfigMap, error) {
-	oldConfigMap, err := r.ClientSet.CoreV1().ConfigMaps(oldConfigMapRef.NameSpace).Get(context.Background(), oldConfigMapRef.Name, metav1.GetOptions{})
-	if err != nil {
+func (r *ClusterOperationReconciler) CopyConfigMap(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, oldConfigMapRef *api.ConfigMapRef, newName, newNamespace string) (*corev1.ConfigMap, error) {
+	oldConfigMap := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: oldConfigMapRef.NameSpace, Name: oldConfigMapRef.Name}, oldConfigMap); err != nil {
 		return nil, err
 	}
 	namespace := oldConfigMapRef.NameSpace
@@ -425,17 +847,16 @@ func (r *ClusterOperationReconciler) CopyConfigMap(clusterOps *kubeonkubev1alpha
 		Data: oldConfigMap.Data,
 	}
 	r.SetOwnerReferences(&newConfigMap.ObjectMeta, clusterOps)
-	newConfigMap, err = r.ClientSet.CoreV1().ConfigMaps(newConfigMap.Namespace).Create(context.Background(), newConfigMap, metav1.CreateOptions{})
-	if err != nil {
+	if err := r.Client.Create(ctx, newConfigMap); err != nil {
 		return nil, err
 	}
 	return newConfigMap, nil
 }
 
 // 拷贝 Secret
-func (r *ClusterOperationReconciler) CopySecret(clusterOps *kubeonkubev1alpha1.ClusterOperation, oldSecretRef *api.SecretRef, newName, newNamespace string) (*corev1.Secret, error) {
-	oldSecret, err := r.ClientSet.CoreV1().Secrets(oldSecretRef.NameSpace).Get(context.Background(), oldSecretRef.Name, metav1.GetOptions{})
-	if err != nil {
+func (r *ClusterOperationReconciler) CopySecret(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, oldSecretRef *api.SecretRef, newName, newNamespace string) (*corev1.Secret, error) {
+	oldSecret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: oldSecretRef.NameSpace, Name: oldSecretRef.Name}, oldSecret); err != nil {
 		return nil, err
 	}
 	namespace := oldSecretRef.NameSpace
@@ -454,8 +875,7 @@ func (r *ClusterOperationReconciler) CopySecret(clusterOps *kubeonkubev1alpha1.C
 		Data: oldSecret.Data,
 	}
 	r.SetOwnerReferences(&newSecret.ObjectMeta, clusterOps)
-	newSecret, err = r.ClientSet.CoreV1().Secrets(newSecret.Namespace).Create(context.Background(), newSecret, metav1.CreateOptions{})
-	if err != nil {
+	if err := r.Client.Create(ctx, newSecret); err != nil {
 		return nil, err
 	}
 	return newSecret, nil
@@ -466,26 +886,94 @@ func (r *ClusterOperationReconciler) SetOwnerReferences(objectMetaData *metav1.O
 }
 
 // CreateEntryPointShellConfigMap create configMap to store entrypoint.sh.
-func (r *ClusterOperationReconciler) CreateEntryPointShellConfigMap(clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+func (r *ClusterOperationReconciler) CreateEntryPointShellConfigMap(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
 	if !clusterOps.Spec.EntrypointSHRef.IsEmpty() {
 		return false, nil
 	}
+	if err := r.CheckLimit(ctx, clusterOps); err != nil {
+		return false, err
+	}
+	entryPointData, err := NewEntryPoint(clusterOps)
+	if err != nil {
+		return false, err
+	}
+	return r.applyEntryPointShellConfigMap(ctx, clusterOps, entryPointData)
+}
+
+// NewPlaybookArgs converts the typed options and the extra args of an action for the entrypoint.
+func NewPlaybookArgs(options kubeonkubev1alpha1.PlaybookOptions, extraArgs string) entrypoint.PlaybookArgs {
+	return entrypoint.PlaybookArgs{
+		Tags:      options.Tags,
+		SkipTags:  options.SkipTags,
+		Limit:     options.Limit,
+		Verbosity: options.Verbosity,
+		Forks:     options.Forks,
+		ExtraArgs: extraArgs,
+	}
+}
+
+// CheckLimit makes sure the limits of the action and the hooks are hosts of the inventory, unknown ones are wrong args.
+func (r *ClusterOperationReconciler) CheckLimit(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	nodes := append([]string{}, clusterOps.Spec.Limit...)
+	for _, action := range append(append([]kubeonkubev1alpha1.HookAction{}, clusterOps.Spec.PreHook...), clusterOps.Spec.PostHook...) {
+		nodes = append(nodes, action.Limit...)
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	hostsConf := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: clusterOps.Spec.HostsConfRef.NameSpace, Name: clusterOps.Spec.HostsConfRef.Name}, hostsConf); err != nil {
+		return err
+	}
+	if err := inventory.CheckHosts(hostsConf.Data[inventory.HostsKey], nodes); err != nil {
+		return entrypoint.NewArgsError(fmt.Sprintf("limit: %s", err))
+	}
+	return nil
+}
+
+// NewEntryPoint builds the entrypoint.sh of the ClusterOperation, a dry run only checks the action.
+func NewEntryPoint(clusterOps *kubeonkubev1alpha1.ClusterOperation) (*entrypoint.EntryPoint, error) {
 	entryPointData := entrypoint.NewEntryPoint()
+	if !clusterOps.Spec.VaultPasswordRef.IsEmpty() {
+		entryPointData.VaultPasswordFile = entrypoint.VaultPasswordPath
+	}
+	if !clusterOps.Spec.SecretVarsRef.IsEmpty() {
+		entryPointData.SecretVarsFile = entrypoint.SecretVarsPath
+	}
+	if !clusterOps.Spec.ExtraVarsRef.IsEmpty() {
+		entryPointData.ExtraVarsFile = entrypoint.ExtraVarsPath
+	}
 	isPrivateKey := !clusterOps.Spec.SSHAuthRef.IsEmpty()
 	builtinActionSource := kubeonkubev1alpha1.BuiltinActionSource
+	if clusterOps.Spec.DryRun {
+		// the hooks may change the hosts, a dry run only checks the action
+		if err := entryPointData.SprayCheckRunPart(string(clusterOps.Spec.ActionType), clusterOps.Spec.Action, NewPlaybookArgs(clusterOps.Spec.PlaybookOptions, clusterOps.Spec.ExtraArgs), isPrivateKey, clusterOps.Spec.ActionSource == nil || *clusterOps.Spec.ActionSource == builtinActionSource); err != nil {
+			return nil, err
+		}
+		return entryPointData, nil
+	}
 	for _, action := range clusterOps.Spec.PreHook {
-		if err := entryPointData.PreHookRunPart(string(action.ActionType), action.Action, action.ExtraArgs, isPrivateKey, action.ActionSource == nil || *action.ActionSource == builtinActionSource); err != nil {
-			return false, err
+		if err := entryPointData.PreHookRunPart(string(action.ActionType), action.Action, NewPlaybookArgs(action.PlaybookOptions, action.ExtraArgs), isPrivateKey, action.ActionSource == nil || *action.ActionSource == builtinActionSource); err != nil {
+			return nil, err
 		}
 	}
-	if err := entryPointData.SprayRunPart(string(clusterOps.Spec.ActionType), clusterOps.Spec.Action, clusterOps.Spec.ExtraArgs, isPrivateKey, clusterOps.Spec.ActionSource == nil || *clusterOps.Spec.ActionSource == builtinActionSource); err != nil {
-		return false, err
+	if err := entryPointData.SprayRunPart(string(clusterOps.Spec.ActionType), clusterOps.Spec.Action, NewPlaybookArgs(clusterOps.Spec.PlaybookOptions, clusterOps.Spec.ExtraArgs), isPrivateKey, clusterOps.Spec.ActionSource == nil || *clusterOps.Spec.ActionSource == builtinActionSource); err != nil {
+		return nil, err
 	}
 	for _, action := range clusterOps.Spec.PostHook {
-		if err := entryPointData.PostHookRunPart(string(action.ActionType), action.Action, action.ExtraArgs, isPrivateKey, action.ActionSource == nil || *action.ActionSource == builtinActionSource); err != nil {
-			return false, err
+		if err := entryPointData.PostHookRunPart(string(action.ActionType), action.Action, NewPlaybookArgs(action.PlaybookOptions, action.ExtraArgs), isPrivateKey, action.ActionSource == nil || *action.ActionSource == builtinActionSource); err != nil {
+			return nil, err
 		}
 	}
+	return entryPointData, nil
+}
+
+// EntrypointConfigMapName is the ConfigMap holding the entrypoint.sh of the ClusterOperation.
+func EntrypointConfigMapName(clusterOps *kubeonkubev1alpha1.ClusterOperation) string {
+	return fmt.Sprintf("%s-entrypoint", clusterOps.Name)
+}
+
+func (r *ClusterOperationReconciler) applyEntryPointShellConfigMap(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, entryPointData *entrypoint.EntryPoint) (bool, error) {
 	configMapData, err := entryPointData.Render()
 	if err != nil {
 		return false, err
@@ -497,17 +985,17 @@ func (r *ClusterOperationReconciler) CreateEntryPointShellConfigMap(clusterOps *
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-entrypoint", clusterOps.Name),
-			Namespace: util.GetCurrentNSOrDefault(),
+			Name:      EntrypointConfigMapName(clusterOps),
+			Namespace: r.OperationsNamespace(clusterOps),
 		},
 		Data: map[string]string{"entrypoint.sh": strings.TrimSpace(configMapData)},
 	}
 	r.SetOwnerReferences(&newConfigMap.ObjectMeta, clusterOps)
-	_, err = r.ClientSet.CoreV1().ConfigMaps(newConfigMap.Namespace).Create(context.Background(), newConfigMap, metav1.CreateOptions{})
+	err = r.Client.Create(ctx, newConfigMap)
 	if apierrors.IsAlreadyExists(err) {
 		// exist and update
 		klog.Warningf("entrypoint configmap %s already exist and update it.", newConfigMap.Name)
-		if _, err := r.ClientSet.CoreV1().ConfigMaps(newConfigMap.Namespace).Update(context.Background(), newConfigMap, metav1.UpdateOptions{}); err != nil {
+		if err := r.Client.Update(ctx, newConfigMap); err != nil {
 			return false, err
 		}
 	} else if err != nil {
@@ -517,37 +1005,21 @@ func (r *ClusterOperationReconciler) CreateEntryPointShellConfigMap(clusterOps *
 		NameSpace: newConfigMap.Namespace,
 		Name:      newConfigMap.Name,
 	}
-	if err := r.Client.Update(context.Background(), clusterOps); err != nil {
+	if err := r.Client.Update(ctx, clusterOps); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func (r *ClusterOperationReconciler) CreateKubeSprayJob(clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+func (r *ClusterOperationReconciler) CreateKubeSprayJob(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, cluster *kubeonkubev1alpha1.Cluster) (bool, error) {
 	if !clusterOps.Status.JobRef.IsEmpty() {
 		return false, nil
 	}
-	jobName := r.GenerateJobName(clusterOps)
-	namespace := clusterOps.Spec.HostsConfRef.NameSpace
-	job, err := r.ClientSet.BatchV1().Jobs(namespace).Get(context.Background(), jobName, metav1.GetOptions{})
-	if err != nil {
-		if apierrors.IsNotFound(err) {
-			// the job doest not exist , and will create the job.
-			// sa, err := r.GetServiceAccountName(util.GetCurrentNSOrDefault(), ServiceAccount)
-			// if err != nil {
-			// 	return false, err
-			// }
-			klog.Warningf("create job %s for kubeonkubeClusterOp %s", jobName, clusterOps.Name)
-			job = r.NewKubesprayJob(clusterOps)
-			r.SetOwnerReferences(&job.ObjectMeta, clusterOps)
-			job, err = r.ClientSet.BatchV1().Jobs(job.Namespace).Create(context.Background(), job, metav1.CreateOptions{})
-			if err != nil {
-				return false, err
-			}
-		} else {
-			klog.Error(err)
-			return false, err
-		}
+	job := r.NewKubesprayJob(clusterOps, cluster)
+	r.SetOwnerReferences(&job.ObjectMeta, clusterOps)
+	if err := r.runner().Start(ctx, clusterOps, job); err != nil {
+		klog.Error(err)
+		return false, err
 	}
 	clusterOps.Status.JobRef = &api.JobRef{
 		NameSpace: job.Namespace,
@@ -555,36 +1027,58 @@ func (r *ClusterOperationReconciler) CreateKubeSprayJob(clusterOps *kubeonkubev1
 	}
 	clusterOps.Status.StartTime = &metav1.Time{Time: time.Now()}
 	clusterOps.Status.Status = kubeonkubev1alpha1.RunningStatus
+	clusterOps.Status.QueuePosition = 0
 	clusterOps.Status.Action = clusterOps.Spec.Action
+	clusterOps.Status.DryRun = clusterOps.Spec.DryRun
+	clusterOps.Status.UncheckedHooks = nil
+	if clusterOps.Spec.DryRun {
+		// the dry run only checks the action, the hooks run for the first time after the promotion
+		for _, hook := range append(append([]kubeonkubev1alpha1.HookAction{}, clusterOps.Spec.PreHook...), clusterOps.Spec.PostHook...) {
+			clusterOps.Status.UncheckedHooks = append(clusterOps.Status.UncheckedHooks, hook.Action)
+		}
+	}
 
-	if err := r.Client.Status().Update(context.Background(), clusterOps); err != nil {
+	if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+// runner returns the Runner of the reconciler, the Job runner by default.
+func (r *ClusterOperationReconciler) runner() Runner {
+	if r.Runner != nil {
+		return r.Runner
+	}
+	return &JobRunner{Client: r.Client}
+}
+
 func (r *ClusterOperationReconciler) GenerateJobName(clusterOps *kubeonkubev1alpha1.ClusterOperation) string {
 	return fmt.Sprintf("kubeonkube-%s-job", clusterOps.Name)
 }
 
 // GetServiceAccountName get serviceaccount name on kubeonkube namespace by labelSelector.
-func (r *ClusterOperationReconciler) GetServiceAccountName(namespace, labelSelector string) (string, error) {
-	serviceAccounts, err := r.ClientSet.CoreV1().ServiceAccounts(namespace).List(context.Background(), metav1.ListOptions{LabelSelector: labelSelector})
+func (r *ClusterOperationReconciler) GetServiceAccountName(ctx context.Context, namespace, labelSelector string) (string, error) {
+	selector, err := labels.Parse(labelSelector)
 	if err != nil {
 		return "", err
 	}
+	serviceAccounts := &corev1.ServiceAccountList{}
+	if err := r.Client.List(ctx, serviceAccounts, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return "", err
+	}
 	if len(serviceAccounts.Items) <= 0 {
 		return "", fmt.Errorf("%s no valild serviceaccount", namespace)
 	}
 	return serviceAccounts.Items[0].Name, nil
 }
 
-func (r *ClusterOperationReconciler) NewKubesprayJob(clusterOps *kubeonkubev1alpha1.ClusterOperation) *batchv1.Job {
+func (r *ClusterOperationReconciler) NewKubesprayJob(clusterOps *kubeonkubev1alpha1.ClusterOperation, cluster *kubeonkubev1alpha1.Cluster) *batchv1.Job {
 	BackoffLimit := int32(0)
 	DefaultMode := int32(0o700)
 	PrivatekeyMode := int32(0o400)
+	cfg := r.Config.Get()
 	jobName := r.GenerateJobName(clusterOps)
-	namespace := util.GetCurrentNSOrDefault()
+	namespace := r.OperationsNamespace(clusterOps)
 	job := &batchv1.Job{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "batch/v1",
@@ -603,11 +1097,11 @@ func (r *ClusterOperationReconciler) NewKubesprayJob(clusterOps *kubeonkubev1alp
 					Containers: []corev1.Container{
 						{
 							Name:    SprayJobPodName,
-							Image:   clusterOps.Spec.Image,
+							Image:   cfg.MirrorImage(clusterOps.Spec.Image),
 							Command: []string{"/bin/entrypoint.sh"},
 							Env: []corev1.EnvVar{
 								{
-									Name:  "CLUSTER_NAME",
+									Name:  ClusterNameEnv,
 									Value: clusterOps.Spec.Cluster,
 								},
 							},
@@ -622,11 +1116,13 @@ func (r *ClusterOperationReconciler) NewKubesprayJob(clusterOps *kubeonkubev1alp
 									Name:      "hosts-conf",
 									MountPath: "/conf/hosts.yml",
 									SubPath:   "hosts.yml",
+									ReadOnly:  true,
 								},
 								{
 									Name:      "vars-conf",
 									MountPath: "/conf/group_vars.yml",
 									SubPath:   "group_vars.yml",
+									ReadOnly:  true,
 								},
 							},
 						},
@@ -690,21 +1186,94 @@ func (r *ClusterOperationReconciler) NewKubesprayJob(clusterOps *kubeonkubev1alp
 				},
 			})
 	}
+	if !clusterOps.Spec.VaultPasswordRef.IsEmpty() {
+		if len(job.Spec.Template.Spec.Containers) > 0 && job.Spec.Template.Spec.Containers[0].Name == SprayJobPodName {
+			job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts,
+				corev1.VolumeMount{
+					Name:      "vault-password",
+					MountPath: entrypoint.VaultPasswordPath,
+					SubPath:   VaultPasswordKey,
+					ReadOnly:  true,
+				})
+		}
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes,
+			corev1.Volume{
+				Name: "vault-password",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName:  clusterOps.Spec.VaultPasswordRef.Name,
+						DefaultMode: &PrivatekeyMode,
+					},
+				},
+			})
+	}
+	if !clusterOps.Spec.SecretVarsRef.IsEmpty() {
+		if len(job.Spec.Template.Spec.Containers) > 0 && job.Spec.Template.Spec.Containers[0].Name == SprayJobPodName {
+			job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts,
+				corev1.VolumeMount{
+					Name:      "secret-vars",
+					MountPath: entrypoint.SecretVarsPath,
+					SubPath:   SecretVarsKey,
+					ReadOnly:  true,
+				})
+		}
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes,
+			corev1.Volume{
+				Name: "secret-vars",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: clusterOps.Spec.SecretVarsRef.Name,
+					},
+				},
+			})
+	}
+	if !clusterOps.Spec.ExtraVarsRef.IsEmpty() {
+		if len(job.Spec.Template.Spec.Containers) > 0 && job.Spec.Template.Spec.Containers[0].Name == SprayJobPodName {
+			job.Spec.Template.Spec.Containers[0].VolumeMounts = append(job.Spec.Template.Spec.Containers[0].VolumeMounts,
+				corev1.VolumeMount{
+					Name:      "extra-vars",
+					MountPath: entrypoint.ExtraVarsPath,
+					SubPath:   ExtraVarsKey,
+					ReadOnly:  true,
+				})
+		}
+		job.Spec.Template.Spec.Volumes = append(job.Spec.Template.Spec.Volumes,
+			corev1.Volume{
+				Name: "extra-vars",
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: clusterOps.Spec.ExtraVarsRef.Name,
+					},
+				},
+			})
+	}
+	runner := RunnerPodSpecFor(cluster, clusterOps)
+	applyRunnerBackup(&runner, clusterOps.Spec.RunnerBackup)
+	applyRunnerPodSpec(&job.Spec.Template.Spec, runner)
+	applyRunnerVolumes(&job.Spec.Template.Spec, clusterOps)
+	applyRunnerSecurity(&job.Spec.Template.Spec, cfg.SecurityProfile(clusterOps.Spec.Image))
 	if clusterOps.Spec.ActiveDeadlineSeconds != nil && *clusterOps.Spec.ActiveDeadlineSeconds > 0 {
 		job.Spec.ActiveDeadlineSeconds = clusterOps.Spec.ActiveDeadlineSeconds
+	} else if cfg.Timeouts.ActiveDeadline.Duration > 0 {
+		activeDeadlineSeconds := int64(cfg.Timeouts.ActiveDeadline.Seconds())
+		job.Spec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	}
+	resources := clusterOps.Spec.Resources
+	if reflect.ValueOf(resources).IsZero() {
+		resources = *cfg.DefaultResources.DeepCopy()
 	}
-	if !reflect.ValueOf(clusterOps.Spec.Resources).IsZero() {
+	if !reflect.ValueOf(resources).IsZero() {
 		if len(job.Spec.Template.Spec.Containers) > 0 && job.Spec.Template.Spec.Containers[0].Name == SprayJobPodName {
-			job.Spec.Template.Spec.Containers[0].Resources = clusterOps.Spec.Resources
+			job.Spec.Template.Spec.Containers[0].Resources = resources
 		}
 	}
 	return job
 }
 
-func (r *ClusterOperationReconciler) UpdateStatusLoop(clusterOps *kubeonkubev1alpha1.ClusterOperation, fetchJobStatus func(*kubeonkubev1alpha1.ClusterOperation) (kubeonkubev1alpha1.OpsStatus, *metav1.Time, error)) (bool, error) {
+func (r *ClusterOperationReconciler) UpdateStatusLoop(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, fetchJobStatus func(context.Context, *kubeonkubev1alpha1.ClusterOperation) (kubeonkubev1alpha1.OpsStatus, *metav1.Time, error)) (bool, error) {
 	if clusterOps.Status.Status == kubeonkubev1alpha1.RunningStatus || len(clusterOps.Status.Status) == 0 {
 		// need fetch jobStatus again when the last status of job is running
-		jobStatus, completionTime, err := fetchJobStatus(clusterOps)
+		jobStatus, completionTime, err := fetchJobStatus(ctx, clusterOps)
 		if err != nil {
 			return false, err
 		}
@@ -718,7 +1287,7 @@ func (r *ClusterOperationReconciler) UpdateStatusLoop(clusterOps *kubeonkubev1al
 		if completionTime != nil {
 			clusterOps.Status.EndTime = completionTime
 		}
-		if err := r.Client.Status().Update(context.Background(), clusterOps); err != nil {
+		if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
 			return false, err
 		}
 		return false, nil
@@ -727,39 +1296,7 @@ func (r *ClusterOperationReconciler) UpdateStatusLoop(clusterOps *kubeonkubev1al
 	return false, nil
 }
 
-func (r *ClusterOperationReconciler) FetchJobConditionStatusAndCompletionTime(clusterOps *kubeonkubev1alpha1.ClusterOperation) (kubeonkubev1alpha1.OpsStatus, *metav1.Time, error) {
-	if clusterOps.Status.JobRef.IsEmpty() {
-		return "", nil, fmt.Errorf("clusterOps %s no job", clusterOps.Name)
-	}
-	targetJob, err := r.ClientSet.BatchV1().Jobs(clusterOps.Status.JobRef.NameSpace).Get(context.Background(), clusterOps.Status.JobRef.Name, metav1.GetOptions{})
-	if apierrors.IsNotFound(err) {
-		// maybe the job is removed.
-		klog.Errorf("clusterOps %s  job %s not found", clusterOps.Name, clusterOps.Status.JobRef.Name)
-		return kubeonkubev1alpha1.FailedStatus, nil, nil
-	}
-	if err != nil {
-		return "", nil, err
-	}
-	// according to the job condtions, return success or failed
-	for _, contion := range targetJob.Status.Conditions {
-		if contion.Type == batchv1.JobComplete && contion.Status == corev1.ConditionTrue {
-			return kubeonkubev1alpha1.SucceededStatus, targetJob.Status.CompletionTime, nil
-		}
-		if contion.Type == batchv1.JobFailed && contion.Status == corev1.ConditionTrue {
-			return kubeonkubev1alpha1.FailedStatus, targetJob.Status.CompletionTime, nil
-		}
-		if contion.Type == batchv1.JobFailureTarget && contion.Status == corev1.ConditionTrue {
-			return kubeonkubev1alpha1.FailedStatus, targetJob.Status.CompletionTime, nil
-		}
-		if contion.Type == batchv1.JobSuspended && contion.Status == corev1.ConditionTrue {
-			return kubeonkubev1alpha1.FailedStatus, targetJob.Status.CompletionTime, nil
-		}
-	}
-
-	return kubeonkubev1alpha1.RunningStatus, nil, nil
-}
-
-func (r *ClusterOperationReconciler) UpdateStatusForLabel(clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+func (r *ClusterOperationReconciler) UpdateStatusForLabel(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
 	if clusterOps.Labels == nil {
 		clusterOps.Labels = make(map[string]string)
 	}
@@ -768,7 +1305,7 @@ func (r *ClusterOperationReconciler) UpdateStatusForLabel(clusterOps *kubeonkube
 	}
 	if clusterOps.Status.Status == kubeonkubev1alpha1.SucceededStatus || clusterOps.Status.Status == kubeonkubev1alpha1.FailedStatus {
 		clusterOps.Labels["hasCompleted"] = "done"
-		if err := r.Client.Update(context.Background(), clusterOps); err != nil {
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,337 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/entrypoint"
+)
+
+func newTestSaltClusterOps() *kubeonkubev1alpha1.ClusterOperation {
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops"},
+		Spec: kubeonkubev1alpha1.ClusterOperationSpec{
+			Cluster:    "c1",
+			ActionType: kubeonkubev1alpha1.PlaybookActionType,
+			Action:     "cluster.yml",
+			Image:      "kubespray:v2.23",
+			PreHook:    []kubeonkubev1alpha1.HookAction{{ActionType: kubeonkubev1alpha1.PlaybookActionType, Action: "ping.yml"}},
+		},
+	}
+}
+
+func TestCalSaltUnchangedWithoutNewFields(t *testing.T) {
+	r := &ClusterOperationReconciler{}
+	want := fmt.Sprintf("%x", md5.Sum([]byte(BaseSlat+"c1playbookcluster.ymlkubespray:v2.23playbookping.yml")))
+	if got := r.CalSalt(newTestSaltClusterOps()); got != want {
+		t.Errorf("got %s, want the digest of the earlier versions %s", got, want)
+	}
+}
+
+func TestCalSalt(t *testing.T) {
+	r := &ClusterOperationReconciler{}
+	base := r.CalSalt(newTestSaltClusterOps())
+	changes := map[string]func(spec *kubeonkubev1alpha1.ClusterOperationSpec){
+		"tags":       func(spec *kubeonkubev1alpha1.ClusterOperationSpec) { spec.Tags = []string{"etcd"} },
+		"hook limit": func(spec *kubeonkubev1alpha1.ClusterOperationSpec) { spec.PreHook[0].Limit = []string{"node1"} },
+		"verbosity":  func(spec *kubeonkubev1alpha1.ClusterOperationSpec) { spec.Verbosity = 2 },
+		"forks":      func(spec *kubeonkubev1alpha1.ClusterOperationSpec) { spec.Forks = 5 },
+		"extra vars": func(spec *kubeonkubev1alpha1.ClusterOperationSpec) {
+			spec.ExtraVars = map[string]apiextensionsv1.JSON{"a": {Raw: []byte(`1`)}}
+		},
+		"extra vars from": func(spec *kubeonkubev1alpha1.ClusterOperationSpec) {
+			spec.ExtraVarsFrom = []kubeonkubev1alpha1.ExtraVarsSource{{SecretRef: &api.SecretRef{NameSpace: "ns", Name: "vars"}}}
+		},
+		"runner env": func(spec *kubeonkubev1alpha1.ClusterOperationSpec) {
+			spec.Runner = &kubeonkubev1alpha1.RunnerPodSpec{Env: []corev1.EnvVar{{Name: "HTTP_PROXY", Value: "http://proxy"}}}
+		},
+		"runner ansible cfg": func(spec *kubeonkubev1alpha1.ClusterOperationSpec) {
+			spec.Runner = &kubeonkubev1alpha1.RunnerPodSpec{AnsibleCfgRef: &corev1.LocalObjectReference{Name: "cfg"}}
+		},
+		"volumes": func(spec *kubeonkubev1alpha1.ClusterOperationSpec) {
+			spec.Volumes = []kubeonkubev1alpha1.RunnerVolume{{Name: "cache", EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+		},
+		"volume mounts": func(spec *kubeonkubev1alpha1.ClusterOperationSpec) {
+			spec.VolumeMounts = []corev1.VolumeMount{{Name: "cache", MountPath: "/cache"}}
+		},
+	}
+	for name, change := range changes {
+		clusterOps := newTestSaltClusterOps()
+		change(&clusterOps.Spec)
+		if r.CalSalt(clusterOps) == base {
+			t.Errorf("%s is not in the digest", name)
+		}
+	}
+
+	clusterOps := newTestSaltClusterOps()
+	clusterOps.Spec.Volumes = []kubeonkubev1alpha1.RunnerVolume{{Name: "ca", ConfigMapRef: &api.ConfigMapRef{NameSpace: "ns", Name: "ca"}}}
+	digest := r.CalSalt(clusterOps)
+	clusterOps.Spec.Volumes[0].BackupRef = &api.DataRef{NameSpace: "ns", Name: "ca-backup"}
+	if r.CalSalt(clusterOps) != digest {
+		t.Error("the backup filled by the operator must not change the digest")
+	}
+	if clusterOps.Spec.Volumes[0].BackupRef == nil {
+		t.Error("the spec must not be modified")
+	}
+}
+
+func TestResolveExtraVars(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "vars"},
+		Data:       map[string]string{"a": "from-configmap", "b": "true"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "secret-vars"},
+		Data:       map[string][]byte{"b": []byte("from-secret"), "password": []byte("s3cret")},
+	}
+	r := &ClusterOperationReconciler{Client: newTestClient(t, configMap, secret)}
+	clusterOps := newTestSaltClusterOps()
+	clusterOps.Spec.ExtraVarsFrom = []kubeonkubev1alpha1.ExtraVarsSource{
+		{ConfigMapRef: &api.ConfigMapRef{NameSpace: "ns", Name: "vars"}},
+		{SecretRef: &api.SecretRef{NameSpace: "ns", Name: "secret-vars"}},
+	}
+	clusterOps.Spec.ExtraVars = map[string]apiextensionsv1.JSON{
+		"a":       {Raw: []byte(`"from-spec"`)},
+		"enabled": {Raw: []byte(`true`)},
+		"port":    {Raw: []byte(`6443`)},
+		"servers": {Raw: []byte(`["8.8.8.8"]`)},
+	}
+	vars, err := r.ResolveExtraVars(context.Background(), clusterOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a":        "from-spec",
+		"b":        "from-secret",
+		"password": "s3cret",
+		"enabled":  true,
+		"port":     float64(6443),
+		"servers":  []interface{}{"8.8.8.8"},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("got %v, want %v", vars, want)
+	}
+
+	clusterOps.Spec.ExtraVarsFrom = []kubeonkubev1alpha1.ExtraVarsSource{{ConfigMapRef: &api.ConfigMapRef{NameSpace: "ns", Name: "missing"}}}
+	if _, err := r.ResolveExtraVars(context.Background(), clusterOps); err == nil {
+		t.Error("a missing source must fail")
+	}
+}
+
+func TestClusterOpsStatusHelpers(t *testing.T) {
+	for status, want := range map[kubeonkubev1alpha1.OpsStatus][2]bool{
+		"":                               {true, true},
+		kubeonkubev1alpha1.QueuedStatus:  {true, true},
+		kubeonkubev1alpha1.WaitingStatus: {true, true},
+		kubeonkubev1alpha1.AwaitingApprovalStatus: {true, true},
+		kubeonkubev1alpha1.RunningStatus:          {false, true},
+		kubeonkubev1alpha1.SucceededStatus:        {false, false},
+		kubeonkubev1alpha1.FailedStatus:           {false, false},
+	} {
+		clusterOps := &kubeonkubev1alpha1.ClusterOperation{Status: kubeonkubev1alpha1.ClusterOperationStatus{Status: status}}
+		if got := IsPendingClusterOps(clusterOps); got != want[0] {
+			t.Errorf("IsPendingClusterOps(%q) = %v, want %v", status, got, want[0])
+		}
+		if got := IsActiveClusterOps(clusterOps); got != want[1] {
+			t.Errorf("IsActiveClusterOps(%q) = %v, want %v", status, got, want[1])
+		}
+	}
+}
+
+// newTestSecretDataCluster returns a Cluster with the hosts and vars, and the reconciler of a clusterOps on it.
+func newTestSecretDataCluster(t *testing.T, objs ...client.Object) (*ClusterOperationReconciler, *kubeonkubev1alpha1.Cluster, *kubeonkubev1alpha1.ClusterOperation) {
+	cluster := &kubeonkubev1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1"},
+		Spec: kubeonkubev1alpha1.ClusterSpec{
+			HostsConfRef: &api.ConfigMapRef{NameSpace: "ns", Name: "hosts"},
+			VarsConfRef:  &api.ConfigMapRef{NameSpace: "ns", Name: "vars"},
+		},
+	}
+	clusterOps := newTestSaltClusterOps()
+	clusterOps.UID = "uid"
+	clusterOps.Spec.PreHook = nil
+	clusterOps.Spec.EntrypointSHRef = &api.ConfigMapRef{NameSpace: "ns", Name: EntrypointConfigMapName(clusterOps)}
+	objs = append(objs, cluster, clusterOps,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "hosts"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "vars"}},
+	)
+	return &ClusterOperationReconciler{Client: newTestClient(t, objs...)}, cluster, clusterOps
+}
+
+// backUpTestDataRef backs up the data of the Cluster one at a time until all are backed up.
+func backUpTestDataRef(t *testing.T, r *ClusterOperationReconciler, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		changed, err := r.BackUpDataRef(context.Background(), clusterOps, cluster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed {
+			return
+		}
+	}
+	t.Fatal("BackUpDataRef does not finish")
+}
+
+// findJobVolume returns the mount of the runner container and the volume with the name.
+func findJobVolume(job *batchv1.Job, name string) (*corev1.VolumeMount, *corev1.Volume) {
+	var mount *corev1.VolumeMount
+	for i, item := range job.Spec.Template.Spec.Containers[0].VolumeMounts {
+		if item.Name == name {
+			mount = &job.Spec.Template.Spec.Containers[0].VolumeMounts[i]
+		}
+	}
+	for i, item := range job.Spec.Template.Spec.Volumes {
+		if item.Name == name {
+			return mount, &job.Spec.Template.Spec.Volumes[i]
+		}
+	}
+	return mount, nil
+}
+
+func TestSecretVarsRef(t *testing.T) {
+	ctx := context.Background()
+	r, cluster, clusterOps := newTestSecretDataCluster(t)
+	cluster.Spec.SecretVarsRef = &api.SecretRef{NameSpace: "ns", Name: "secret-vars"}
+	err := r.CheckClusterDataRef(ctx, cluster, clusterOps)
+	if err == nil || !strings.Contains(err.Error(), "secretVarsRef ns,secret-vars not found") {
+		t.Fatalf("got %v, want the missing secret vars", err)
+	}
+
+	secretVars := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "secret-vars"},
+		Data:       map[string][]byte{SecretVarsKey: []byte("password: s3cret\n")},
+	}
+	if err := r.Client.Create(ctx, secretVars); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckClusterDataRef(ctx, cluster, clusterOps); err != nil {
+		t.Fatal(err)
+	}
+	backUpTestDataRef(t, r, cluster, clusterOps)
+	backup := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: clusterOps.Spec.SecretVarsRef.NameSpace, Name: clusterOps.Spec.SecretVarsRef.Name}, backup); err != nil {
+		t.Fatalf("the secret vars are not backed up as a Secret: %v", err)
+	}
+	if !strings.HasPrefix(backup.Name, "secret-vars-") || !reflect.DeepEqual(backup.Data, secretVars.Data) || !metav1.IsControlledBy(backup, clusterOps) {
+		t.Errorf("backup = %+v, want a copy of the secret vars owned by the clusterOps", backup)
+	}
+
+	entryPointData, err := NewEntryPoint(clusterOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := entryPointData.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "-e @"+entrypoint.SecretVarsPath+" ") {
+		t.Errorf("entrypoint.sh does not pass the secret vars:\n%s", script)
+	}
+	mount, volume := findJobVolume(r.NewKubesprayJob(clusterOps, cluster), "secret-vars")
+	if mount == nil || mount.MountPath != entrypoint.SecretVarsPath || mount.SubPath != SecretVarsKey || !mount.ReadOnly {
+		t.Errorf("mount = %+v, want %s read only at %s", mount, SecretVarsKey, entrypoint.SecretVarsPath)
+	}
+	if volume == nil || volume.Secret == nil || volume.Secret.SecretName != backup.Name {
+		t.Errorf("volume = %+v, want the backup %s", volume, backup.Name)
+	}
+
+	clusterOps.Spec.SecretVarsRef = nil
+	if entryPointData, err = NewEntryPoint(clusterOps); err != nil {
+		t.Fatal(err)
+	}
+	if script, _ := entryPointData.Render(); strings.Contains(script, entrypoint.SecretVarsPath) {
+		t.Errorf("entrypoint.sh passes the secret vars without them:\n%s", script)
+	}
+	if mount, volume := findJobVolume(r.NewKubesprayJob(clusterOps, cluster), "secret-vars"); mount != nil || volume != nil {
+		t.Error("the job mounts the secret vars without them")
+	}
+}
+
+func TestVaultPasswordRef(t *testing.T) {
+	ctx := context.Background()
+	r, cluster, clusterOps := newTestSecretDataCluster(t)
+	cluster.Spec.VaultPasswordRef = &api.SecretRef{NameSpace: "ns", Name: "vault"}
+	err := r.CheckClusterDataRef(ctx, cluster, clusterOps)
+	if err == nil || !strings.Contains(err.Error(), "vaultPasswordRef ns,vault not found") {
+		t.Fatalf("got %v, want the missing vault password", err)
+	}
+
+	vault := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "vault"},
+		Data:       map[string][]byte{VaultPasswordKey: []byte("s3cret")},
+	}
+	if err := r.Client.Create(ctx, vault); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CheckClusterDataRef(ctx, cluster, clusterOps); err != nil {
+		t.Fatal(err)
+	}
+	backUpTestDataRef(t, r, cluster, clusterOps)
+	backup := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: clusterOps.Spec.VaultPasswordRef.NameSpace, Name: clusterOps.Spec.VaultPasswordRef.Name}, backup); err != nil {
+		t.Fatalf("the vault password is not backed up: %v", err)
+	}
+	if !strings.HasPrefix(backup.Name, "vault-") || !reflect.DeepEqual(backup.Data, vault.Data) || !metav1.IsControlledBy(backup, clusterOps) {
+		t.Errorf("backup = %+v, want a copy of the vault password owned by the clusterOps", backup)
+	}
+
+	entryPointData, err := NewEntryPoint(clusterOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := entryPointData.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "--vault-password-file "+entrypoint.VaultPasswordPath+" ") {
+		t.Errorf("entrypoint.sh does not pass the vault password file:\n%s", script)
+	}
+	mount, volume := findJobVolume(r.NewKubesprayJob(clusterOps, cluster), "vault-password")
+	if mount == nil || mount.MountPath != entrypoint.VaultPasswordPath || mount.SubPath != VaultPasswordKey || !mount.ReadOnly {
+		t.Errorf("mount = %+v, want %s read only at %s", mount, VaultPasswordKey, entrypoint.VaultPasswordPath)
+	}
+	if volume == nil || volume.Secret == nil || volume.Secret.SecretName != backup.Name ||
+		volume.Secret.DefaultMode == nil || *volume.Secret.DefaultMode != 0o400 {
+		t.Errorf("volume = %+v, want the backup %s readable only by the owner", volume, backup.Name)
+	}
+
+	clusterOps.Spec.VaultPasswordRef = nil
+	if entryPointData, err = NewEntryPoint(clusterOps); err != nil {
+		t.Fatal(err)
+	}
+	if script, _ := entryPointData.Render(); strings.Contains(script, "--vault-password-file") {
+		t.Errorf("entrypoint.sh passes the vault password file without it:\n%s", script)
+	}
+	if mount, volume := findJobVolume(r.NewKubesprayJob(clusterOps, cluster), "vault-password"); mount != nil || volume != nil {
+		t.Error("the job mounts the vault password without it")
+	}
+}
@@ -0,0 +1,443 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/cron"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// ScheduleLabelKey is set on the ClusterOperations created by a ClusterOperationSchedule.
+	ScheduleLabelKey = "clay.io/schedule"
+	// ScheduledTimeAnno records the scheduled time a ClusterOperation was created for.
+	ScheduledTimeAnno = "clay.io/scheduled-time"
+
+	DefaultSuccessfulHistoryLimit = 3
+	DefaultFailedHistoryLimit     = 1
+	// maxScheduledOpsNamePrefix keeps the Job name kubeonkube-<ops>-job within 63 characters.
+	maxScheduledOpsNamePrefix = 37
+)
+
+// ClusterOperationScheduleReconciler reconciles a ClusterOperationSchedule object
+type ClusterOperationScheduleReconciler struct {
+	Client client.Client
+	Scheme *runtime.Scheme
+	// Config is the hot-reloaded controller configuration, the defaults are used when it is nil.
+	Config *config.Provider
+	// Archiver is optional, the ClusterOperations beyond the history limits are archived before deletion when it is set.
+	Archiver *archive.Archiver
+}
+
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperationschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperationschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperationschedules/finalizers,verbs=update
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperations,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusters,verbs=get;list;watch
+
+// Reconcile creates the ClusterOperations of the latest missed run, prunes the history of the schedule
+// and requeues itself at the next scheduled time.
+func (r *ClusterOperationScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// 判断 schedule 是否存在
+	schedule := &kubeonkubev1alpha1.ClusterOperationSchedule{}
+	if err := r.Client.Get(ctx, req.NamespacedName, schedule); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		klog.ErrorS(err, "failed to get cluster operation schedule", "schedule", req.String())
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	if !schedule.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	// 解析 cron 表达式和时区，无效时记录到 status，等待 spec 修改后再调谐
+	cronSchedule, location, err := ParseSchedule(&schedule.Spec)
+	if err != nil {
+		schedule.Status.NextScheduleTime = nil
+		schedule.Status.Message = err.Error()
+		if err := r.Client.Status().Update(ctx, schedule); err != nil {
+			klog.ErrorS(err, "failed to update cluster operation schedule status", "schedule", schedule.Name)
+			return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+		}
+		return ctrl.Result{}, nil
+	}
+	now := time.Now().In(location)
+
+	// 获取 schedule 创建的 ClusterOps，清理超出历史记录数量的 ClusterOps
+	clusterOpsList := &kubeonkubev1alpha1.ClusterOperationList{}
+	if err := r.Client.List(ctx, clusterOpsList, client.MatchingLabels{ScheduleLabelKey: schedule.Name}); err != nil {
+		klog.ErrorS(err, "failed to list cluster ops of schedule", "schedule", schedule.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	active, retry := r.CleanScheduleHistory(ctx, schedule, clusterOpsList.Items)
+	schedule.Status.Message = ""
+
+	// 找到最近一次错过的调度时间，按并发策略为每个目标 Cluster 创建 ClusterOps
+	if schedule.Spec.Suspend == nil || !*schedule.Spec.Suspend {
+		scheduledTime, err := MissedScheduleTime(cronSchedule, schedule, now)
+		if errors.Is(err, cron.ErrTooManyMissed) {
+			// 错过的调度过多时不执行，从当前时间重新开始计算，同 CronJob 一样提示设置 startingDeadlineSeconds
+			schedule.Status.Message = fmt.Sprintf("%v, skipped them, set or decrease spec.startingDeadlineSeconds", err)
+			schedule.Status.LastScheduleTime = &metav1.Time{Time: now.Truncate(time.Minute)}
+		} else if !scheduledTime.IsZero() {
+			if deadline := schedule.Spec.StartingDeadlineSeconds; deadline != nil && now.Sub(scheduledTime) > time.Duration(*deadline)*time.Second {
+				schedule.Status.Message = fmt.Sprintf("missed the run at %s by more than %ds", scheduledTime.Format(time.RFC3339), *deadline)
+			} else {
+				created, err := r.RunSchedule(ctx, schedule, active, scheduledTime)
+				if err != nil {
+					klog.ErrorS(err, "failed to run schedule", "schedule", schedule.Name, "scheduledTime", scheduledTime)
+					return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+				}
+				active = append(active, created...)
+			}
+			schedule.Status.LastScheduleTime = &metav1.Time{Time: scheduledTime}
+		}
+	}
+
+	// 更新状态，在下一次调度时间再次调谐
+	var requeue time.Duration
+	schedule.Status.NextScheduleTime = nil
+	if schedule.Spec.Suspend == nil || !*schedule.Spec.Suspend {
+		if next := cronSchedule.Next(now); !next.IsZero() {
+			schedule.Status.NextScheduleTime = &metav1.Time{Time: next}
+			requeue = next.Sub(now)
+		}
+	}
+	names := make([]string, 0, len(active))
+	for _, item := range active {
+		names = append(names, item.Name)
+	}
+	sort.Strings(names)
+	schedule.Status.Active = names
+	if err := r.Client.Status().Update(ctx, schedule); err != nil {
+		klog.ErrorS(err, "failed to update cluster operation schedule status", "schedule", schedule.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	// 归档或删除失败的历史记录稍后重试
+	if retry && (requeue <= 0 || requeue > RequeueAfter) {
+		requeue = RequeueAfter
+	}
+	return ctrl.Result{RequeueAfter: requeue}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// ClusterOperation events are mapped to their schedule through the clay.io/schedule label.
+func (r *ClusterOperationScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kubeonkubev1alpha1.ClusterOperationSchedule{}).
+		Watches(&source.Kind{Type: &kubeonkubev1alpha1.ClusterOperation{}}, handler.EnqueueRequestsFromMapFunc(clusterOpsToSchedule)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Config.Get().Concurrency.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+// ParseSchedule parses the cron expression and loads the time zone of the schedule.
+func ParseSchedule(spec *kubeonkubev1alpha1.ClusterOperationScheduleSpec) (*cron.Schedule, *time.Location, error) {
+	cronSchedule, err := cron.Parse(spec.Schedule)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+	location := time.Local
+	if spec.TimeZone != nil && len(*spec.TimeZone) > 0 {
+		if location, err = time.LoadLocation(*spec.TimeZone); err != nil {
+			return nil, nil, fmt.Errorf("invalid timeZone: %w", err)
+		}
+	}
+	return cronSchedule, location, nil
+}
+
+// MissedScheduleTime returns the latest scheduled time after the last run, or after the creation when it never ran.
+// Older missed runs are dropped, as a CronJob does, so a long controller outage does not start a burst of ClusterOperations.
+// It returns cron.ErrTooManyMissed when more than cron.MaxMissed runs are missed.
+func MissedScheduleTime(cronSchedule *cron.Schedule, schedule *kubeonkubev1alpha1.ClusterOperationSchedule, now time.Time) (time.Time, error) {
+	since := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		since = schedule.Status.LastScheduleTime.Time
+	}
+	if deadline := schedule.Spec.StartingDeadlineSeconds; deadline != nil {
+		if earliest := now.Add(-time.Duration(*deadline) * time.Second); earliest.After(since) {
+			since = earliest
+		}
+	}
+	// since itself has run or precedes the creation, start from the next minute
+	return cronSchedule.Prev(since.In(now.Location()).Truncate(time.Minute).Add(time.Minute), now)
+}
+
+// CleanScheduleHistory archives and deletes the finished ClusterOperations of each Cluster beyond the history limits,
+// it returns the active ones and whether any of them has to be retried.
+func (r *ClusterOperationScheduleReconciler) CleanScheduleHistory(ctx context.Context, schedule *kubeonkubev1alpha1.ClusterOperationSchedule, items []kubeonkubev1alpha1.ClusterOperation) ([]*kubeonkubev1alpha1.ClusterOperation, bool) {
+	successfulLimit, failedLimit := DefaultSuccessfulHistoryLimit, DefaultFailedHistoryLimit
+	if schedule.Spec.SuccessfulHistoryLimit != nil {
+		successfulLimit = int(*schedule.Spec.SuccessfulHistoryLimit)
+	}
+	if schedule.Spec.FailedHistoryLimit != nil {
+		failedLimit = int(*schedule.Spec.FailedHistoryLimit)
+	}
+
+	active := []*kubeonkubev1alpha1.ClusterOperation{}
+	succeeded := map[string][]*kubeonkubev1alpha1.ClusterOperation{}
+	failed := map[string][]*kubeonkubev1alpha1.ClusterOperation{}
+	for i := range items {
+		item := &items[i]
+		if _, ok := item.Annotations[archive.RestoredAnno]; ok || !item.DeletionTimestamp.IsZero() {
+			continue
+		}
+		switch item.Status.Status {
+		case kubeonkubev1alpha1.SucceededStatus:
+			succeeded[item.Spec.Cluster] = append(succeeded[item.Spec.Cluster], item)
+			if item.Status.EndTime != nil && (schedule.Status.LastSuccessfulTime == nil || schedule.Status.LastSuccessfulTime.Before(item.Status.EndTime)) {
+				schedule.Status.LastSuccessfulTime = item.Status.EndTime.DeepCopy()
+			}
+		case kubeonkubev1alpha1.FailedStatus:
+			failed[item.Spec.Cluster] = append(failed[item.Spec.Cluster], item)
+		default:
+			active = append(active, item)
+		}
+	}
+
+	excess := []*kubeonkubev1alpha1.ClusterOperation{}
+	for _, history := range []struct {
+		byCluster map[string][]*kubeonkubev1alpha1.ClusterOperation
+		limit     int
+	}{{succeeded, successfulLimit}, {failed, failedLimit}} {
+		for _, finished := range history.byCluster {
+			if len(finished) <= history.limit {
+				continue
+			}
+			// 按创建时间倒序，保留最新的 limit 个
+			sort.Slice(finished, func(i, j int) bool {
+				return finished[j].CreationTimestamp.Before(&finished[i].CreationTimestamp)
+			})
+			excess = append(excess, finished[history.limit:]...)
+		}
+	}
+	retry := false
+	for _, item := range excess {
+		if _, ok := item.Annotations[RetainAnno]; ok {
+			continue
+		}
+		if !ArchiveAndDeleteClusterOps(ctx, r.Client, r.Archiver, item, fmt.Sprintf("exceed the history limit of schedule %s", schedule.Name)) {
+			retry = true
+		}
+	}
+	return active, retry
+}
+
+// TargetClusters resolves the names of the Clusters the schedule runs against, sorted and without duplicates.
+// Clusters which do not exist or are deleting are skipped.
+func (r *ClusterOperationScheduleReconciler) TargetClusters(ctx context.Context, schedule *kubeonkubev1alpha1.ClusterOperationSchedule) ([]string, error) {
+	names := map[string]struct{}{}
+	for _, name := range schedule.Spec.Clusters {
+		names[name] = struct{}{}
+	}
+	if schedule.Spec.ClusterSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(schedule.Spec.ClusterSelector)
+		if err != nil {
+			return nil, err
+		}
+		clusterList := &kubeonkubev1alpha1.ClusterList{}
+		if err := r.Client.List(ctx, clusterList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, err
+		}
+		for _, item := range clusterList.Items {
+			names[item.Name] = struct{}{}
+		}
+	}
+	if len(schedule.Spec.Clusters) == 0 && schedule.Spec.ClusterSelector == nil {
+		names[schedule.Spec.Template.Spec.Cluster] = struct{}{}
+	}
+
+	targets := []string{}
+	for name := range names {
+		cluster := &kubeonkubev1alpha1.Cluster{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: name}, cluster); err != nil {
+			if apierrors.IsNotFound(err) {
+				klog.Warningf("schedule %s skips cluster %s which does not exist", schedule.Name, name)
+				continue
+			}
+			return nil, err
+		}
+		if !cluster.DeletionTimestamp.IsZero() {
+			continue
+		}
+		targets = append(targets, name)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// RunSchedule creates the ClusterOperation of the scheduled time for every target Cluster under the concurrency policy.
+func (r *ClusterOperationScheduleReconciler) RunSchedule(ctx context.Context, schedule *kubeonkubev1alpha1.ClusterOperationSchedule, active []*kubeonkubev1alpha1.ClusterOperation, scheduledTime time.Time) ([]*kubeonkubev1alpha1.ClusterOperation, error) {
+	targets, err := r.TargetClusters(ctx, schedule)
+	if err != nil {
+		return nil, err
+	}
+	activeByCluster := map[string][]*kubeonkubev1alpha1.ClusterOperation{}
+	for _, item := range active {
+		activeByCluster[item.Spec.Cluster] = append(activeByCluster[item.Spec.Cluster], item)
+	}
+
+	created := []*kubeonkubev1alpha1.ClusterOperation{}
+	skipped := []string{}
+	for _, clusterName := range targets {
+		clusterOps := NewScheduledClusterOps(schedule, clusterName, scheduledTime)
+		running := activeByCluster[clusterName]
+		alreadyCreated := false
+		for _, item := range running {
+			if item.Name == clusterOps.Name {
+				alreadyCreated = true
+			}
+		}
+		if alreadyCreated {
+			continue
+		}
+		if len(running) > 0 {
+			switch schedule.Spec.GetConcurrencyPolicy() {
+			case kubeonkubev1alpha1.ForbidConcurrent:
+				skipped = append(skipped, clusterName)
+				continue
+			case kubeonkubev1alpha1.ReplaceConcurrent:
+				// 只替换尚未启动的 ClusterOps，中断执行中的 Job 会让集群处于中间状态，此时同 Forbid 一样跳过
+				started := false
+				for _, item := range running {
+					if !IsPendingClusterOps(item) {
+						started = true
+					}
+				}
+				if started {
+					skipped = append(skipped, clusterName)
+					continue
+				}
+				for _, item := range running {
+					if err := r.Client.Delete(ctx, item, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+						return nil, err
+					}
+					klog.Infof("schedule %s replaces the pending cluster ops %s", schedule.Name, item.Name)
+				}
+			}
+		}
+		if err := r.Client.Create(ctx, clusterOps); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			return nil, err
+		}
+		klog.Infof("schedule %s creates cluster ops %s for cluster %s", schedule.Name, clusterOps.Name, clusterName)
+		created = append(created, clusterOps)
+	}
+	if len(skipped) > 0 {
+		schedule.Status.Message = fmt.Sprintf("skipped the run at %s on clusters %s which are still running", scheduledTime.Format(time.RFC3339), strings.Join(skipped, ","))
+	}
+	return created, nil
+}
+
+// NewScheduledClusterOps renders the template of the schedule for the Cluster.
+// The name is derived from the cluster and the scheduled time, so a retried run does not create it twice.
+func NewScheduledClusterOps(schedule *kubeonkubev1alpha1.ClusterOperationSchedule, clusterName string, scheduledTime time.Time) *kubeonkubev1alpha1.ClusterOperation {
+	template := schedule.Spec.Template.DeepCopy()
+	labels := template.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[ScheduleLabelKey] = schedule.Name
+	labels[ClusterLabelKey] = clusterName
+	annotations := template.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ScheduledTimeAnno] = scheduledTime.Format(time.RFC3339)
+
+	spec := template.Spec
+	spec.Cluster = clusterName
+	// 模板中的审批无效，由 schedule 的创建者请求，schedule 审批后每次运行都视为已审批
+	delete(annotations, util.RequestedByAnno)
+	delete(annotations, util.ApprovedByAnno)
+	spec.Approved = false
+	if requester, ok := schedule.Annotations[util.RequestedByAnno]; ok {
+		annotations[util.RequestedByAnno] = requester
+	}
+	if approver := util.ApprovedBy(schedule.Annotations, schedule.Spec.Approved); len(approver) > 0 {
+		annotations[util.ApprovedByAnno] = approver
+		spec.Approved = true
+	}
+	// filled by the operator when it performs backup
+	spec.HostsConfRef, spec.VarsConfRef, spec.SSHAuthRef, spec.SecretVarsRef, spec.VaultPasswordRef = nil, nil, nil, nil, nil
+	spec.EntrypointSHRef, spec.ExtraVarsRef, spec.RunnerBackup = nil, nil, nil
+	spec.Volumes = append([]kubeonkubev1alpha1.RunnerVolume{}, spec.Volumes...)
+	for i := range spec.Volumes {
+		spec.Volumes[i].BackupRef = nil
+	}
+
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ScheduledClusterOpsName(schedule.Name, clusterName, scheduledTime),
+			Labels:      labels,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: kubeonkubev1alpha1.SchemeGroupVersion.String(),
+				Kind:       "ClusterOperationSchedule",
+				Name:       schedule.Name,
+				UID:        schedule.UID,
+			}},
+		},
+		Spec: spec,
+	}
+}
+
+// ScheduledClusterOpsName is <schedule>-<hash of the cluster and the scheduled time>.
+func ScheduledClusterOpsName(scheduleName, clusterName string, scheduledTime time.Time) string {
+	hash := fnv.New32a()
+	fmt.Fprintf(hash, "%s/%d", clusterName, scheduledTime.Unix())
+	prefix := scheduleName
+	if len(prefix) > maxScheduledOpsNamePrefix {
+		prefix = strings.TrimRight(prefix[:maxScheduledOpsNamePrefix], "-.")
+	}
+	return fmt.Sprintf("%s-%08x", prefix, hash.Sum32())
+}
+
+// clusterOpsToSchedule maps a ClusterOperation event to the schedule which created it.
+func clusterOpsToSchedule(obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[ScheduleLabelKey]
+	if !ok || len(name) == 0 {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: name}}}
+}
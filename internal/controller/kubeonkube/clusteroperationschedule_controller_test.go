@@ -0,0 +1,215 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+)
+
+// failingStore fails every write, like an unreachable bucket.
+type failingStore struct{ archive.FileStore }
+
+func (s *failingStore) Put(context.Context, string, []byte) error {
+	return errors.New("store unavailable")
+}
+
+func TestNewScheduledClusterOpsApproval(t *testing.T) {
+	newSchedule := func(approved bool, annotations map[string]string) *kubeonkubev1alpha1.ClusterOperationSchedule {
+		return &kubeonkubev1alpha1.ClusterOperationSchedule{
+			ObjectMeta: metav1.ObjectMeta{Name: "weekly", Annotations: annotations},
+			Spec: kubeonkubev1alpha1.ClusterOperationScheduleSpec{
+				Schedule: "0 2 * * 6",
+				Approved: approved,
+				Template: kubeonkubev1alpha1.ClusterOperationTemplate{
+					Annotations: map[string]string{
+						util.RequestedByAnno: "mallory",
+						util.ApprovedByAnno:  "mallory",
+						"team":               "infra",
+					},
+					Spec: kubeonkubev1alpha1.ClusterOperationSpec{Action: "reset.yml", Approved: true},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name          string
+		schedule      *kubeonkubev1alpha1.ClusterOperationSchedule
+		wantRequester string
+		wantApprover  string
+	}{
+		{
+			name:          "the template approval is stripped",
+			schedule:      newSchedule(false, map[string]string{util.RequestedByAnno: "alice"}),
+			wantRequester: "alice",
+		},
+		{
+			name:          "approved through the schedule",
+			schedule:      newSchedule(true, map[string]string{util.RequestedByAnno: "alice", util.ApprovedByAnno: "bob"}),
+			wantRequester: "alice",
+			wantApprover:  "bob",
+		},
+		{
+			name:     "approved without approver",
+			schedule: newSchedule(true, nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterOps := NewScheduledClusterOps(tt.schedule, "c1", time.Date(2024, 1, 6, 2, 0, 0, 0, time.UTC))
+			if got := clusterOps.Annotations[util.RequestedByAnno]; got != tt.wantRequester {
+				t.Errorf("requested-by %q, want %q", got, tt.wantRequester)
+			}
+			if got := clusterOps.Annotations[util.ApprovedByAnno]; got != tt.wantApprover {
+				t.Errorf("approved-by %q, want %q", got, tt.wantApprover)
+			}
+			if clusterOps.Spec.Approved != (len(tt.wantApprover) > 0) {
+				t.Errorf("approved %v, want it only with an approver", clusterOps.Spec.Approved)
+			}
+			if clusterOps.Annotations["team"] != "infra" || clusterOps.Spec.Cluster != "c1" {
+				t.Errorf("the template is not applied: %v %s", clusterOps.Annotations, clusterOps.Spec.Cluster)
+			}
+			if tt.schedule.Spec.Template.Annotations[util.ApprovedByAnno] != "mallory" {
+				t.Error("the template of the schedule must not be modified")
+			}
+		})
+	}
+}
+
+func TestCleanScheduleHistory(t *testing.T) {
+	schedule := &kubeonkubev1alpha1.ClusterOperationSchedule{ObjectMeta: metav1.ObjectMeta{Name: "weekly"}}
+	newItems := func() []kubeonkubev1alpha1.ClusterOperation {
+		// the restored clusterOps is a record, it does not count in the history
+		restored := newTestClusterOps("restored", "c1", kubeonkubev1alpha1.SucceededStatus, 0, time.Minute)
+		restored.Annotations = map[string]string{archive.RestoredAnno: "c1/restored-1.yaml"}
+		return []kubeonkubev1alpha1.ClusterOperation{
+			*restored,
+			*newTestClusterOps("new", "c1", kubeonkubev1alpha1.SucceededStatus, 0, time.Hour),
+			*newTestClusterOps("older", "c1", kubeonkubev1alpha1.SucceededStatus, 0, 2*time.Hour),
+			*newTestClusterOps("oldest", "c1", kubeonkubev1alpha1.SucceededStatus, 0, 3*time.Hour),
+			*newTestClusterOps("ancient", "c1", kubeonkubev1alpha1.SucceededStatus, 0, 4*time.Hour),
+			*newTestClusterOps("failed", "c1", kubeonkubev1alpha1.FailedStatus, 0, time.Hour),
+			*newTestClusterOps("failed-old", "c1", kubeonkubev1alpha1.FailedStatus, 0, 2*time.Hour),
+			*newTestClusterOps("running", "c1", kubeonkubev1alpha1.RunningStatus, 0, 5*time.Hour),
+		}
+	}
+	objects := func(items []kubeonkubev1alpha1.ClusterOperation) []client.Object {
+		objs := []client.Object{}
+		for i := range items {
+			objs = append(objs, items[i].DeepCopy())
+		}
+		return objs
+	}
+	exists := func(t *testing.T, c client.Client, name string) bool {
+		t.Helper()
+		err := c.Get(context.Background(), client.ObjectKey{Name: name}, &kubeonkubev1alpha1.ClusterOperation{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+
+	t.Run("archived before deletion", func(t *testing.T) {
+		items := newItems()
+		c := newTestClient(t, objects(items)...)
+		store := &archive.FileStore{Dir: t.TempDir()}
+		r := &ClusterOperationScheduleReconciler{Client: c, Archiver: &archive.Archiver{Store: store, Client: c}}
+		active, retry := r.CleanScheduleHistory(context.Background(), schedule, items)
+		if retry {
+			t.Error("unexpected retry")
+		}
+		if len(active) != 1 || active[0].Name != "running" {
+			t.Errorf("active %v, want the running clusterOps", active)
+		}
+		for name, want := range map[string]bool{"restored": true, "new": true, "older": true, "oldest": true, "ancient": false, "failed": true, "failed-old": false} {
+			if got := exists(t, c, name); got != want {
+				t.Errorf("clusterOps %s exists %v, want %v", name, got, want)
+			}
+		}
+		keys, err := store.List(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 2 {
+			t.Errorf("archived %v, want the 2 pruned clusterOps", keys)
+		}
+	})
+
+	t.Run("kept when the archive fails", func(t *testing.T) {
+		items := newItems()
+		c := newTestClient(t, objects(items)...)
+		r := &ClusterOperationScheduleReconciler{Client: c, Archiver: &archive.Archiver{Store: &failingStore{}, Client: c}}
+		if _, retry := r.CleanScheduleHistory(context.Background(), schedule, items); !retry {
+			t.Error("want a retry when the archive fails")
+		}
+		for _, name := range []string{"ancient", "failed-old"} {
+			if !exists(t, c, name) {
+				t.Errorf("clusterOps %s must be kept when its archive fails", name)
+			}
+		}
+	})
+}
+
+func TestRunScheduleReplace(t *testing.T) {
+	scheduledTime := time.Date(2024, 1, 6, 2, 0, 0, 0, time.UTC)
+	schedule := &kubeonkubev1alpha1.ClusterOperationSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "weekly"},
+		Spec: kubeonkubev1alpha1.ClusterOperationScheduleSpec{
+			Schedule:          "0 2 * * 6",
+			ConcurrencyPolicy: kubeonkubev1alpha1.ReplaceConcurrent,
+			Clusters:          []string{"c1", "c2"},
+			Template: kubeonkubev1alpha1.ClusterOperationTemplate{
+				Spec: kubeonkubev1alpha1.ClusterOperationSpec{Action: "cluster.yml"},
+			},
+		},
+	}
+	queued := newTestClusterOps("queued", "c1", kubeonkubev1alpha1.QueuedStatus, 0, time.Hour)
+	running := newTestClusterOps("running", "c2", kubeonkubev1alpha1.RunningStatus, 0, time.Hour)
+	c := newTestClient(t,
+		&kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c1"}},
+		&kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c2"}},
+		queued.DeepCopy(), running.DeepCopy(),
+	)
+	r := &ClusterOperationScheduleReconciler{Client: c}
+	created, err := r.RunSchedule(context.Background(), schedule, []*kubeonkubev1alpha1.ClusterOperation{queued, running}, scheduledTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].Spec.Cluster != "c1" {
+		t.Fatalf("created %v, want only the run of c1", created)
+	}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "queued"}, &kubeonkubev1alpha1.ClusterOperation{}); !apierrors.IsNotFound(err) {
+		t.Errorf("the queued clusterOps must be replaced, got %v", err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKey{Name: "running"}, &kubeonkubev1alpha1.ClusterOperation{}); err != nil {
+		t.Errorf("the running clusterOps must be kept, got %v", err)
+	}
+	if !strings.Contains(schedule.Status.Message, "c2") {
+		t.Errorf("message %q, want the skipped cluster c2", schedule.Status.Message)
+	}
+}
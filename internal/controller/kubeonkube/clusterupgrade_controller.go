@@ -0,0 +1,477 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/entrypoint"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/inventory"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/kubeversion"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	klog "k8s.io/klog/v2"
+)
+
+const (
+	// UpgradeLabelKey is set on the ClusterOperations created by a ClusterUpgrade.
+	UpgradeLabelKey = "clay.io/upgrade"
+	// KubeConfigKey is the key of the kubeconfig in the ConfigMap of Cluster.spec.kubeConfRef, the only key is used without it.
+	KubeConfigKey = "config"
+
+	DefaultUpgradeVerifyTimeout = 10 * time.Minute
+	// MaxVersionHistory keeps the last N records of Cluster.status.versionHistory.
+	MaxVersionHistory = 20
+	// maxUpgradeNameLength keeps the Job name kubeonkube-<upgrade>-precheck-job within 63 characters.
+	maxUpgradeNameLength = 39
+)
+
+// ClusterUpgradeReconciler reconciles a ClusterUpgrade object
+type ClusterUpgradeReconciler struct {
+	Client client.Client
+	Scheme *runtime.Scheme
+	// Config is the hot-reloaded controller configuration, the defaults are used when it is nil.
+	Config *config.Provider
+	// WorkloadClientSet connects to the upgraded cluster, it reads Cluster.spec.kubeConfRef when it is nil.
+	WorkloadClientSet func(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster) (kubernetes.Interface, error)
+}
+
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusterupgrades,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusterupgrades/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusterupgrades/finalizers,verbs=update
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusteroperations,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=kubeonkube.clay.io,resources=clusters/status,verbs=get;update;patch
+
+// Reconcile moves the ClusterUpgrade through its phases: Pending checks the version skew and the nodes,
+// PreChecking and Upgrading wait for their ClusterOperations, and Verifying waits for the new version and the Ready nodes.
+func (r *ClusterUpgradeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	upgrade := &kubeonkubev1alpha1.ClusterUpgrade{}
+	if err := r.Client.Get(ctx, req.NamespacedName, upgrade); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		klog.ErrorS(err, "failed to get cluster upgrade", "upgrade", req.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	if upgrade.Status.IsFinished() || !upgrade.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	// 获取 Cluster，不存在或删除中时升级失败
+	cluster := &kubeonkubev1alpha1.Cluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: upgrade.Spec.Cluster}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return r.fail(ctx, upgrade, fmt.Sprintf("cluster %s not found", upgrade.Spec.Cluster))
+		}
+		klog.ErrorS(err, "failed to get kubeonkube cluster", "upgrade", upgrade.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	if !cluster.DeletionTimestamp.IsZero() {
+		return r.fail(ctx, upgrade, fmt.Sprintf("cluster %s is being deleted", cluster.Name))
+	}
+	target, err := kubeversion.Parse(upgrade.Spec.KubeVersion)
+	if err != nil {
+		return r.fail(ctx, upgrade, err.Error())
+	}
+
+	switch upgrade.Status.Phase {
+	case "", kubeonkubev1alpha1.UpgradePendingPhase:
+		return r.PreCheck(ctx, upgrade, cluster, target)
+	case kubeonkubev1alpha1.UpgradePreCheckingPhase:
+		return r.RunClusterOps(ctx, upgrade, cluster, target, upgrade.Status.PreCheckOps, kubeonkubev1alpha1.UpgradeUpgradingPhase)
+	case kubeonkubev1alpha1.UpgradeUpgradingPhase:
+		return r.RunClusterOps(ctx, upgrade, cluster, target, upgrade.Status.UpgradeOps, kubeonkubev1alpha1.UpgradeVerifyingPhase)
+	case kubeonkubev1alpha1.UpgradeVerifyingPhase:
+		return r.Verify(ctx, upgrade, cluster, target)
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// ClusterOperation events are mapped to their upgrade through the clay.io/upgrade label.
+func (r *ClusterUpgradeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&kubeonkubev1alpha1.ClusterUpgrade{}).
+		Watches(&source.Kind{Type: &kubeonkubev1alpha1.ClusterOperation{}}, handler.EnqueueRequestsFromMapFunc(clusterOpsToUpgrade)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Config.Get().Concurrency.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+func clusterOpsToUpgrade(obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[UpgradeLabelKey]
+	if !ok || len(name) == 0 {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: name}}}
+}
+
+// PreCheck detects the current version, checks the version skew and the nodes and picks the runner image,
+// one upgrade of a Cluster runs at a time.
+func (r *ClusterUpgradeReconciler) PreCheck(ctx context.Context, upgrade *kubeonkubev1alpha1.ClusterUpgrade, cluster *kubeonkubev1alpha1.Cluster, target kubeversion.Version) (ctrl.Result, error) {
+	if len(upgrade.Name) > maxUpgradeNameLength {
+		return r.fail(ctx, upgrade, fmt.Sprintf("the name must be no more than %d characters", maxUpgradeNameLength))
+	}
+	upgradeList := &kubeonkubev1alpha1.ClusterUpgradeList{}
+	if err := r.Client.List(ctx, upgradeList); err != nil {
+		klog.ErrorS(err, "failed to list cluster upgrades", "upgrade", upgrade.Name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	for _, item := range upgradeList.Items {
+		if item.Name != upgrade.Name && item.Spec.Cluster == upgrade.Spec.Cluster && !item.Status.IsFinished() &&
+			len(item.Status.Phase) > 0 && item.Status.Phase != kubeonkubev1alpha1.UpgradePendingPhase {
+			return r.updateStatus(ctx, upgrade, kubeonkubev1alpha1.UpgradePendingPhase, fmt.Sprintf("waiting for the upgrade %s of the cluster", item.Name), RequeueAfter)
+		}
+	}
+
+	clientSet, err := r.workloadClientSet(ctx, cluster)
+	if err != nil {
+		return r.fail(ctx, upgrade, err.Error())
+	}
+	current, err := DetectKubeVersion(clientSet)
+	if err != nil {
+		return r.updateStatus(ctx, upgrade, kubeonkubev1alpha1.UpgradePendingPhase, fmt.Sprintf("failed to detect the version: %v", err), RequeueAfter)
+	}
+	maxMinorSkew := int(upgrade.Spec.MaxMinorVersionSkew)
+	if maxMinorSkew <= 0 {
+		maxMinorSkew = 1
+	}
+	if err := kubeversion.CheckUpgrade(current, target, maxMinorSkew); err != nil {
+		return r.fail(ctx, upgrade, err.Error())
+	}
+	if err := CheckNodes(ctx, clientSet, ""); err != nil {
+		return r.fail(ctx, upgrade, err.Error())
+	}
+
+	cfg := r.Config.Get()
+	image := upgrade.Spec.Image
+	if len(image) == 0 {
+		playbooks := []string{entrypoint.UpgradeClusterPB}
+		if preCheckAction := PreCheckAction(upgrade); len(preCheckAction) > 0 {
+			playbooks = append(playbooks, preCheckAction)
+		}
+		if images := cfg.RunnerImages.Suggest(config.RunnerImageTarget{KubeVersion: target.String(), OSFamilies: cluster.Spec.OSFamilies, Playbooks: playbooks}); len(images) > 0 {
+			image = images[0]
+		} else {
+			image = cfg.DefaultRunnerImage
+		}
+	}
+	if len(image) == 0 {
+		return r.fail(ctx, upgrade, fmt.Sprintf("no image supports %s, set spec.image or defaultRunnerImage", target))
+	}
+
+	now := metav1.Now()
+	upgrade.Status.StartTime = &now
+	upgrade.Status.FromVersion = current.String()
+	upgrade.Status.Image = image
+	upgrade.Status.UpgradeOps = UpgradeClusterOpsName(upgrade, "upgrade")
+	phase := kubeonkubev1alpha1.UpgradeUpgradingPhase
+	if len(PreCheckAction(upgrade)) > 0 {
+		upgrade.Status.PreCheckOps = UpgradeClusterOpsName(upgrade, "precheck")
+		phase = kubeonkubev1alpha1.UpgradePreCheckingPhase
+	}
+	klog.Warningf("cluster %s upgrades from %s to %s with image %s", cluster.Name, current, target, image)
+	return r.updateStatus(ctx, upgrade, phase, fmt.Sprintf("upgrading from %s to %s", current, target), requeueAfter)
+}
+
+// RunClusterOps creates the ClusterOperation of the phase and moves to the next phase when it succeeds.
+func (r *ClusterUpgradeReconciler) RunClusterOps(ctx context.Context, upgrade *kubeonkubev1alpha1.ClusterUpgrade, cluster *kubeonkubev1alpha1.Cluster, target kubeversion.Version, name string, next kubeonkubev1alpha1.ClusterUpgradePhase) (ctrl.Result, error) {
+	clusterOps := &kubeonkubev1alpha1.ClusterOperation{}
+	err := r.Client.Get(ctx, client.ObjectKey{Name: name}, clusterOps)
+	if apierrors.IsNotFound(err) {
+		action := entrypoint.UpgradeClusterPB
+		if name == upgrade.Status.PreCheckOps {
+			action = PreCheckAction(upgrade)
+		}
+		clusterOps = NewUpgradeClusterOps(upgrade, cluster, target, name, action)
+		klog.Warningf("cluster upgrade %s creates clusterOps %s to run %s", upgrade.Name, name, action)
+		if err := r.Client.Create(ctx, clusterOps); err != nil && !apierrors.IsAlreadyExists(err) {
+			klog.ErrorS(err, "failed to create cluster ops", "upgrade", upgrade.Name, "clusterOps", name)
+			return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+		}
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	if err != nil {
+		klog.ErrorS(err, "failed to get cluster ops", "upgrade", upgrade.Name, "clusterOps", name)
+		return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+	}
+	// 同名的 ClusterOps 可能由其他用户预先创建，只接受本次升级创建的
+	if !IsUpgradeClusterOps(upgrade, clusterOps) {
+		return r.fail(ctx, upgrade, fmt.Sprintf("clusterOps %s exists but is not created by the upgrade", name))
+	}
+	switch clusterOps.Status.Status {
+	case kubeonkubev1alpha1.AwaitingApprovalStatus:
+		message := fmt.Sprintf("clusterOps %s is awaiting approval, spec.approved must be set by a user other than its requester", name)
+		if requester := clusterOps.Annotations[util.RequestedByAnno]; len(requester) > 0 {
+			message = fmt.Sprintf("clusterOps %s is awaiting approval, spec.approved must be set by a user other than %s", name, requester)
+		}
+		return r.updateStatus(ctx, upgrade, upgrade.Status.Phase, message, RequeueAfter)
+	case kubeonkubev1alpha1.SucceededStatus:
+		if next == kubeonkubev1alpha1.UpgradeVerifyingPhase {
+			now := metav1.Now()
+			upgrade.Status.VerifyStartTime = &now
+		}
+		return r.updateStatus(ctx, upgrade, next, fmt.Sprintf("clusterOps %s succeeded", name), requeueAfter)
+	case kubeonkubev1alpha1.FailedStatus:
+		return r.fail(ctx, upgrade, fmt.Sprintf("clusterOps %s failed", name))
+	}
+	// ClusterOperation 的状态变化由 watch 触发，定时调谐兜底
+	return ctrl.Result{RequeueAfter: RequeueAfter}, nil
+}
+
+// Verify waits until the workload cluster reports the target version with every node Ready, and then records the version on the Cluster.
+func (r *ClusterUpgradeReconciler) Verify(ctx context.Context, upgrade *kubeonkubev1alpha1.ClusterUpgrade, cluster *kubeonkubev1alpha1.Cluster, target kubeversion.Version) (ctrl.Result, error) {
+	timeout := DefaultUpgradeVerifyTimeout
+	if upgrade.Spec.VerifyTimeoutSeconds != nil && *upgrade.Spec.VerifyTimeoutSeconds > 0 {
+		timeout = time.Duration(*upgrade.Spec.VerifyTimeoutSeconds) * time.Second
+	}
+	verifyErr := func() error {
+		clientSet, err := r.workloadClientSet(ctx, cluster)
+		if err != nil {
+			return err
+		}
+		current, err := DetectKubeVersion(clientSet)
+		if err != nil {
+			return fmt.Errorf("failed to detect the version: %w", err)
+		}
+		if current.Compare(target) != 0 {
+			return fmt.Errorf("the cluster reports %s", current)
+		}
+		return CheckNodes(ctx, clientSet, target.String())
+	}()
+	if verifyErr != nil {
+		if upgrade.Status.VerifyStartTime != nil && time.Since(upgrade.Status.VerifyStartTime.Time) > timeout {
+			return r.fail(ctx, upgrade, fmt.Sprintf("verification timed out after %s: %v", timeout, verifyErr))
+		}
+		return r.updateStatus(ctx, upgrade, kubeonkubev1alpha1.UpgradeVerifyingPhase, fmt.Sprintf("waiting for %s: %v", target, verifyErr), RequeueAfter)
+	}
+
+	// 记录 Cluster 的版本及历史，之后再置为成功
+	if err := r.RecordClusterVersion(ctx, upgrade, target); err != nil {
+		klog.ErrorS(err, "failed to record cluster version", "upgrade", upgrade.Name, "cluster", cluster.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	now := metav1.Now()
+	upgrade.Status.EndTime = &now
+	return r.updateStatus(ctx, upgrade, kubeonkubev1alpha1.UpgradeSucceededPhase, fmt.Sprintf("the cluster is at %s with every node Ready", target), 0)
+}
+
+// RecordClusterVersion sets status.kubeVersion of the Cluster and appends the upgrade to its version history once.
+func (r *ClusterUpgradeReconciler) RecordClusterVersion(ctx context.Context, upgrade *kubeonkubev1alpha1.ClusterUpgrade, target kubeversion.Version) error {
+	cluster := &kubeonkubev1alpha1.Cluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: upgrade.Spec.Cluster}, cluster); err != nil {
+		return err
+	}
+	history := cluster.Status.VersionHistory
+	if len(history) > 0 && history[len(history)-1].ClusterUpgrade == upgrade.Name {
+		return nil
+	}
+	now := metav1.Now()
+	history = append(history, kubeonkubev1alpha1.ClusterVersionRecord{
+		Version:        target.String(),
+		FromVersion:    upgrade.Status.FromVersion,
+		ClusterUpgrade: upgrade.Name,
+		ClusterOps:     upgrade.Status.UpgradeOps,
+		Time:           &now,
+	})
+	if len(history) > MaxVersionHistory {
+		history = history[len(history)-MaxVersionHistory:]
+	}
+	cluster.Status.VersionHistory = history
+	cluster.Status.KubeVersion = target.String()
+	return r.Client.Status().Update(ctx, cluster)
+}
+
+func (r *ClusterUpgradeReconciler) updateStatus(ctx context.Context, upgrade *kubeonkubev1alpha1.ClusterUpgrade, phase kubeonkubev1alpha1.ClusterUpgradePhase, message string, requeue time.Duration) (ctrl.Result, error) {
+	upgrade.Status.Phase = phase
+	upgrade.Status.Message = message
+	if err := r.Client.Status().Update(ctx, upgrade); err != nil {
+		klog.ErrorS(err, "failed to update cluster upgrade status", "upgrade", upgrade.Name)
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	return ctrl.Result{RequeueAfter: requeue}, nil
+}
+
+func (r *ClusterUpgradeReconciler) fail(ctx context.Context, upgrade *kubeonkubev1alpha1.ClusterUpgrade, message string) (ctrl.Result, error) {
+	klog.Errorf("cluster upgrade %s update status Failed: %s", upgrade.Name, message)
+	now := metav1.Now()
+	upgrade.Status.EndTime = &now
+	return r.updateStatus(ctx, upgrade, kubeonkubev1alpha1.UpgradeFailedPhase, message, 0)
+}
+
+func (r *ClusterUpgradeReconciler) workloadClientSet(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster) (kubernetes.Interface, error) {
+	if r.WorkloadClientSet != nil {
+		return r.WorkloadClientSet(ctx, cluster)
+	}
+	return WorkloadClientSet(ctx, r.Client, cluster)
+}
+
+// PreCheckAction is the precheck playbook of the upgrade, empty when it is disabled.
+func PreCheckAction(upgrade *kubeonkubev1alpha1.ClusterUpgrade) string {
+	if upgrade.Spec.PreCheck == nil {
+		return entrypoint.PreCheckPB
+	}
+	if upgrade.Spec.PreCheck.Disabled {
+		return ""
+	}
+	if len(upgrade.Spec.PreCheck.Action) > 0 {
+		return upgrade.Spec.PreCheck.Action
+	}
+	return entrypoint.PreCheckPB
+}
+
+// UpgradeClusterOpsName is <upgrade>-<phase>.
+func UpgradeClusterOpsName(upgrade *kubeonkubev1alpha1.ClusterUpgrade, phase string) string {
+	return fmt.Sprintf("%s-%s", upgrade.Name, phase)
+}
+
+// IsUpgradeClusterOps reports whether the ClusterOperation is labeled with and owned by the upgrade.
+func IsUpgradeClusterOps(upgrade *kubeonkubev1alpha1.ClusterUpgrade, clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
+	if clusterOps.Labels[UpgradeLabelKey] != upgrade.Name {
+		return false
+	}
+	for _, owner := range clusterOps.OwnerReferences {
+		if owner.Kind == "ClusterUpgrade" && owner.UID == upgrade.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// NewUpgradeClusterOps runs the action with kube_version set to the target, it is owned and retained by the upgrade.
+// It is requested by the creator of the upgrade and is never approved, the approval is made on the ClusterOperation by another user.
+func NewUpgradeClusterOps(upgrade *kubeonkubev1alpha1.ClusterUpgrade, cluster *kubeonkubev1alpha1.Cluster, target kubeversion.Version, name, action string) *kubeonkubev1alpha1.ClusterOperation {
+	extraVars := map[string]apiextensionsv1.JSON{}
+	for key, value := range upgrade.Spec.ExtraVars {
+		extraVars[key] = *value.DeepCopy()
+	}
+	version, _ := json.Marshal(target.String())
+	extraVars[inventory.KubeVersionVar] = apiextensionsv1.JSON{Raw: version}
+	// never pruned by the retention, the upgrade would run it again, it is deleted with the upgrade
+	annotations := map[string]string{RetainAnno: "true"}
+	if requester, ok := upgrade.Annotations[util.RequestedByAnno]; ok {
+		annotations[util.RequestedByAnno] = requester
+	}
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{ClusterLabelKey: cluster.Name, UpgradeLabelKey: upgrade.Name},
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: kubeonkubev1alpha1.SchemeGroupVersion.String(),
+				Kind:       "ClusterUpgrade",
+				Name:       upgrade.Name,
+				UID:        upgrade.UID,
+			}},
+		},
+		Spec: kubeonkubev1alpha1.ClusterOperationSpec{
+			Cluster:    cluster.Name,
+			ActionType: kubeonkubev1alpha1.PlaybookActionType,
+			Action:     action,
+			Image:      upgrade.Status.Image,
+			ExtraVars:  extraVars,
+		},
+	}
+}
+
+// WorkloadClientSet connects to the cluster with the kubeconfig of Cluster.spec.kubeConfRef.
+func WorkloadClientSet(ctx context.Context, reader client.Reader, cluster *kubeonkubev1alpha1.Cluster) (kubernetes.Interface, error) {
+	if cluster.Spec.KubeConfRef.IsEmpty() {
+		return nil, fmt.Errorf("cluster %s has no kubeConfRef to detect and verify the version", cluster.Name)
+	}
+	kubeConf := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: cluster.Spec.KubeConfRef.NameSpace, Name: cluster.Spec.KubeConfRef.Name}, kubeConf); err != nil {
+		return nil, err
+	}
+	data, ok := kubeConf.Data[KubeConfigKey]
+	if !ok && len(kubeConf.Data) == 1 {
+		for _, value := range kubeConf.Data {
+			data = value
+		}
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("configmap %s/%s has no %s", kubeConf.Namespace, kubeConf.Name, KubeConfigKey)
+	}
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	restConfig.Timeout = 10 * time.Second
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// DetectKubeVersion returns the version reported by the API server.
+func DetectKubeVersion(clientSet kubernetes.Interface) (kubeversion.Version, error) {
+	info, err := clientSet.Discovery().ServerVersion()
+	if err != nil {
+		return kubeversion.Version{}, err
+	}
+	return kubeversion.Parse(info.GitVersion)
+}
+
+// CheckNodes returns an error naming the nodes which are not Ready or whose kubelet is not at kubeletVersion, when it is set.
+func CheckNodes(ctx context.Context, clientSet kubernetes.Interface, kubeletVersion string) error {
+	nodes, err := clientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	if len(nodes.Items) == 0 {
+		return fmt.Errorf("the cluster has no nodes")
+	}
+	notReady, outdated := []string{}, []string{}
+	for _, node := range nodes.Items {
+		ready := false
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+				ready = true
+			}
+		}
+		if !ready {
+			notReady = append(notReady, node.Name)
+		}
+		if len(kubeletVersion) > 0 && !kubeversion.Equal(node.Status.NodeInfo.KubeletVersion, kubeletVersion) {
+			outdated = append(outdated, node.Name)
+		}
+	}
+	if len(notReady) > 0 {
+		return fmt.Errorf("nodes %v are not Ready", notReady)
+	}
+	if len(outdated) > 0 {
+		return fmt.Errorf("the kubelet of nodes %v is not at %s", outdated, kubeletVersion)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/kubeversion"
+)
+
+func newTestUpgrade() *kubeonkubev1alpha1.ClusterUpgrade {
+	upgrade := &kubeonkubev1alpha1.ClusterUpgrade{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "to-1-28",
+			UID:         types.UID("upgrade-uid"),
+			Annotations: map[string]string{util.RequestedByAnno: "alice", util.ApprovedByAnno: "alice"},
+		},
+		Spec: kubeonkubev1alpha1.ClusterUpgradeSpec{Cluster: "c1", KubeVersion: "v1.28.6"},
+	}
+	upgrade.Status.Phase = kubeonkubev1alpha1.UpgradeUpgradingPhase
+	upgrade.Status.UpgradeOps = UpgradeClusterOpsName(upgrade, "upgrade")
+	return upgrade
+}
+
+func TestNewUpgradeClusterOpsRequester(t *testing.T) {
+	upgrade := newTestUpgrade()
+	cluster := &kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c1"}}
+	clusterOps := NewUpgradeClusterOps(upgrade, cluster, kubeversion.Version{Major: 1, Minor: 28, Patch: 6}, upgrade.Status.UpgradeOps, "upgrade-cluster.yml")
+	if clusterOps.Annotations[util.RequestedByAnno] != "alice" {
+		t.Errorf("requested-by %q, want the creator of the upgrade", clusterOps.Annotations[util.RequestedByAnno])
+	}
+	if _, ok := clusterOps.Annotations[util.ApprovedByAnno]; ok || clusterOps.Spec.Approved {
+		t.Error("the upgrade clusterOps must not be approved")
+	}
+	if !IsUpgradeClusterOps(upgrade, clusterOps) {
+		t.Error("the upgrade clusterOps must belong to the upgrade")
+	}
+
+	unlabeled := clusterOps.DeepCopy()
+	delete(unlabeled.Labels, UpgradeLabelKey)
+	otherOwner := clusterOps.DeepCopy()
+	otherOwner.OwnerReferences[0].UID = types.UID("other-uid")
+	for _, other := range []*kubeonkubev1alpha1.ClusterOperation{unlabeled, otherOwner} {
+		if IsUpgradeClusterOps(upgrade, other) {
+			t.Errorf("clusterOps labeled %v owned by %v must not belong to the upgrade", other.Labels, other.OwnerReferences)
+		}
+	}
+}
+
+func TestRunClusterOps(t *testing.T) {
+	cluster := &kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c1"}}
+	target := kubeversion.Version{Major: 1, Minor: 28, Patch: 6}
+	run := func(t *testing.T, objs ...client.Object) *kubeonkubev1alpha1.ClusterUpgrade {
+		t.Helper()
+		upgrade := newTestUpgrade()
+		r := &ClusterUpgradeReconciler{Client: newTestClient(t, append(objs, upgrade)...)}
+		if _, err := r.RunClusterOps(context.Background(), upgrade, cluster, target, upgrade.Status.UpgradeOps, kubeonkubev1alpha1.UpgradeVerifyingPhase); err != nil {
+			t.Fatal(err)
+		}
+		return upgrade
+	}
+
+	t.Run("forged", func(t *testing.T) {
+		forged := &kubeonkubev1alpha1.ClusterOperation{ObjectMeta: metav1.ObjectMeta{
+			Name:   UpgradeClusterOpsName(newTestUpgrade(), "upgrade"),
+			Labels: map[string]string{UpgradeLabelKey: "to-1-28"},
+		}}
+		forged.Status.Status = kubeonkubev1alpha1.SucceededStatus
+		upgrade := run(t, forged)
+		if upgrade.Status.Phase != kubeonkubev1alpha1.UpgradeFailedPhase || !strings.Contains(upgrade.Status.Message, "not created by the upgrade") {
+			t.Errorf("got phase %s message %q, want the upgrade failed", upgrade.Status.Phase, upgrade.Status.Message)
+		}
+	})
+
+	t.Run("awaiting approval", func(t *testing.T) {
+		upgrade := newTestUpgrade()
+		clusterOps := NewUpgradeClusterOps(upgrade, cluster, target, upgrade.Status.UpgradeOps, "upgrade-cluster.yml")
+		clusterOps.Status.Status = kubeonkubev1alpha1.AwaitingApprovalStatus
+		upgrade = run(t, clusterOps)
+		if upgrade.Status.Phase != kubeonkubev1alpha1.UpgradeUpgradingPhase || !strings.Contains(upgrade.Status.Message, "awaiting approval") ||
+			!strings.Contains(upgrade.Status.Message, "other than alice") {
+			t.Errorf("got phase %s message %q, want the approval wait", upgrade.Status.Phase, upgrade.Status.Message)
+		}
+	})
+
+	t.Run("succeeded", func(t *testing.T) {
+		upgrade := newTestUpgrade()
+		clusterOps := NewUpgradeClusterOps(upgrade, cluster, target, upgrade.Status.UpgradeOps, "upgrade-cluster.yml")
+		clusterOps.Status.Status = kubeonkubev1alpha1.SucceededStatus
+		upgrade = run(t, clusterOps)
+		if upgrade.Status.Phase != kubeonkubev1alpha1.UpgradeVerifyingPhase {
+			t.Errorf("got phase %s, want %s", upgrade.Status.Phase, kubeonkubev1alpha1.UpgradeVerifyingPhase)
+		}
+	})
+}
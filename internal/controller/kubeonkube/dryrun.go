@@ -0,0 +1,163 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+const (
+	// PromoteAnno on a succeeded dry run creates the real run from it.
+	PromoteAnno = "clay.io/promote"
+	// PromotedFromAnno records the dry run a ClusterOperation was promoted from.
+	PromotedFromAnno = "clay.io/promoted-from"
+	// maxPromotedOpsNamePrefix keeps the Job name kubeonkube-<ops>-promoted-job within 63 characters.
+	maxPromotedOpsNamePrefix = 39
+)
+
+// PromoteDryRun creates the real run of a succeeded dry run annotated with clay.io/promote="true".
+// The real run reuses the backups and the extra vars of the dry run and becomes one of their owners, so it keeps them when the dry run is deleted.
+func (r *ClusterOperationReconciler) PromoteDryRun(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	if !clusterOps.Spec.DryRun || clusterOps.Status.Status != kubeonkubev1alpha1.SucceededStatus ||
+		clusterOps.Annotations[PromoteAnno] != "true" || len(clusterOps.Status.PromotedTo) > 0 {
+		return nil
+	}
+	promoted := NewPromotedClusterOps(clusterOps)
+	if err := r.Client.Create(ctx, promoted); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		if err := r.Client.Get(ctx, client.ObjectKey{Name: promoted.Name}, promoted); err != nil {
+			return err
+		}
+		if promoted.Annotations[PromotedFromAnno] != clusterOps.Name {
+			return fmt.Errorf("clusterOps %s already exists and is not promoted from %s", promoted.Name, clusterOps.Name)
+		}
+	}
+	owner := *metav1.NewControllerRef(promoted, kubeonkubev1alpha1.SchemeGroupVersion.WithKind("ClusterOperation"))
+	owner.Controller = nil
+	configMaps := []*api.ConfigMapRef{promoted.Spec.HostsConfRef, promoted.Spec.VarsConfRef}
+	secrets := []*api.SecretRef{promoted.Spec.SSHAuthRef, promoted.Spec.SecretVarsRef, promoted.Spec.VaultPasswordRef, promoted.Spec.ExtraVarsRef}
+	for _, volume := range promoted.Spec.Volumes {
+		if volume.ConfigMapRef != nil {
+			configMaps = append(configMaps, volume.BackupRef)
+		} else if volume.SecretRef != nil {
+			secrets = append(secrets, volume.BackupRef)
+		}
+	}
+	if backup := promoted.Spec.RunnerBackup; backup != nil {
+		if backup.AnsibleCfgRef != nil {
+			configMaps = append(configMaps, &api.ConfigMapRef{NameSpace: backup.NameSpace, Name: backup.AnsibleCfgRef.Name})
+		}
+		for _, source := range backup.EnvFrom {
+			if source.ConfigMapRef != nil {
+				configMaps = append(configMaps, &api.ConfigMapRef{NameSpace: backup.NameSpace, Name: source.ConfigMapRef.Name})
+			} else if source.SecretRef != nil {
+				secrets = append(secrets, &api.SecretRef{NameSpace: backup.NameSpace, Name: source.SecretRef.Name})
+			}
+		}
+	}
+	if err := r.addBackupOwner(ctx, configMaps, secrets, owner); err != nil {
+		return err
+	}
+	if len(clusterOps.Status.UncheckedHooks) > 0 {
+		klog.Warningf("promote dry run clusterOps %s to %s, its hooks %v were not checked by the dry run", clusterOps.Name, promoted.Name, clusterOps.Status.UncheckedHooks)
+	} else {
+		klog.Infof("promote dry run clusterOps %s to %s", clusterOps.Name, promoted.Name)
+	}
+	clusterOps.Status.PromotedTo = promoted.Name
+	return r.Client.Status().Update(ctx, clusterOps)
+}
+
+// NewPromotedClusterOps copies the spec of the dry run without the dry run, the approval and the rendered entrypoint.
+func NewPromotedClusterOps(dryRun *kubeonkubev1alpha1.ClusterOperation) *kubeonkubev1alpha1.ClusterOperation {
+	spec := dryRun.Spec.DeepCopy()
+	spec.DryRun = false
+	spec.Approved = false
+	spec.EntrypointSHRef = nil
+	prefix := dryRun.Name
+	if len(prefix) > maxPromotedOpsNamePrefix {
+		prefix = strings.TrimRight(prefix[:maxPromotedOpsNamePrefix], "-.")
+	}
+	labels := map[string]string{}
+	for key, value := range dryRun.Labels {
+		// the real run is not part of the history of the schedule
+		if key != ScheduleLabelKey {
+			labels[key] = value
+		}
+	}
+	// the real run is requested by the requester of the dry run rather than the controller, and is approved as usual
+	annotations := map[string]string{PromotedFromAnno: dryRun.Name}
+	if requester, ok := dryRun.Annotations[util.RequestedByAnno]; ok {
+		annotations[util.RequestedByAnno] = requester
+	}
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        prefix + "-promoted",
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *spec,
+	}
+}
+
+// addBackupOwner adds the owner to the backed up ConfigMaps and Secrets.
+func (r *ClusterOperationReconciler) addBackupOwner(ctx context.Context, configMaps []*api.ConfigMapRef, secrets []*api.SecretRef, owner metav1.OwnerReference) error {
+	objects := []client.Object{}
+	for _, ref := range configMaps {
+		if !ref.IsEmpty() {
+			objects = append(objects, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: ref.NameSpace, Name: ref.Name}})
+		}
+	}
+	for _, ref := range secrets {
+		if !ref.IsEmpty() {
+			objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: ref.NameSpace, Name: ref.Name}})
+		}
+	}
+	for _, obj := range objects {
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			return err
+		}
+		owned := false
+		for _, ref := range obj.GetOwnerReferences() {
+			if ref.UID == owner.UID {
+				owned = true
+			}
+		}
+		if owned {
+			continue
+		}
+		obj.SetOwnerReferences(append(obj.GetOwnerReferences(), owner))
+		if err := r.Client.Update(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+)
+
+func newTestDryRun() *kubeonkubev1alpha1.ClusterOperation {
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ops",
+			UID:         "dry-run-uid",
+			Labels:      map[string]string{ScheduleLabelKey: "nightly", "team": "infra"},
+			Annotations: map[string]string{PromoteAnno: "true", util.RequestedByAnno: "alice"},
+		},
+		Spec: kubeonkubev1alpha1.ClusterOperationSpec{
+			Cluster:         "c1",
+			DryRun:          true,
+			Approved:        true,
+			EntrypointSHRef: &api.ConfigMapRef{NameSpace: "ns", Name: "entrypoint"},
+			HostsConfRef:    &api.ConfigMapRef{NameSpace: "ns", Name: "hosts"},
+			SSHAuthRef:      &api.SecretRef{NameSpace: "ns", Name: "ssh"},
+		},
+		Status: kubeonkubev1alpha1.ClusterOperationStatus{Status: kubeonkubev1alpha1.SucceededStatus, DryRun: true},
+	}
+}
+
+func TestNewPromotedClusterOps(t *testing.T) {
+	dryRun := newTestDryRun()
+	promoted := NewPromotedClusterOps(dryRun)
+	if promoted.Name != "ops-promoted" {
+		t.Errorf("name = %s, want ops-promoted", promoted.Name)
+	}
+	if promoted.Spec.DryRun || promoted.Spec.Approved || promoted.Spec.EntrypointSHRef != nil {
+		t.Errorf("spec keeps the dry run, the approval or the entrypoint: %+v", promoted.Spec)
+	}
+	if promoted.Spec.HostsConfRef.Name != "hosts" || promoted.Spec.SSHAuthRef.Name != "ssh" {
+		t.Errorf("spec does not reuse the backups: %+v", promoted.Spec)
+	}
+	if _, ok := promoted.Labels[ScheduleLabelKey]; ok || promoted.Labels["team"] != "infra" {
+		t.Errorf("labels = %v, want the labels without the schedule", promoted.Labels)
+	}
+	if promoted.Annotations[PromotedFromAnno] != "ops" || promoted.Annotations[util.RequestedByAnno] != "alice" {
+		t.Errorf("annotations = %v", promoted.Annotations)
+	}
+	if _, ok := promoted.Annotations[PromoteAnno]; ok {
+		t.Errorf("annotations keep %s", PromoteAnno)
+	}
+	if !dryRun.Spec.DryRun || !dryRun.Spec.Approved || dryRun.Spec.EntrypointSHRef == nil {
+		t.Error("the spec of the dry run is modified")
+	}
+
+	dryRun.Name = strings.Repeat("a", 38) + "-b"
+	if name := NewPromotedClusterOps(dryRun).Name; name != strings.Repeat("a", 38)+"-promoted" {
+		t.Errorf("name = %s, want the prefix trimmed to 38 characters", name)
+	}
+}
+
+func TestPromoteDryRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(dryRun *kubeonkubev1alpha1.ClusterOperation)
+		existing     []client.Object
+		wantPromoted bool
+		wantErr      bool
+	}{
+		{name: "promotes the succeeded dry run", wantPromoted: true},
+		{
+			name:   "ignores the real run",
+			modify: func(dryRun *kubeonkubev1alpha1.ClusterOperation) { dryRun.Spec.DryRun = false },
+		},
+		{
+			name: "ignores the failed dry run",
+			modify: func(dryRun *kubeonkubev1alpha1.ClusterOperation) {
+				dryRun.Status.Status = kubeonkubev1alpha1.FailedStatus
+			},
+		},
+		{
+			name:   "ignores the dry run without the annotation",
+			modify: func(dryRun *kubeonkubev1alpha1.ClusterOperation) { dryRun.Annotations[PromoteAnno] = "false" },
+		},
+		{
+			name:   "ignores the promoted dry run",
+			modify: func(dryRun *kubeonkubev1alpha1.ClusterOperation) { dryRun.Status.PromotedTo = "ops-promoted" },
+		},
+		{
+			name:         "resumes the promotion",
+			existing:     []client.Object{NewPromotedClusterOps(newTestDryRun())},
+			wantPromoted: true,
+		},
+		{
+			name: "refuses a clusterOps promoted from another dry run",
+			existing: []client.Object{&kubeonkubev1alpha1.ClusterOperation{
+				ObjectMeta: metav1.ObjectMeta{Name: "ops-promoted", Annotations: map[string]string{PromotedFromAnno: "other"}},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dryRun := newTestDryRun()
+			if tt.modify != nil {
+				tt.modify(dryRun)
+			}
+			hosts := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "hosts"}}
+			ssh := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "ssh"}}
+			(&ClusterOperationReconciler{}).SetOwnerReferences(&hosts.ObjectMeta, dryRun)
+			(&ClusterOperationReconciler{}).SetOwnerReferences(&ssh.ObjectMeta, dryRun)
+			c := newTestClient(t, append([]client.Object{dryRun, hosts, ssh}, tt.existing...)...)
+			r := &ClusterOperationReconciler{Client: c}
+
+			err := r.PromoteDryRun(ctx, dryRun)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PromoteDryRun() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			promoted := &kubeonkubev1alpha1.ClusterOperation{}
+			getErr := c.Get(ctx, client.ObjectKey{Name: "ops-promoted"}, promoted)
+			if !tt.wantPromoted {
+				if getErr == nil && len(tt.existing) == 0 {
+					t.Error("the dry run is promoted")
+				}
+				return
+			}
+			if getErr != nil {
+				t.Fatal(getErr)
+			}
+			stored := &kubeonkubev1alpha1.ClusterOperation{}
+			if err := c.Get(ctx, client.ObjectKey{Name: "ops"}, stored); err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status.PromotedTo != "ops-promoted" {
+				t.Errorf("status.promotedTo = %q, want ops-promoted", stored.Status.PromotedTo)
+			}
+			for _, obj := range []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}} {
+				name := "hosts"
+				if _, ok := obj.(*corev1.Secret); ok {
+					name = "ssh"
+				}
+				if err := c.Get(ctx, client.ObjectKey{Namespace: "ns", Name: name}, obj); err != nil {
+					t.Fatal(err)
+				}
+				owners := map[string]bool{}
+				for _, ref := range obj.GetOwnerReferences() {
+					owners[ref.Name] = ref.Controller != nil && *ref.Controller
+				}
+				if controller, ok := owners["ops"]; !ok || !controller {
+					t.Errorf("%s owners = %v, want the dry run to stay the controller", name, obj.GetOwnerReferences())
+				}
+				if controller, ok := owners["ops-promoted"]; !ok || controller {
+					t.Errorf("%s owners = %v, want the promoted clusterOps as a non-controller owner", name, obj.GetOwnerReferences())
+				}
+			}
+		})
+	}
+}
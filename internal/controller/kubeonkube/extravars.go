@@ -0,0 +1,130 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+const (
+	// ExtraVarsKey is the key of the extra vars file in its Secret.
+	ExtraVarsKey = "extra-vars.yml"
+	// SecretVarsKey is the key of the vars file in the Secret of Cluster.spec.secretVarsRef.
+	SecretVarsKey = "secret-vars.yml"
+	// VaultPasswordKey is the key of the password in the Secret of Cluster.spec.vaultPasswordRef.
+	VaultPasswordKey = "vault-password"
+)
+
+// HasExtraVars reports whether the ClusterOperation passes extra vars to its playbooks.
+func HasExtraVars(clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
+	return len(clusterOps.Spec.ExtraVars) > 0 || len(clusterOps.Spec.ExtraVarsFrom) > 0
+}
+
+// ExtraVarsSecretName is the Secret holding the extra vars file of the ClusterOperation.
+func ExtraVarsSecretName(clusterOps *kubeonkubev1alpha1.ClusterOperation) string {
+	return fmt.Sprintf("%s-extra-vars", clusterOps.Name)
+}
+
+// ResolveExtraVars merges the sources in order and then spec.extraVars, the values of spec.extraVars keep their JSON types.
+func (r *ClusterOperationReconciler) ResolveExtraVars(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, source := range clusterOps.Spec.ExtraVarsFrom {
+		if !source.ConfigMapRef.IsEmpty() {
+			configMap := &corev1.ConfigMap{}
+			if err := r.Client.Get(ctx, client.ObjectKey{Namespace: source.ConfigMapRef.NameSpace, Name: source.ConfigMapRef.Name}, configMap); err != nil {
+				return nil, err
+			}
+			for key, value := range configMap.Data {
+				vars[key] = value
+			}
+		}
+		if !source.SecretRef.IsEmpty() {
+			secret := &corev1.Secret{}
+			if err := r.Client.Get(ctx, client.ObjectKey{Namespace: source.SecretRef.NameSpace, Name: source.SecretRef.Name}, secret); err != nil {
+				return nil, err
+			}
+			for key, value := range secret.Data {
+				vars[key] = string(value)
+			}
+		}
+	}
+	for key, value := range clusterOps.Spec.ExtraVars {
+		var decoded interface{}
+		if err := json.Unmarshal(value.Raw, &decoded); err != nil {
+			return nil, fmt.Errorf("invalid extraVars %s: %w", key, err)
+		}
+		vars[key] = decoded
+	}
+	return vars, nil
+}
+
+// CreateExtraVarsSecret writes the resolved extra vars into a Secret mounted by the Job, the sources may hold secrets.
+func (r *ClusterOperationReconciler) CreateExtraVarsSecret(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+	if !clusterOps.Spec.ExtraVarsRef.IsEmpty() || !HasExtraVars(clusterOps) {
+		return false, nil
+	}
+	vars, err := r.ResolveExtraVars(ctx, clusterOps)
+	if err != nil {
+		return false, err
+	}
+	data, err := yaml.Marshal(vars)
+	if err != nil {
+		return false, err
+	}
+	newSecret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ExtraVarsSecretName(clusterOps),
+			Namespace: r.OperationsNamespace(clusterOps),
+		},
+		Data: map[string][]byte{ExtraVarsKey: data},
+	}
+	r.SetOwnerReferences(&newSecret.ObjectMeta, clusterOps)
+	err = r.Client.Create(ctx, newSecret)
+	if apierrors.IsAlreadyExists(err) {
+		klog.Warningf("extra vars secret %s already exist and update it.", newSecret.Name)
+		if err := r.Client.Update(ctx, newSecret); err != nil {
+			return false, err
+		}
+	} else if err != nil {
+		return false, err
+	}
+	clusterOps.Spec.ExtraVarsRef = &api.SecretRef{
+		NameSpace: newSecret.Namespace,
+		Name:      newSecret.Name,
+	}
+	if err := r.Client.Update(ctx, clusterOps); err != nil {
+		return false, err
+	}
+	return true, nil
+}
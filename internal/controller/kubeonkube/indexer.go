@@ -0,0 +1,61 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// ClusterOpsClusterField indexes ClusterOperations by spec.cluster.
+const ClusterOpsClusterField = "spec.cluster"
+
+// SetupIndexers registers the cache indexes shared by the reconcilers. It must be called before the manager starts.
+func SetupIndexers(ctx context.Context, mgr ctrl.Manager) error {
+	return mgr.GetFieldIndexer().IndexField(ctx, &kubeonkubev1alpha1.ClusterOperation{}, ClusterOpsClusterField, clusterOpsClusterIndex)
+}
+
+func clusterOpsClusterIndex(obj client.Object) []string {
+	clusterOps, ok := obj.(*kubeonkubev1alpha1.ClusterOperation)
+	if !ok || len(clusterOps.Spec.Cluster) == 0 {
+		return nil
+	}
+	return []string{clusterOps.Spec.Cluster}
+}
+
+// ListClusterOperations lists the ClusterOperations of the cluster from the informer cache.
+func ListClusterOperations(ctx context.Context, c client.Client, clusterName string) ([]kubeonkubev1alpha1.ClusterOperation, error) {
+	clusterOpsList := &kubeonkubev1alpha1.ClusterOperationList{}
+	if err := c.List(ctx, clusterOpsList, client.MatchingFields{ClusterOpsClusterField: clusterName}); err != nil {
+		return nil, err
+	}
+	return clusterOpsList.Items, nil
+}
+
+// clusterOpsToCluster maps a ClusterOperation event to a request for the Cluster it belongs to.
+func clusterOpsToCluster(obj client.Object) []reconcile.Request {
+	clusterOps, ok := obj.(*kubeonkubev1alpha1.ClusterOperation)
+	if !ok || len(clusterOps.Spec.Cluster) == 0 {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: clusterOps.Spec.Cluster}}}
+}
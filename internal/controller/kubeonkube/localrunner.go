@@ -0,0 +1,388 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// LocalRunnerLogFile is the output of a local run in its directory.
+const LocalRunnerLogFile = "output.log"
+
+// LocalRunner runs the entrypoint of the Job on the controller host, for development and tests only.
+// The ConfigMaps and Secrets mounted by the Job are written into the directory of the run and the paths of
+// the entrypoint are rewritten to it, the runs are lost when the controller restarts.
+type LocalRunner struct {
+	Client client.Client
+	// WorkDir holds a directory for each run.
+	WorkDir string
+	// KubesprayDir replaces /kubespray of the runner image, it is kept when empty.
+	KubesprayDir string
+
+	lock sync.Mutex
+	// runs are keyed by the name of the Job, it is unique as the ClusterOperations are cluster scoped.
+	runs map[string]*localRun
+}
+
+type localRun struct {
+	dir            string
+	cancel         context.CancelFunc
+	status         kubeonkubev1alpha1.OpsStatus
+	completionTime *metav1.Time
+}
+
+func NewLocalRunner(c client.Client, workDir, kubesprayDir string) *LocalRunner {
+	return &LocalRunner{Client: c, WorkDir: workDir, KubesprayDir: kubesprayDir, runs: map[string]*localRun{}}
+}
+
+// Check rejects the PersistentVolumeClaim volumes and the env read from the fields of the pod, which do not exist on the controller host.
+func (l *LocalRunner) Check(clusterOps *kubeonkubev1alpha1.ClusterOperation, runner kubeonkubev1alpha1.RunnerPodSpec) error {
+	for _, volume := range clusterOps.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			return fmt.Errorf("the local runner does not support the persistentVolumeClaim of volume %q, use the job runner", volume.Name)
+		}
+	}
+	for _, env := range runner.Env {
+		if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef == nil && env.ValueFrom.SecretKeyRef == nil {
+			return fmt.Errorf("the local runner only supports the env %s from a configMapKeyRef or a secretKeyRef, use the job runner", env.Name)
+		}
+	}
+	return nil
+}
+
+func (l *LocalRunner) Start(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, job *batchv1.Job) error {
+	key := job.Name
+	l.lock.Lock()
+	_, ok := l.runs[key]
+	l.lock.Unlock()
+	if ok {
+		return nil
+	}
+	var container *corev1.Container
+	for i := range job.Spec.Template.Spec.Containers {
+		if job.Spec.Template.Spec.Containers[i].Name == SprayJobPodName {
+			container = &job.Spec.Template.Spec.Containers[i]
+		}
+	}
+	if container == nil {
+		return fmt.Errorf("job %s has no container %s", job.Name, SprayJobPodName)
+	}
+	dir := filepath.Join(l.WorkDir, job.Namespace, job.Name)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	localize := l.localizer(dir)
+	if err := l.writeMounts(ctx, job, container, dir); err != nil {
+		return err
+	}
+	script, err := os.ReadFile(filepath.Join(dir, "bin", "entrypoint.sh"))
+	if err != nil {
+		return err
+	}
+	scriptPath := filepath.Join(dir, "entrypoint.sh")
+	if err := os.WriteFile(scriptPath, []byte(localize.Replace(string(script))), 0o700); err != nil {
+		return err
+	}
+	output, err := os.Create(filepath.Join(dir, LocalRunnerLogFile))
+	if err != nil {
+		return err
+	}
+
+	vars, err := l.resolveEnv(ctx, job.Namespace, container)
+	if err != nil {
+		output.Close()
+		return err
+	}
+	env := os.Environ()
+	for _, e := range vars {
+		env = append(env, fmt.Sprintf("%s=%s", e.Name, localize.Replace(e.Value)))
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	if job.Spec.ActiveDeadlineSeconds != nil {
+		runCtx, cancel = context.WithTimeout(context.Background(), time.Duration(*job.Spec.ActiveDeadlineSeconds)*time.Second)
+	}
+	cmd := exec.CommandContext(runCtx, "/bin/bash", scriptPath)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		cancel()
+		output.Close()
+		return err
+	}
+	klog.Warningf("start local run %s for kubeonkubeClusterOp %s", dir, clusterOps.Name)
+	run := &localRun{dir: dir, cancel: cancel, status: kubeonkubev1alpha1.RunningStatus}
+	l.lock.Lock()
+	l.runs[key] = run
+	l.lock.Unlock()
+	go func() {
+		err := cmd.Wait()
+		cancel()
+		output.Close()
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		run.status = kubeonkubev1alpha1.SucceededStatus
+		if err != nil {
+			klog.Errorf("local run %s of kubeonkubeClusterOp %s failed: %v", dir, clusterOps.Name, err)
+			run.status = kubeonkubev1alpha1.FailedStatus
+		}
+		run.completionTime = &metav1.Time{Time: time.Now()}
+	}()
+	return nil
+}
+
+// localizer rewrites the paths of the runner image to the directory of the run.
+func (l *LocalRunner) localizer(dir string) *strings.Replacer {
+	pairs := []string{}
+	for _, reserved := range []string{"/conf/", "/auth/"} {
+		pairs = append(pairs, reserved, filepath.Join(dir, reserved)+"/")
+	}
+	if len(l.KubesprayDir) > 0 {
+		pairs = append(pairs, "/kubespray/", strings.TrimSuffix(l.KubesprayDir, "/")+"/")
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// writeMounts writes the ConfigMaps and Secrets mounted by the container under dir, the emptyDirs are created empty.
+func (l *LocalRunner) writeMounts(ctx context.Context, job *batchv1.Job, container *corev1.Container, dir string) error {
+	volumes := map[string]corev1.Volume{}
+	for _, volume := range job.Spec.Template.Spec.Volumes {
+		volumes[volume.Name] = volume
+	}
+	for _, mount := range container.VolumeMounts {
+		volume, ok := volumes[mount.Name]
+		if !ok {
+			return fmt.Errorf("volumeMount %s refers to no volume", mount.Name)
+		}
+		data := map[string][]byte{}
+		switch {
+		case volume.ConfigMap != nil:
+			configMap := &corev1.ConfigMap{}
+			if err := l.Client.Get(ctx, client.ObjectKey{Namespace: job.Namespace, Name: volume.ConfigMap.Name}, configMap); err != nil {
+				return err
+			}
+			for key, value := range configMap.Data {
+				data[key] = []byte(value)
+			}
+			for key, value := range configMap.BinaryData {
+				data[key] = value
+			}
+		case volume.Secret != nil:
+			secret := &corev1.Secret{}
+			if err := l.Client.Get(ctx, client.ObjectKey{Namespace: job.Namespace, Name: volume.Secret.SecretName}, secret); err != nil {
+				return err
+			}
+			data = secret.Data
+		case volume.EmptyDir != nil:
+		default:
+			return fmt.Errorf("local runner does not support volume %s", volume.Name)
+		}
+		target := filepath.Join(dir, mount.MountPath)
+		if len(mount.SubPath) > 0 {
+			value, ok := data[mount.SubPath]
+			if !ok {
+				return fmt.Errorf("volume %s has no key %s", volume.Name, mount.SubPath)
+			}
+			if err := writeLocalFile(target, value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(target, 0o700); err != nil {
+			return err
+		}
+		for key, value := range data {
+			if err := writeLocalFile(filepath.Join(target, key), value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveEnv reads the envFrom sources and then the env of the container like the kubelet, the env overrides the sources.
+func (l *LocalRunner) resolveEnv(ctx context.Context, namespace string, container *corev1.Container) ([]corev1.EnvVar, error) {
+	env := []corev1.EnvVar{}
+	for _, source := range container.EnvFrom {
+		data := map[string]string{}
+		switch {
+		case source.ConfigMapRef != nil:
+			configMap := &corev1.ConfigMap{}
+			err := l.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: source.ConfigMapRef.Name}, configMap)
+			if apierrors.IsNotFound(err) && source.ConfigMapRef.Optional != nil && *source.ConfigMapRef.Optional {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			data = configMap.Data
+		case source.SecretRef != nil:
+			secret := &corev1.Secret{}
+			err := l.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: source.SecretRef.Name}, secret)
+			if apierrors.IsNotFound(err) && source.SecretRef.Optional != nil && *source.SecretRef.Optional {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			for key, value := range secret.Data {
+				data[key] = string(value)
+			}
+		}
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			env = append(env, corev1.EnvVar{Name: source.Prefix + key, Value: data[key]})
+		}
+	}
+	for _, e := range container.Env {
+		if e.ValueFrom == nil {
+			env = append(env, e)
+			continue
+		}
+		value, ok, err := l.resolveEnvValue(ctx, namespace, e.ValueFrom)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", e.Name, err)
+		}
+		if ok {
+			env = append(env, corev1.EnvVar{Name: e.Name, Value: value})
+		}
+	}
+	return env, nil
+}
+
+// resolveEnvValue reads the key of a configMapKeyRef or a secretKeyRef, a missing optional key is skipped.
+func (l *LocalRunner) resolveEnvValue(ctx context.Context, namespace string, valueFrom *corev1.EnvVarSource) (string, bool, error) {
+	switch {
+	case valueFrom.ConfigMapKeyRef != nil:
+		ref := valueFrom.ConfigMapKeyRef
+		optional := ref.Optional != nil && *ref.Optional
+		configMap := &corev1.ConfigMap{}
+		if err := l.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, configMap); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		value, ok := configMap.Data[ref.Key]
+		if !ok && !optional {
+			return "", false, fmt.Errorf("configmap %s has no key %s", ref.Name, ref.Key)
+		}
+		return value, ok, nil
+	case valueFrom.SecretKeyRef != nil:
+		ref := valueFrom.SecretKeyRef
+		optional := ref.Optional != nil && *ref.Optional
+		secret := &corev1.Secret{}
+		if err := l.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok && !optional {
+			return "", false, fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+		}
+		return string(value), ok, nil
+	}
+	return "", false, fmt.Errorf("local runner only supports configMapKeyRef and secretKeyRef")
+}
+
+func writeLocalFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+		return err
+	}
+	// the ssh private key must not be readable by others.
+	return os.WriteFile(name, data, 0o600)
+}
+
+func (l *LocalRunner) Status(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (kubeonkubev1alpha1.OpsStatus, *metav1.Time, error) {
+	if clusterOps.Status.JobRef.IsEmpty() {
+		return "", nil, fmt.Errorf("clusterOps %s no job", clusterOps.Name)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	run, ok := l.runs[clusterOps.Status.JobRef.Name]
+	if !ok {
+		// the run is lost with the restart of the controller.
+		klog.Errorf("clusterOps %s  local run %s not found", clusterOps.Name, clusterOps.Status.JobRef.Name)
+		return kubeonkubev1alpha1.FailedStatus, nil, nil
+	}
+	return run.status, run.completionTime, nil
+}
+
+func (l *LocalRunner) Logs(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (string, error) {
+	if clusterOps.Status.JobRef.IsEmpty() {
+		return "", fmt.Errorf("clusterOps %s no job", clusterOps.Name)
+	}
+	name := filepath.Join(l.WorkDir, clusterOps.Status.JobRef.NameSpace, clusterOps.Status.JobRef.Name, LocalRunnerLogFile)
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	// keep the tail like the limited pod logs.
+	if info.Size() > archive.DefaultLogLimitBytes {
+		if _, err := file.Seek(info.Size()-archive.DefaultLogLimitBytes, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(file, archive.DefaultLogLimitBytes))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Cancel kills the process of the run, its status becomes Failed.
+func (l *LocalRunner) Cancel(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	if clusterOps.Status.JobRef.IsEmpty() {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if run, ok := l.runs[clusterOps.Status.JobRef.Name]; ok {
+		run.cancel()
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+func TestLocalRunnerCheck(t *testing.T) {
+	l := NewLocalRunner(nil, t.TempDir(), "")
+	clusterOps := &kubeonkubev1alpha1.ClusterOperation{}
+	clusterOps.Spec.Volumes = []kubeonkubev1alpha1.RunnerVolume{{Name: "cache", EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	runner := kubeonkubev1alpha1.RunnerPodSpec{
+		Env: []corev1.EnvVar{
+			{Name: "A", Value: "a"},
+			{Name: "B", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "b"}}},
+		},
+		EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{}}},
+	}
+	if err := l.Check(clusterOps, runner); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	fieldRef := *runner.DeepCopy()
+	fieldRef.Env = append(fieldRef.Env, corev1.EnvVar{Name: "NODE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}})
+	if err := l.Check(clusterOps, fieldRef); err == nil || !strings.Contains(err.Error(), "NODE") {
+		t.Errorf("got %v, want the fieldRef env rejected", err)
+	}
+
+	claim := clusterOps.DeepCopy()
+	claim.Spec.Volumes = append(claim.Spec.Volumes, kubeonkubev1alpha1.RunnerVolume{
+		Name: "repo", PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "repo"},
+	})
+	if err := l.Check(claim, runner); err == nil || !strings.Contains(err.Error(), `"repo"`) {
+		t.Errorf("got %v, want the persistentVolumeClaim rejected", err)
+	}
+	if err := (&JobRunner{}).Check(claim, fieldRef); err != nil {
+		t.Errorf("job runner: unexpected error: %v", err)
+	}
+}
+
+func TestLocalRunnerResolveEnv(t *testing.T) {
+	optional := true
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ops-ns", Name: "proxy"},
+		Data:       map[string]string{"NO_PROXY": ".svc", "HTTP_PROXY": "http://proxy"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ops-ns", Name: "token"},
+		Data:       map[string][]byte{"TOKEN": []byte("secret")},
+	}
+	l := NewLocalRunner(newTestClient(t, configMap, secret), t.TempDir(), "")
+	container := &corev1.Container{
+		EnvFrom: []corev1.EnvFromSource{
+			{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "proxy"}}},
+			{Prefix: "X_", SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "token"}}},
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Optional: &optional}},
+		},
+		Env: []corev1.EnvVar{
+			{Name: "NO_PROXY", Value: ".local"},
+			{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "token"}, Key: "TOKEN",
+			}}},
+			{Name: "SKIPPED", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "proxy"}, Key: "missing", Optional: &optional,
+			}}},
+		},
+	}
+	env, err := l.resolveEnv(context.Background(), "ops-ns", container)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []corev1.EnvVar{
+		{Name: "HTTP_PROXY", Value: "http://proxy"},
+		{Name: "NO_PROXY", Value: ".svc"},
+		{Name: "X_TOKEN", Value: "secret"},
+		{Name: "NO_PROXY", Value: ".local"},
+		{Name: "TOKEN", Value: "secret"},
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("got %v, want %v", env, want)
+	}
+
+	container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+		ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}},
+	})
+	if _, err := l.resolveEnv(context.Background(), "ops-ns", container); err == nil {
+		t.Errorf("want an error for the missing configmap")
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/cron"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/entrypoint"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// MaintenanceOverrideAnno starts a disruptive ClusterOperation outside the maintenance windows, for emergencies.
+const MaintenanceOverrideAnno = "clay.io/maintenance-override"
+
+// DefaultDisruptiveActions are the playbooks held by the maintenance windows when the Cluster lists none.
+var DefaultDisruptiveActions = []string{entrypoint.ClusterPB, entrypoint.UpgradeClusterPB, entrypoint.ScalePB, entrypoint.ResetPB}
+
+// IsDisruptiveClusterOps reports whether the ClusterOperation must wait for a maintenance window of the Cluster,
+// i.e. its action or any of its hook actions is disruptive.
+func IsDisruptiveClusterOps(cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
+	maintenance := cluster.Spec.Maintenance
+	if maintenance == nil || len(maintenance.Windows) == 0 {
+		return false
+	}
+	if clusterOps.Spec.DryRun || clusterOps.Annotations[MaintenanceOverrideAnno] == "true" {
+		return false
+	}
+	actions := maintenance.DisruptiveActions
+	if len(actions) == 0 {
+		actions = DefaultDisruptiveActions
+	}
+	// 钩子中的 playbook 同样具有破坏性
+	for _, action := range clusterOps.Spec.Actions() {
+		if contains(actions, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaintenanceWindowOpen reports whether one of the windows is open at now, otherwise when the next one opens.
+func MaintenanceWindowOpen(windows []kubeonkubev1alpha1.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	var next time.Time
+	for i := range windows {
+		window := &windows[i]
+		schedule, err := cron.Parse(window.Schedule)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid maintenance window %q: %w", window.Schedule, err)
+		}
+		location := time.Local
+		if window.TimeZone != nil && len(*window.TimeZone) > 0 {
+			if location, err = time.LoadLocation(*window.TimeZone); err != nil {
+				return false, time.Time{}, fmt.Errorf("invalid maintenance window time zone: %w", err)
+			}
+		}
+		local := now.In(location)
+		// 窗口在 (now - duration, now] 之间开启过，说明当前仍在窗口内
+		if window.Duration.Duration > 0 {
+			if start := schedule.Next(local.Add(-window.Duration.Duration)); !start.IsZero() && !start.After(local) {
+				return true, time.Time{}, nil
+			}
+		}
+		if start := schedule.Next(local); !start.IsZero() && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return false, next, nil
+}
+
+func nextWindowTimeEqual(current *metav1.Time, next time.Time) bool {
+	if current == nil {
+		return next.IsZero()
+	}
+	return current.Time.Equal(next)
+}
+
+// waitingClusterOps maps a Cluster event to its Waiting ClusterOperations, so a change of the windows applies at once.
+func (r *ClusterOperationReconciler) waitingClusterOps(obj client.Object) []reconcile.Request {
+	clusterOpsList, err := ListClusterOperations(context.Background(), r.Client, obj.GetName())
+	if err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, item := range clusterOpsList {
+		if item.Status.Status == kubeonkubev1alpha1.WaitingStatus {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Name: item.Name}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+func TestIsDisruptiveClusterOps(t *testing.T) {
+	windows := []kubeonkubev1alpha1.MaintenanceWindow{{Schedule: "0 22 * * 6", Duration: metav1.Duration{Duration: 4 * time.Hour}}}
+	newClusterOps := func(action string, hooks ...string) *kubeonkubev1alpha1.ClusterOperation {
+		clusterOps := &kubeonkubev1alpha1.ClusterOperation{Spec: kubeonkubev1alpha1.ClusterOperationSpec{Action: action}}
+		for _, hook := range hooks {
+			clusterOps.Spec.PreHook = append(clusterOps.Spec.PreHook, kubeonkubev1alpha1.HookAction{Action: hook})
+		}
+		return clusterOps
+	}
+	dryRun := newClusterOps("upgrade-cluster.yml")
+	dryRun.Spec.DryRun = true
+	override := newClusterOps("upgrade-cluster.yml")
+	override.Annotations = map[string]string{MaintenanceOverrideAnno: "true"}
+	tests := []struct {
+		name        string
+		maintenance *kubeonkubev1alpha1.MaintenancePolicy
+		clusterOps  *kubeonkubev1alpha1.ClusterOperation
+		want        bool
+	}{
+		{name: "no maintenance", clusterOps: newClusterOps("upgrade-cluster.yml")},
+		{name: "no windows", maintenance: &kubeonkubev1alpha1.MaintenancePolicy{}, clusterOps: newClusterOps("upgrade-cluster.yml")},
+		{name: "default disruptive action", maintenance: &kubeonkubev1alpha1.MaintenancePolicy{Windows: windows}, clusterOps: newClusterOps("upgrade-cluster.yml"), want: true},
+		{name: "harmless action", maintenance: &kubeonkubev1alpha1.MaintenancePolicy{Windows: windows}, clusterOps: newClusterOps("precheck.yml")},
+		{name: "disruptive hook", maintenance: &kubeonkubev1alpha1.MaintenancePolicy{Windows: windows}, clusterOps: newClusterOps("precheck.yml", "reset.yml"), want: true},
+		{
+			name:        "custom disruptive actions",
+			maintenance: &kubeonkubev1alpha1.MaintenancePolicy{Windows: windows, DisruptiveActions: []string{"reboot.yml"}},
+			clusterOps:  newClusterOps("reboot.yml"),
+			want:        true,
+		},
+		{
+			name:        "custom disruptive actions replace the defaults",
+			maintenance: &kubeonkubev1alpha1.MaintenancePolicy{Windows: windows, DisruptiveActions: []string{"reboot.yml"}},
+			clusterOps:  newClusterOps("upgrade-cluster.yml"),
+		},
+		{name: "dry run", maintenance: &kubeonkubev1alpha1.MaintenancePolicy{Windows: windows}, clusterOps: dryRun},
+		{name: "override", maintenance: &kubeonkubev1alpha1.MaintenancePolicy{Windows: windows}, clusterOps: override},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &kubeonkubev1alpha1.Cluster{Spec: kubeonkubev1alpha1.ClusterSpec{Maintenance: tt.maintenance}}
+			if got := IsDisruptiveClusterOps(cluster, tt.clusterOps); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowOpen(t *testing.T) {
+	shanghai := "Asia/Shanghai"
+	invalidZone := "Mars/Olympus"
+	// Saturday 22:00 UTC to Sunday 02:00 UTC
+	utc := "UTC"
+	saturday := kubeonkubev1alpha1.MaintenanceWindow{Schedule: "0 22 * * 6", Duration: metav1.Duration{Duration: 4 * time.Hour}, TimeZone: &utc}
+	nextSaturday := time.Date(2024, 1, 6, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		windows  []kubeonkubev1alpha1.MaintenanceWindow
+		now      time.Time
+		wantOpen bool
+		wantNext time.Time
+		wantErr  string
+	}{
+		{name: "no windows", now: created},
+		{name: "before the window", windows: []kubeonkubev1alpha1.MaintenanceWindow{saturday}, now: time.Date(2024, 1, 6, 21, 0, 0, 0, time.UTC), wantNext: nextSaturday},
+		{name: "opening", windows: []kubeonkubev1alpha1.MaintenanceWindow{saturday}, now: nextSaturday, wantOpen: true},
+		{name: "inside across midnight", windows: []kubeonkubev1alpha1.MaintenanceWindow{saturday}, now: time.Date(2024, 1, 7, 1, 59, 0, 0, time.UTC), wantOpen: true},
+		{
+			name:     "closed",
+			windows:  []kubeonkubev1alpha1.MaintenanceWindow{saturday},
+			now:      time.Date(2024, 1, 7, 2, 0, 0, 0, time.UTC),
+			wantNext: nextSaturday.AddDate(0, 0, 7),
+		},
+		{
+			name: "earliest of the windows",
+			windows: []kubeonkubev1alpha1.MaintenanceWindow{
+				saturday,
+				// 02:00 in Shanghai is 18:00 UTC of the previous day
+				{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: &shanghai},
+			},
+			now:      time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2024, 1, 6, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "invalid schedule",
+			windows: []kubeonkubev1alpha1.MaintenanceWindow{{Schedule: "bogus", Duration: metav1.Duration{Duration: time.Hour}}},
+			now:     created,
+			wantErr: "invalid maintenance window",
+		},
+		{
+			name:    "invalid time zone",
+			windows: []kubeonkubev1alpha1.MaintenanceWindow{{Schedule: "0 22 * * 6", Duration: metav1.Duration{Duration: time.Hour}, TimeZone: &invalidZone}},
+			now:     created,
+			wantErr: "invalid maintenance window time zone",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, next, err := MaintenanceWindowOpen(tt.windows, tt.now)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if open != tt.wantOpen || !next.Equal(tt.wantNext) {
+				t.Errorf("got open %v next %v, want open %v next %v", open, next, tt.wantOpen, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestNextWindowTimeEqual(t *testing.T) {
+	if !nextWindowTimeEqual(nil, time.Time{}) || nextWindowTimeEqual(nil, created) {
+		t.Error("no time recorded only equals no next window")
+	}
+	if !nextWindowTimeEqual(&metav1.Time{Time: created}, created.In(time.FixedZone("UTC+8", 8*3600))) {
+		t.Error("the same instant in another zone is equal")
+	}
+}
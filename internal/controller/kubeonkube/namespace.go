@@ -0,0 +1,152 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// ClusterOperationsNamespace is the operations namespace of the Cluster, the jobNamespace of the config by default.
+func (r *ClusterOperationReconciler) ClusterOperationsNamespace(cluster *kubeonkubev1alpha1.Cluster) string {
+	if cluster != nil && len(cluster.Spec.OperationsNamespace) > 0 {
+		return cluster.Spec.OperationsNamespace
+	}
+	return r.Config.Get().Namespace()
+}
+
+// OperationsNamespace is the namespace pinned on the ClusterOperation, the jobNamespace of the config before it is pinned.
+func (r *ClusterOperationReconciler) OperationsNamespace(clusterOps *kubeonkubev1alpha1.ClusterOperation) string {
+	if len(clusterOps.Status.OperationsNamespace) > 0 {
+		return clusterOps.Status.OperationsNamespace
+	}
+	return r.Config.Get().Namespace()
+}
+
+// UpdateStatusOperationsNamespace pins the operations namespace of the Cluster on the ClusterOperation,
+// a ClusterOperation whose Job was created before keeps the namespace of its Job.
+func (r *ClusterOperationReconciler) UpdateStatusOperationsNamespace(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+	if len(clusterOps.Status.OperationsNamespace) > 0 {
+		return false, nil
+	}
+	clusterOps.Status.OperationsNamespace = r.ClusterOperationsNamespace(cluster)
+	if !clusterOps.Status.JobRef.IsEmpty() && len(clusterOps.Status.JobRef.NameSpace) > 0 {
+		clusterOps.Status.OperationsNamespace = clusterOps.Status.JobRef.NameSpace
+	}
+	if err := r.Client.Status().Update(ctx, clusterOps); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MigrateDataRef copies the data mounted by the Job into the operations namespace one at a time, such as the backups
+// made before the namespace was pinned or changed, the Job mounts them by name in its own namespace.
+func (r *ClusterOperationReconciler) MigrateDataRef(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+	if !clusterOps.Status.JobRef.IsEmpty() {
+		return false, nil
+	}
+	namespace := r.OperationsNamespace(clusterOps)
+	configMapRefs := []*api.ConfigMapRef{clusterOps.Spec.HostsConfRef, clusterOps.Spec.VarsConfRef, clusterOps.Spec.EntrypointSHRef}
+	secretRefs := []*api.SecretRef{clusterOps.Spec.SSHAuthRef, clusterOps.Spec.SecretVarsRef, clusterOps.Spec.VaultPasswordRef, clusterOps.Spec.ExtraVarsRef}
+	for _, volume := range clusterOps.Spec.Volumes {
+		if volume.ConfigMapRef != nil {
+			configMapRefs = append(configMapRefs, volume.BackupRef)
+		} else if volume.SecretRef != nil {
+			secretRefs = append(secretRefs, volume.BackupRef)
+		}
+	}
+	for _, ref := range configMapRefs {
+		if ref.IsEmpty() || ref.NameSpace == namespace {
+			continue
+		}
+		klog.Warningf("clusterOps %s migrates configmap %s/%s to namespace %s", clusterOps.Name, ref.NameSpace, ref.Name, namespace)
+		name, err := r.MigrateConfigMap(ctx, clusterOps, ref, namespace)
+		if err != nil {
+			return false, err
+		}
+		ref.NameSpace, ref.Name = namespace, name
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	for _, ref := range secretRefs {
+		if ref.IsEmpty() || ref.NameSpace == namespace {
+			continue
+		}
+		klog.Warningf("clusterOps %s migrates secret %s/%s to namespace %s", clusterOps.Name, ref.NameSpace, ref.Name, namespace)
+		name, err := r.MigrateSecret(ctx, clusterOps, ref, namespace)
+		if err != nil {
+			return false, err
+		}
+		ref.NameSpace, ref.Name = namespace, name
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// MigrateConfigMap copies the ConfigMap into the namespace under the same name and returns the name of the copy.
+// A ConfigMap of the same name is reused only when it is controlled by the ClusterOperation, such as the copy of an
+// interrupted migration, otherwise the ConfigMap is copied under a unique name.
+func (r *ClusterOperationReconciler) MigrateConfigMap(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, ref *api.ConfigMapRef, namespace string) (string, error) {
+	existing := &corev1.ConfigMap{}
+	name := ref.Name
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, existing); err == nil {
+		if metav1.IsControlledBy(existing, clusterOps) {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", ref.Name, time.Now().UnixMilli())
+	} else if !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	if _, err := r.CopyConfigMap(ctx, clusterOps, ref, name, namespace); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// MigrateSecret copies the Secret into the namespace like MigrateConfigMap.
+func (r *ClusterOperationReconciler) MigrateSecret(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation, ref *api.SecretRef, namespace string) (string, error) {
+	existing := &corev1.Secret{}
+	name := ref.Name
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, existing); err == nil {
+		if metav1.IsControlledBy(existing, clusterOps) {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", ref.Name, time.Now().UnixMilli())
+	} else if !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	if _, err := r.CopySecret(ctx, clusterOps, ref, name, namespace); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+func TestMigrateDataRef(t *testing.T) {
+	newClusterOps := func() *kubeonkubev1alpha1.ClusterOperation {
+		return &kubeonkubev1alpha1.ClusterOperation{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops", UID: "uid"},
+			Spec: kubeonkubev1alpha1.ClusterOperationSpec{
+				HostsConfRef: &api.ConfigMapRef{NameSpace: "old-ns", Name: "hosts-1"},
+				SSHAuthRef:   &api.SecretRef{NameSpace: "old-ns", Name: "ssh-1"},
+			},
+			Status: kubeonkubev1alpha1.ClusterOperationStatus{OperationsNamespace: "new-ns"},
+		}
+	}
+	tests := []struct {
+		name       string
+		existing   func(clusterOps *kubeonkubev1alpha1.ClusterOperation) []client.Object
+		wantReused bool
+	}{
+		{name: "copies under the same name"},
+		{
+			name: "reuses the copy of the clusterOps",
+			existing: func(clusterOps *kubeonkubev1alpha1.ClusterOperation) []client.Object {
+				cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "new-ns", Name: "hosts-1"}, Data: map[string]string{"hosts.yml": "copied"}}
+				secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "new-ns", Name: "ssh-1"}, Data: map[string][]byte{"ssh-privatekey": []byte("copied")}}
+				(&ClusterOperationReconciler{}).SetOwnerReferences(&cm.ObjectMeta, clusterOps)
+				(&ClusterOperationReconciler{}).SetOwnerReferences(&secret.ObjectMeta, clusterOps)
+				return []client.Object{cm, secret}
+			},
+			wantReused: true,
+		},
+		{
+			name: "does not reuse the data of others",
+			existing: func(*kubeonkubev1alpha1.ClusterOperation) []client.Object {
+				return []client.Object{
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "new-ns", Name: "hosts-1"}, Data: map[string]string{"hosts.yml": "foreign"}},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "new-ns", Name: "ssh-1"}, Data: map[string][]byte{"ssh-privatekey": []byte("foreign")}},
+				}
+			},
+		},
+		{
+			name: "does not reuse the data of another clusterOps",
+			existing: func(*kubeonkubev1alpha1.ClusterOperation) []client.Object {
+				other := &kubeonkubev1alpha1.ClusterOperation{ObjectMeta: metav1.ObjectMeta{Name: "other", UID: "other-uid"}}
+				cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "new-ns", Name: "hosts-1"}, Data: map[string]string{"hosts.yml": "foreign"}}
+				secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "new-ns", Name: "ssh-1"}, Data: map[string][]byte{"ssh-privatekey": []byte("foreign")}}
+				(&ClusterOperationReconciler{}).SetOwnerReferences(&cm.ObjectMeta, other)
+				(&ClusterOperationReconciler{}).SetOwnerReferences(&secret.ObjectMeta, other)
+				return []client.Object{cm, secret}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterOps := newClusterOps()
+			objs := []client.Object{
+				clusterOps,
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "old-ns", Name: "hosts-1"}, Data: map[string]string{"hosts.yml": "original"}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "old-ns", Name: "ssh-1"}, Data: map[string][]byte{"ssh-privatekey": []byte("original")}},
+			}
+			if tt.existing != nil {
+				objs = append(objs, tt.existing(clusterOps)...)
+			}
+			r := &ClusterOperationReconciler{Client: newTestClient(t, objs...)}
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				if updated, err := r.MigrateDataRef(ctx, clusterOps); err != nil || !updated {
+					t.Fatalf("got %v %v, want migrated one at a time", updated, err)
+				}
+			}
+			if updated, err := r.MigrateDataRef(ctx, clusterOps); err != nil || updated {
+				t.Fatalf("got %v %v, want nothing to migrate", updated, err)
+			}
+
+			wantData := "original"
+			if tt.wantReused {
+				wantData = "copied"
+			}
+			hostsRef, sshRef := clusterOps.Spec.HostsConfRef, clusterOps.Spec.SSHAuthRef
+			if hostsRef.NameSpace != "new-ns" || sshRef.NameSpace != "new-ns" {
+				t.Errorf("got %v %v, want the refs in new-ns", hostsRef, sshRef)
+			}
+			if tt.existing == nil || tt.wantReused {
+				if hostsRef.Name != "hosts-1" || sshRef.Name != "ssh-1" {
+					t.Errorf("got %v %v, want the same names", hostsRef, sshRef)
+				}
+			} else if !strings.HasPrefix(hostsRef.Name, "hosts-1-") || !strings.HasPrefix(sshRef.Name, "ssh-1-") {
+				t.Errorf("got %v %v, want unique names", hostsRef, sshRef)
+			}
+			cm := &corev1.ConfigMap{}
+			if err := r.Client.Get(ctx, client.ObjectKey{Namespace: hostsRef.NameSpace, Name: hostsRef.Name}, cm); err != nil {
+				t.Fatal(err)
+			}
+			secret := &corev1.Secret{}
+			if err := r.Client.Get(ctx, client.ObjectKey{Namespace: sshRef.NameSpace, Name: sshRef.Name}, secret); err != nil {
+				t.Fatal(err)
+			}
+			if cm.Data["hosts.yml"] != wantData || string(secret.Data["ssh-privatekey"]) != wantData {
+				t.Errorf("got %q %q, want %q", cm.Data["hosts.yml"], secret.Data["ssh-privatekey"], wantData)
+			}
+			if !metav1.IsControlledBy(cm, clusterOps) || !metav1.IsControlledBy(secret, clusterOps) {
+				t.Error("the migrated data must be controlled by the clusterOps")
+			}
+		})
+	}
+}
+
+func TestMigrateDataRefAfterJob(t *testing.T) {
+	clusterOps := &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops"},
+		Spec:       kubeonkubev1alpha1.ClusterOperationSpec{HostsConfRef: &api.ConfigMapRef{NameSpace: "old-ns", Name: "hosts-1"}},
+		Status: kubeonkubev1alpha1.ClusterOperationStatus{
+			OperationsNamespace: "new-ns",
+			JobRef:              &api.JobRef{NameSpace: "old-ns", Name: "job"},
+		},
+	}
+	r := &ClusterOperationReconciler{Client: newTestClient(t, clusterOps)}
+	if updated, err := r.MigrateDataRef(context.Background(), clusterOps); err != nil || updated {
+		t.Errorf("got %v %v, the data of a created Job must not move", updated, err)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/entrypoint"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// RenderPreview renders what the ClusterOperation would run against the current data of the Cluster.
+// Nothing is created, the Job mounts the data of the Cluster where a run mounts its backups.
+func (r *ClusterOperationReconciler) RenderPreview(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) (*kubeonkubev1alpha1.ClusterOperationPreview, error) {
+	// CheckClusterDataRef has made sure the hosts and vars of the Cluster exist
+	hostsConfRef, varsConfRef := *cluster.Spec.HostsConfRef, *cluster.Spec.VarsConfRef
+	preview := &kubeonkubev1alpha1.ClusterOperationPreview{
+		HostsConfRef: &hostsConfRef,
+		VarsConfRef:  &varsConfRef,
+	}
+	if !cluster.Spec.SSHAuthRef.IsEmpty() {
+		sshAuthRef := *cluster.Spec.SSHAuthRef
+		preview.SSHAuthRef = &sshAuthRef
+	}
+	if !cluster.Spec.SecretVarsRef.IsEmpty() {
+		secretVarsRef := *cluster.Spec.SecretVarsRef
+		preview.SecretVarsRef = &secretVarsRef
+	}
+	if !cluster.Spec.VaultPasswordRef.IsEmpty() {
+		vaultPasswordRef := *cluster.Spec.VaultPasswordRef
+		preview.VaultPasswordRef = &vaultPasswordRef
+	}
+	resolved := clusterOps.DeepCopy()
+	resolved.Spec.HostsConfRef = preview.HostsConfRef
+	resolved.Spec.VarsConfRef = preview.VarsConfRef
+	resolved.Spec.SSHAuthRef = preview.SSHAuthRef
+	resolved.Spec.SecretVarsRef = preview.SecretVarsRef
+	resolved.Spec.VaultPasswordRef = preview.VaultPasswordRef
+	resolved.Spec.EntrypointSHRef = &api.ConfigMapRef{
+		NameSpace: r.OperationsNamespace(clusterOps),
+		Name:      EntrypointConfigMapName(clusterOps),
+	}
+	if HasExtraVars(clusterOps) {
+		// the extra vars may hold secrets, the preview only checks that they resolve
+		if _, err := r.ResolveExtraVars(ctx, clusterOps); err != nil {
+			return nil, err
+		}
+		resolved.Spec.ExtraVarsRef = &api.SecretRef{
+			NameSpace: r.OperationsNamespace(clusterOps),
+			Name:      ExtraVarsSecretName(clusterOps),
+		}
+	}
+
+	if err := r.CheckLimit(ctx, resolved); err != nil {
+		return nil, err
+	}
+	entryPointData, err := NewEntryPoint(resolved)
+	if err != nil {
+		return nil, err
+	}
+	script, err := entryPointData.Render()
+	if err != nil {
+		return nil, err
+	}
+	preview.EntrypointSH = strings.TrimSpace(script)
+
+	job := r.NewKubesprayJob(resolved, cluster)
+	r.SetOwnerReferences(&job.ObjectMeta, clusterOps)
+	data, err := yaml.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	preview.Job = string(data)
+	return preview, nil
+}
+
+// UpdateStatusPreview finishes a render only ClusterOperation with the preview, wrong args fail it with the error in the preview.
+func (r *ClusterOperationReconciler) UpdateStatusPreview(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	preview, err := r.RenderPreview(ctx, cluster, clusterOps)
+	if argsErr, ok := err.(entrypoint.ArgsError); ok {
+		klog.Errorf("clusterOps %s wrong args %s and update status Failed", clusterOps.Name, argsErr.Error())
+		clusterOps.Status.Status = kubeonkubev1alpha1.FailedStatus
+		preview = &kubeonkubev1alpha1.ClusterOperationPreview{Error: argsErr.Error()}
+	} else if err != nil {
+		return err
+	} else {
+		clusterOps.Status.Status = kubeonkubev1alpha1.SucceededStatus
+	}
+	now := metav1.Time{Time: time.Now()}
+	clusterOps.Status.Preview = preview
+	clusterOps.Status.Action = clusterOps.Spec.Action
+	clusterOps.Status.StartTime = &now
+	clusterOps.Status.EndTime = &now
+	return r.Client.Status().Update(ctx, clusterOps)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/inventory"
+)
+
+func TestUpdateStatusPreview(t *testing.T) {
+	cluster := &kubeonkubev1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "c1"},
+		Spec: kubeonkubev1alpha1.ClusterSpec{
+			HostsConfRef:     &api.ConfigMapRef{NameSpace: "ns", Name: "c1-hosts"},
+			VarsConfRef:      &api.ConfigMapRef{NameSpace: "ns", Name: "c1-vars"},
+			SSHAuthRef:       &api.SecretRef{NameSpace: "ns", Name: "c1-ssh"},
+			VaultPasswordRef: &api.SecretRef{NameSpace: "ns", Name: "c1-vault"},
+		},
+	}
+	hosts := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "c1-hosts"},
+		Data:       map[string]string{inventory.HostsKey: "all:\n  hosts:\n    node1: {}\n"},
+	}
+	tests := []struct {
+		name       string
+		modify     func(clusterOps *kubeonkubev1alpha1.ClusterOperation)
+		wantStatus kubeonkubev1alpha1.OpsStatus
+		wantError  string
+		wantErr    bool
+	}{
+		{name: "renders the preview", wantStatus: kubeonkubev1alpha1.SucceededStatus},
+		{
+			name:       "renders the preview with a known limit",
+			modify:     func(clusterOps *kubeonkubev1alpha1.ClusterOperation) { clusterOps.Spec.Limit = []string{"node1"} },
+			wantStatus: kubeonkubev1alpha1.SucceededStatus,
+		},
+		{
+			name: "fails the unknown limit",
+			modify: func(clusterOps *kubeonkubev1alpha1.ClusterOperation) {
+				clusterOps.Spec.PreHook[0].Limit = []string{"node2"}
+			},
+			wantStatus: kubeonkubev1alpha1.FailedStatus,
+			wantError:  "node2",
+		},
+		{
+			name: "returns the error of the missing extra vars",
+			modify: func(clusterOps *kubeonkubev1alpha1.ClusterOperation) {
+				clusterOps.Spec.ExtraVarsFrom = []kubeonkubev1alpha1.ExtraVarsSource{{ConfigMapRef: &api.ConfigMapRef{NameSpace: "ns", Name: "missing"}}}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clusterOps := newTestSaltClusterOps()
+			clusterOps.Spec.RenderOnly = true
+			clusterOps.Spec.PreHook[0].Action = "precheck.yml"
+			if tt.modify != nil {
+				tt.modify(clusterOps)
+			}
+			c := newTestClient(t, cluster.DeepCopy(), hosts.DeepCopy(), clusterOps)
+			r := &ClusterOperationReconciler{Client: c}
+
+			err := r.UpdateStatusPreview(ctx, cluster, clusterOps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpdateStatusPreview() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			stored := &kubeonkubev1alpha1.ClusterOperation{}
+			if err := c.Get(ctx, client.ObjectKeyFromObject(clusterOps), stored); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr {
+				if stored.Status.Status != "" || stored.Status.Preview != nil {
+					t.Errorf("status = %+v, want it unchanged", stored.Status)
+				}
+				return
+			}
+			if stored.Status.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", stored.Status.Status, tt.wantStatus)
+			}
+			if stored.Status.StartTime == nil || stored.Status.EndTime == nil || stored.Status.Action != "cluster.yml" {
+				t.Errorf("status = %+v, want the action and the times", stored.Status)
+			}
+			preview := stored.Status.Preview
+			if preview == nil {
+				t.Fatal("status.preview is empty")
+			}
+			if len(tt.wantError) > 0 {
+				if !strings.Contains(preview.Error, tt.wantError) || len(preview.EntrypointSH) > 0 || len(preview.Job) > 0 {
+					t.Errorf("preview = %+v, want only the error with %s", preview, tt.wantError)
+				}
+				return
+			}
+			if preview.HostsConfRef.Name != "c1-hosts" || preview.VarsConfRef.Name != "c1-vars" ||
+				preview.SSHAuthRef.Name != "c1-ssh" || preview.VaultPasswordRef.Name != "c1-vault" || preview.SecretVarsRef != nil {
+				t.Errorf("preview = %+v, want the data of the cluster", preview)
+			}
+			if !strings.Contains(preview.EntrypointSH, "cluster.yml") || !strings.Contains(preview.EntrypointSH, "precheck.yml") {
+				t.Errorf("entrypoint.sh = %s, want the action and the hook", preview.EntrypointSH)
+			}
+			for _, name := range []string{"c1-hosts", "c1-vars", "c1-ssh", "c1-vault", "ops-entrypoint"} {
+				if !strings.Contains(preview.Job, name) {
+					t.Errorf("job does not mount %s:\n%s", name, preview.Job)
+				}
+			}
+			// the preview creates nothing
+			configMaps := &corev1.ConfigMapList{}
+			if err := c.List(ctx, configMaps); err != nil {
+				t.Fatal(err)
+			}
+			if len(configMaps.Items) != 1 {
+				t.Errorf("configMaps = %d, want only the hosts", len(configMaps.Items))
+			}
+		})
+	}
+}
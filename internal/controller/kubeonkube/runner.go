@@ -0,0 +1,290 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+const (
+	// ClusterNameEnv is set by the operator and can not be overridden.
+	ClusterNameEnv = "CLUSTER_NAME"
+	// AnsibleCfgKey is the key of ansible.cfg in the ConfigMap of the runner ansibleCfgRef.
+	AnsibleCfgKey = "ansible.cfg"
+	// AnsibleCfgPath is where the Job mounts the ansible.cfg, ANSIBLE_CONFIG points to it.
+	AnsibleCfgPath = "/conf/ansible.cfg"
+)
+
+// RunnerPodSpecFor merges the runner of the ClusterOperation over the default of the Cluster field by field.
+func RunnerPodSpecFor(cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) kubeonkubev1alpha1.RunnerPodSpec {
+	runner := kubeonkubev1alpha1.RunnerPodSpec{}
+	if cluster != nil && cluster.Spec.Runner != nil {
+		runner = *cluster.Spec.Runner.DeepCopy()
+	}
+	override := clusterOps.Spec.Runner
+	if override == nil {
+		return runner
+	}
+	if override.NodeSelector != nil {
+		runner.NodeSelector = override.NodeSelector
+	}
+	if override.Tolerations != nil {
+		runner.Tolerations = override.Tolerations
+	}
+	if override.Affinity != nil {
+		runner.Affinity = override.Affinity
+	}
+	if len(override.PriorityClassName) > 0 {
+		runner.PriorityClassName = override.PriorityClassName
+	}
+	if len(override.ServiceAccountName) > 0 {
+		runner.ServiceAccountName = override.ServiceAccountName
+	}
+	if override.ImagePullSecrets != nil {
+		runner.ImagePullSecrets = override.ImagePullSecrets
+	}
+	runner.Env = mergeEnv(runner.Env, override.Env)
+	runner.EnvFrom = append(runner.EnvFrom, override.EnvFrom...)
+	if override.AnsibleCfgRef != nil {
+		runner.AnsibleCfgRef = override.AnsibleCfgRef
+	}
+	return *runner.DeepCopy()
+}
+
+// mergeEnv keeps the order of base, replaces the vars overridden by name in place and appends the new ones in order.
+func mergeEnv(base, override []corev1.EnvVar) []corev1.EnvVar {
+	if len(override) == 0 {
+		return base
+	}
+	result := append([]corev1.EnvVar{}, base...)
+	index := map[string]int{}
+	for i, env := range result {
+		index[env.Name] = i
+	}
+	for _, env := range override {
+		if i, ok := index[env.Name]; ok {
+			result[i] = env
+			continue
+		}
+		index[env.Name] = len(result)
+		result = append(result, env)
+	}
+	return result
+}
+
+// BackUpRunnerData copies the ConfigMap of ansibleCfgRef and the envFrom sources of the runner in the operations namespace,
+// like BackUpVolumes, and records the copies in spec.runnerBackup.
+func (r *ClusterOperationReconciler) BackUpRunnerData(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+	if clusterOps.Spec.RunnerBackup != nil {
+		return false, nil
+	}
+	runner := RunnerPodSpecFor(cluster, clusterOps)
+	if runner.AnsibleCfgRef == nil && len(runner.EnvFrom) == 0 {
+		return false, nil
+	}
+	timestamp := fmt.Sprintf("-%d", time.Now().UnixMilli())
+	namespace := r.OperationsNamespace(clusterOps)
+	backup := &kubeonkubev1alpha1.RunnerBackup{NameSpace: namespace}
+	if runner.AnsibleCfgRef != nil {
+		ref := &api.ConfigMapRef{NameSpace: namespace, Name: runner.AnsibleCfgRef.Name}
+		newConfigMap, err := r.CopyConfigMap(ctx, clusterOps, ref, ref.Name+timestamp, namespace)
+		if err != nil {
+			return false, err
+		}
+		backup.AnsibleCfgRef = &corev1.LocalObjectReference{Name: newConfigMap.Name}
+	}
+	for i, source := range runner.EnvFrom {
+		source := *source.DeepCopy()
+		optional := false
+		var err error
+		switch {
+		case source.ConfigMapRef != nil:
+			optional = source.ConfigMapRef.Optional != nil && *source.ConfigMapRef.Optional
+			ref := &api.ConfigMapRef{NameSpace: namespace, Name: source.ConfigMapRef.Name}
+			var newConfigMap *corev1.ConfigMap
+			if newConfigMap, err = r.CopyConfigMap(ctx, clusterOps, ref, fmt.Sprintf("%s-env%d%s", ref.Name, i, timestamp), namespace); err == nil {
+				source.ConfigMapRef.Name = newConfigMap.Name
+			}
+		case source.SecretRef != nil:
+			optional = source.SecretRef.Optional != nil && *source.SecretRef.Optional
+			ref := &api.SecretRef{NameSpace: namespace, Name: source.SecretRef.Name}
+			var newSecret *corev1.Secret
+			if newSecret, err = r.CopySecret(ctx, clusterOps, ref, fmt.Sprintf("%s-env%d%s", ref.Name, i, timestamp), namespace); err == nil {
+				source.SecretRef.Name = newSecret.Name
+			}
+		}
+		if apierrors.IsNotFound(err) && optional {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		backup.EnvFrom = append(backup.EnvFrom, source)
+	}
+	clusterOps.Spec.RunnerBackup = backup
+	if err := r.Client.Update(ctx, clusterOps); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MigrateRunnerBackup copies the backups of the runner into the operations namespace, like MigrateDataRef.
+func (r *ClusterOperationReconciler) MigrateRunnerBackup(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+	backup := clusterOps.Spec.RunnerBackup
+	namespace := r.OperationsNamespace(clusterOps)
+	if !clusterOps.Status.JobRef.IsEmpty() || backup == nil || backup.NameSpace == namespace {
+		return false, nil
+	}
+	klog.Warningf("clusterOps %s migrates runner backups in %s to namespace %s", clusterOps.Name, backup.NameSpace, namespace)
+	if backup.AnsibleCfgRef != nil {
+		name, err := r.MigrateConfigMap(ctx, clusterOps, &api.ConfigMapRef{NameSpace: backup.NameSpace, Name: backup.AnsibleCfgRef.Name}, namespace)
+		if err != nil {
+			return false, err
+		}
+		backup.AnsibleCfgRef.Name = name
+	}
+	for _, source := range backup.EnvFrom {
+		if source.ConfigMapRef != nil {
+			name, err := r.MigrateConfigMap(ctx, clusterOps, &api.ConfigMapRef{NameSpace: backup.NameSpace, Name: source.ConfigMapRef.Name}, namespace)
+			if err != nil {
+				return false, err
+			}
+			source.ConfigMapRef.Name = name
+		} else if source.SecretRef != nil {
+			name, err := r.MigrateSecret(ctx, clusterOps, &api.SecretRef{NameSpace: backup.NameSpace, Name: source.SecretRef.Name}, namespace)
+			if err != nil {
+				return false, err
+			}
+			source.SecretRef.Name = name
+		}
+	}
+	backup.NameSpace = namespace
+	if err := r.Client.Update(ctx, clusterOps); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// applyRunnerBackup points the runner to the backups of its ConfigMaps and Secrets.
+func applyRunnerBackup(runner *kubeonkubev1alpha1.RunnerPodSpec, backup *kubeonkubev1alpha1.RunnerBackup) {
+	if backup == nil {
+		return
+	}
+	runner.AnsibleCfgRef = backup.AnsibleCfgRef
+	runner.EnvFrom = backup.EnvFrom
+}
+
+// applyRunnerPodSpec sets the scheduling of the runner on the pod.
+func applyRunnerPodSpec(podSpec *corev1.PodSpec, runner kubeonkubev1alpha1.RunnerPodSpec) {
+	podSpec.NodeSelector = runner.NodeSelector
+	podSpec.Tolerations = runner.Tolerations
+	podSpec.Affinity = runner.Affinity
+	podSpec.PriorityClassName = runner.PriorityClassName
+	podSpec.ServiceAccountName = runner.ServiceAccountName
+	podSpec.ImagePullSecrets = runner.ImagePullSecrets
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if container.Name != SprayJobPodName {
+			continue
+		}
+		for _, env := range runner.Env {
+			if env.Name != ClusterNameEnv {
+				container.Env = append(container.Env, env)
+			}
+		}
+		container.EnvFrom = runner.EnvFrom
+		if runner.AnsibleCfgRef != nil {
+			container.Env = append(container.Env, corev1.EnvVar{Name: "ANSIBLE_CONFIG", Value: AnsibleCfgPath})
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      "ansible-cfg",
+				MountPath: AnsibleCfgPath,
+				SubPath:   AnsibleCfgKey,
+				ReadOnly:  true,
+			})
+			podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+				Name: "ansible-cfg",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: *runner.AnsibleCfgRef},
+				},
+			})
+		}
+	}
+}
+
+// writablePaths are the emptyDirs mounted by applyRunnerSecurity for the image of the ClusterOperation.
+func (r *ClusterOperationReconciler) writablePaths(clusterOps *kubeonkubev1alpha1.ClusterOperation) []string {
+	profile := r.Config.Get().SecurityProfile(clusterOps.Spec.Image)
+	if profile.Disabled || !profile.ReadOnlyRootFilesystem {
+		return nil
+	}
+	if len(profile.WritablePaths) == 0 {
+		return config.DefaultWritablePaths
+	}
+	return profile.WritablePaths
+}
+
+// applyRunnerSecurity hardens the runner pod towards the restricted Pod Security Standard.
+// The baseline works with the kubespray images running as root, runAsNonRoot and the read-only root filesystem
+// are only set when the profile opts in.
+func applyRunnerSecurity(podSpec *corev1.PodSpec, profile config.RunnerSecurityProfile) {
+	if profile.Disabled {
+		return
+	}
+	podSpec.SecurityContext = &corev1.PodSecurityContext{
+		RunAsUser:      profile.RunAsUser,
+		RunAsGroup:     profile.RunAsGroup,
+		FSGroup:        profile.FSGroup,
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+	if profile.RunAsNonRoot || (profile.RunAsUser != nil && *profile.RunAsUser != 0) {
+		runAsNonRoot := true
+		podSpec.SecurityContext.RunAsNonRoot = &runAsNonRoot
+	}
+	allowPrivilegeEscalation, privileged, readOnlyRootFilesystem := false, false, profile.ReadOnlyRootFilesystem
+	writablePaths := profile.WritablePaths
+	if len(writablePaths) == 0 {
+		writablePaths = config.DefaultWritablePaths
+	}
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		container.SecurityContext = &corev1.SecurityContext{
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			Privileged:               &privileged,
+			ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		}
+		if !readOnlyRootFilesystem || container.Name != SprayJobPodName {
+			continue
+		}
+		for j, path := range writablePaths {
+			name := fmt.Sprintf("writable-%d", j)
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: name, MountPath: path})
+			podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}})
+		}
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+)
+
+func envNames(envs []corev1.EnvVar) []string {
+	names := []string{}
+	for _, env := range envs {
+		names = append(names, env.Name+"="+env.Value)
+	}
+	return names
+}
+
+func TestMergeEnv(t *testing.T) {
+	base := []corev1.EnvVar{{Name: "HTTP_PROXY", Value: "a"}, {Name: "NO_PROXY", Value: "b"}}
+	if got := mergeEnv(base, nil); !reflect.DeepEqual(got, base) {
+		t.Errorf("got %v, want base", got)
+	}
+	got := mergeEnv(base, []corev1.EnvVar{{Name: "ANSIBLE_FORKS", Value: "5"}, {Name: "HTTP_PROXY", Value: "c"}, {Name: "ANSIBLE_TIMEOUT", Value: "30"}})
+	want := []string{"HTTP_PROXY=c", "NO_PROXY=b", "ANSIBLE_FORKS=5", "ANSIBLE_TIMEOUT=30"}
+	if !reflect.DeepEqual(envNames(got), want) {
+		t.Errorf("got %v, want %v", envNames(got), want)
+	}
+	if base[0].Value != "a" {
+		t.Error("base must not be modified")
+	}
+}
+
+func TestRunnerPodSpecFor(t *testing.T) {
+	cluster := &kubeonkubev1alpha1.Cluster{Spec: kubeonkubev1alpha1.ClusterSpec{Runner: &kubeonkubev1alpha1.RunnerPodSpec{
+		NodeSelector:       map[string]string{"role": "ops"},
+		ServiceAccountName: "cluster-runner",
+		Env:                []corev1.EnvVar{{Name: "HTTP_PROXY", Value: "a"}},
+		EnvFrom:            []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "cluster-env"}}}},
+		AnsibleCfgRef:      &corev1.LocalObjectReference{Name: "cluster-cfg"},
+	}}}
+	clusterOps := &kubeonkubev1alpha1.ClusterOperation{}
+
+	if got := RunnerPodSpecFor(cluster, clusterOps); !reflect.DeepEqual(got, *cluster.Spec.Runner) {
+		t.Errorf("got %+v, want the runner of the cluster", got)
+	}
+	if got := RunnerPodSpecFor(nil, clusterOps); !reflect.DeepEqual(got, kubeonkubev1alpha1.RunnerPodSpec{}) {
+		t.Errorf("got %+v, want empty", got)
+	}
+
+	clusterOps.Spec.Runner = &kubeonkubev1alpha1.RunnerPodSpec{
+		ServiceAccountName: "ops-runner",
+		Env:                []corev1.EnvVar{{Name: "HTTP_PROXY", Value: "b"}},
+		EnvFrom:            []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "ops-env"}}}},
+	}
+	got := RunnerPodSpecFor(cluster, clusterOps)
+	if got.NodeSelector["role"] != "ops" || got.ServiceAccountName != "ops-runner" || got.AnsibleCfgRef.Name != "cluster-cfg" {
+		t.Errorf("the fields must be overridden one by one: %+v", got)
+	}
+	if !reflect.DeepEqual(envNames(got.Env), []string{"HTTP_PROXY=b"}) {
+		t.Errorf("env %v, want overridden by name", envNames(got.Env))
+	}
+	if len(got.EnvFrom) != 2 || got.EnvFrom[0].ConfigMapRef.Name != "cluster-env" || got.EnvFrom[1].SecretRef.Name != "ops-env" {
+		t.Errorf("envFrom %+v, want the sources of the cluster followed by the ones of the clusterOps", got.EnvFrom)
+	}
+	got.EnvFrom[0].ConfigMapRef.Name = "changed"
+	if cluster.Spec.Runner.EnvFrom[0].ConfigMapRef.Name != "cluster-env" {
+		t.Error("the cluster must not be modified through the result")
+	}
+}
+
+func TestBackUpRunnerData(t *testing.T) {
+	optional := true
+	cluster := &kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c1"}, Spec: kubeonkubev1alpha1.ClusterSpec{Runner: &kubeonkubev1alpha1.RunnerPodSpec{
+		AnsibleCfgRef: &corev1.LocalObjectReference{Name: "cfg"},
+		EnvFrom: []corev1.EnvFromSource{
+			{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "proxy"}}},
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Optional: &optional}},
+			{Prefix: "CLOUD_", SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "cloud"}}},
+		},
+	}}}
+	clusterOps := &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops", UID: "uid"},
+		Spec:       kubeonkubev1alpha1.ClusterOperationSpec{Cluster: "c1"},
+		Status:     kubeonkubev1alpha1.ClusterOperationStatus{OperationsNamespace: "ops-ns"},
+	}
+	objs := []client.Object{
+		clusterOps,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ops-ns", Name: "cfg"}, Data: map[string]string{AnsibleCfgKey: "[defaults]"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ops-ns", Name: "proxy"}, Data: map[string]string{"HTTP_PROXY": "a"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ops-ns", Name: "cloud"}, Data: map[string][]byte{"KEY": []byte("s3cret")}},
+	}
+	r := &ClusterOperationReconciler{Client: newTestClient(t, objs...)}
+	ctx := context.Background()
+
+	updated, err := r.BackUpRunnerData(ctx, cluster, clusterOps)
+	if err != nil || !updated {
+		t.Fatalf("got %v %v, want the backup recorded", updated, err)
+	}
+	backup := clusterOps.Spec.RunnerBackup
+	if backup == nil || backup.NameSpace != "ops-ns" || backup.AnsibleCfgRef == nil || !strings.HasPrefix(backup.AnsibleCfgRef.Name, "cfg-") {
+		t.Fatalf("got %+v, want the ansible.cfg backed up in ops-ns", backup)
+	}
+	if len(backup.EnvFrom) != 2 || backup.EnvFrom[0].ConfigMapRef == nil || backup.EnvFrom[1].SecretRef == nil || backup.EnvFrom[1].Prefix != "CLOUD_" {
+		t.Fatalf("envFrom %+v, want the sources in order without the missing optional one", backup.EnvFrom)
+	}
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "ops-ns", Name: backup.EnvFrom[1].SecretRef.Name}, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["KEY"]) != "s3cret" || len(secret.OwnerReferences) != 1 {
+		t.Errorf("got %+v, want a copy owned by the clusterOps", secret)
+	}
+
+	// the Job reads the backups
+	runner := RunnerPodSpecFor(cluster, clusterOps)
+	applyRunnerBackup(&runner, backup)
+	if runner.AnsibleCfgRef.Name != backup.AnsibleCfgRef.Name || runner.EnvFrom[0].ConfigMapRef.Name != backup.EnvFrom[0].ConfigMapRef.Name {
+		t.Errorf("got %+v, want the backups", runner)
+	}
+	if updated, err := r.BackUpRunnerData(ctx, cluster, clusterOps); err != nil || updated {
+		t.Errorf("got %v %v, want the backup made once", updated, err)
+	}
+
+	// a missing required source is an error
+	cluster.Spec.Runner.EnvFrom[1].SecretRef.Optional = nil
+	clusterOps.Spec.RunnerBackup = nil
+	if _, err := r.BackUpRunnerData(ctx, cluster, clusterOps); err == nil {
+		t.Error("a missing source must fail")
+	}
+}
+
+func TestMigrateRunnerBackup(t *testing.T) {
+	clusterOps := &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops", UID: "uid"},
+		Spec: kubeonkubev1alpha1.ClusterOperationSpec{RunnerBackup: &kubeonkubev1alpha1.RunnerBackup{
+			NameSpace:     "old-ns",
+			AnsibleCfgRef: &corev1.LocalObjectReference{Name: "cfg-1"},
+			EnvFrom:       []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env-1"}}}},
+		}},
+		Status: kubeonkubev1alpha1.ClusterOperationStatus{OperationsNamespace: "new-ns"},
+	}
+	r := &ClusterOperationReconciler{Client: newTestClient(t,
+		clusterOps,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "old-ns", Name: "cfg-1"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "old-ns", Name: "env-1"}},
+	)}
+	ctx := context.Background()
+	if updated, err := r.MigrateRunnerBackup(ctx, clusterOps); err != nil || !updated {
+		t.Fatalf("got %v %v, want migrated", updated, err)
+	}
+	if clusterOps.Spec.RunnerBackup.NameSpace != "new-ns" {
+		t.Errorf("namespace %s, want new-ns", clusterOps.Spec.RunnerBackup.NameSpace)
+	}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "new-ns", Name: "cfg-1"}, &corev1.ConfigMap{}); err != nil {
+		t.Error(err)
+	}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: "new-ns", Name: "env-1"}, &corev1.Secret{}); err != nil {
+		t.Error(err)
+	}
+	if updated, err := r.MigrateRunnerBackup(ctx, clusterOps); err != nil || updated {
+		t.Errorf("got %v %v, want nothing to migrate", updated, err)
+	}
+}
+
+func TestApplyRunnerSecurity(t *testing.T) {
+	user := int64(1000)
+	tests := []struct {
+		name             string
+		profile          config.RunnerSecurityProfile
+		wantDisabled     bool
+		wantNonRoot      bool
+		wantReadOnly     bool
+		wantWritableDirs []string
+	}{
+		{name: "baseline"},
+		{name: "disabled", profile: config.RunnerSecurityProfile{Disabled: true}, wantDisabled: true},
+		{name: "run as non root", profile: config.RunnerSecurityProfile{RunAsNonRoot: true}, wantNonRoot: true},
+		{name: "non-root user", profile: config.RunnerSecurityProfile{RunAsUser: &user}, wantNonRoot: true},
+		{
+			name:             "read-only root filesystem",
+			profile:          config.RunnerSecurityProfile{ReadOnlyRootFilesystem: true},
+			wantReadOnly:     true,
+			wantWritableDirs: config.DefaultWritablePaths,
+		},
+		{
+			name:             "custom writable paths",
+			profile:          config.RunnerSecurityProfile{ReadOnlyRootFilesystem: true, WritablePaths: []string{"/home/runner"}},
+			wantReadOnly:     true,
+			wantWritableDirs: []string{"/home/runner"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: SprayJobPodName}}}
+			applyRunnerSecurity(podSpec, tt.profile)
+			container := podSpec.Containers[0]
+			if tt.wantDisabled {
+				if podSpec.SecurityContext != nil || container.SecurityContext != nil {
+					t.Error("a disabled profile must leave the security context to the runtime")
+				}
+				return
+			}
+			if podSpec.SecurityContext.SeccompProfile == nil || podSpec.SecurityContext.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+				t.Errorf("seccomp %v, want RuntimeDefault", podSpec.SecurityContext.SeccompProfile)
+			}
+			sc := container.SecurityContext
+			if sc == nil || *sc.AllowPrivilegeEscalation || *sc.Privileged || !reflect.DeepEqual(sc.Capabilities.Drop, []corev1.Capability{"ALL"}) {
+				t.Errorf("got %+v, want no privilege escalation and all capabilities dropped", sc)
+			}
+			if nonRoot := podSpec.SecurityContext.RunAsNonRoot != nil && *podSpec.SecurityContext.RunAsNonRoot; nonRoot != tt.wantNonRoot {
+				t.Errorf("runAsNonRoot %v, want %v", nonRoot, tt.wantNonRoot)
+			}
+			if *sc.ReadOnlyRootFilesystem != tt.wantReadOnly {
+				t.Errorf("readOnlyRootFilesystem %v, want %v", *sc.ReadOnlyRootFilesystem, tt.wantReadOnly)
+			}
+			mounts := []string{}
+			for _, mount := range container.VolumeMounts {
+				mounts = append(mounts, mount.MountPath)
+			}
+			if len(mounts) != len(tt.wantWritableDirs) || (len(mounts) > 0 && !reflect.DeepEqual(mounts, tt.wantWritableDirs)) {
+				t.Errorf("writable dirs %v, want %v", mounts, tt.wantWritableDirs)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/archive"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+)
+
+// Scheduler admits the ClusterOperations waiting to run under the concurrency limits of the config.
+// The queue is rebuilt from the informer cache on every call, the ClusterOperations admitted but not
+// yet observed as Running in the cache are remembered so the limits hold while the cache lags behind.
+type Scheduler struct {
+	Client client.Client
+	Config *config.Provider
+
+	mu       sync.Mutex
+	admitted map[string]struct{}
+}
+
+func NewScheduler(c client.Client, provider *config.Provider) *Scheduler {
+	return &Scheduler{Client: c, Config: provider, admitted: map[string]struct{}{}}
+}
+
+// runningCounter counts the running ClusterOperations globally, by cluster and by group.
+type runningCounter struct {
+	limits    config.Concurrency
+	groups    map[string]string
+	total     int
+	byCluster map[string]int
+	byGroup   map[string]int
+}
+
+func (c *runningCounter) fits(clusterOps *kubeonkubev1alpha1.ClusterOperation) bool {
+	if c.limits.MaxRunning > 0 && c.total >= c.limits.MaxRunning {
+		return false
+	}
+	if c.limits.MaxRunningPerCluster > 0 && c.byCluster[clusterOps.Spec.Cluster] >= c.limits.MaxRunningPerCluster {
+		return false
+	}
+	if group, ok := c.groups[clusterOps.Spec.Cluster]; ok {
+		if limit := c.limits.GroupLimit(group); limit > 0 && c.byGroup[group] >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *runningCounter) add(clusterOps *kubeonkubev1alpha1.ClusterOperation) {
+	c.total++
+	c.byCluster[clusterOps.Spec.Cluster]++
+	if group, ok := c.groups[clusterOps.Spec.Cluster]; ok {
+		c.byGroup[group]++
+	}
+}
+
+// Limited reports whether any concurrency limit is configured, the ClusterOperations are queued only then.
+func (s *Scheduler) Limited() bool {
+	return s != nil && s.Config.Get().Concurrency.Limited()
+}
+
+// Admit reports whether the ClusterOperation may start now, otherwise its 1-based position in the queue.
+// Only the ClusterOperations marked Queued, i.e. those which reached the admission, are queued.
+func (s *Scheduler) Admit(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, int32, error) {
+	if s == nil {
+		return true, 0, nil
+	}
+	limits := s.Config.Get().Concurrency
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !limits.Limited() {
+		return true, 0, nil
+	}
+
+	clusterOpsList := &kubeonkubev1alpha1.ClusterOperationList{}
+	if err := s.Client.List(ctx, clusterOpsList); err != nil {
+		return false, 0, err
+	}
+	groups := map[string]string{}
+	if len(limits.GroupLabel) > 0 {
+		clusterList := &kubeonkubev1alpha1.ClusterList{}
+		if err := s.Client.List(ctx, clusterList); err != nil {
+			return false, 0, err
+		}
+		for _, item := range clusterList.Items {
+			if group, ok := item.Labels[limits.GroupLabel]; ok {
+				groups[item.Name] = group
+			}
+		}
+	}
+
+	counter := &runningCounter{limits: limits, groups: groups, byCluster: map[string]int{}, byGroup: map[string]int{}}
+	queue := []*kubeonkubev1alpha1.ClusterOperation{}
+	seen := map[string]struct{}{}
+	for i := range clusterOpsList.Items {
+		item := &clusterOpsList.Items[i]
+		seen[item.Name] = struct{}{}
+		switch item.Status.Status {
+		case kubeonkubev1alpha1.RunningStatus:
+			delete(s.admitted, item.Name)
+			counter.add(item)
+		case kubeonkubev1alpha1.SucceededStatus, kubeonkubev1alpha1.FailedStatus:
+			delete(s.admitted, item.Name)
+		case kubeonkubev1alpha1.QueuedStatus:
+			// restored ones and render only ones never run
+			if _, ok := item.Annotations[archive.RestoredAnno]; ok || item.Spec.RenderOnly {
+				continue
+			}
+			// admitted but its Job is not observed yet
+			if _, ok := s.admitted[item.Name]; ok {
+				counter.add(item)
+				continue
+			}
+			queue = append(queue, item)
+		default:
+			// not yet at the admission: the Cluster is missing, or it is held by the approval or the maintenance windows
+			if _, ok := s.admitted[item.Name]; ok {
+				counter.add(item)
+			}
+		}
+	}
+	for name := range s.admitted {
+		if _, ok := seen[name]; !ok {
+			delete(s.admitted, name)
+		}
+	}
+	if _, ok := s.admitted[clusterOps.Name]; ok {
+		return true, 0, nil
+	}
+
+	SortQueue(queue)
+	// 按顺序模拟准入，排在前面且能运行的 ClusterOps 先占用名额
+	position := int32(0)
+	for _, item := range queue {
+		if counter.fits(item) {
+			if item.Name == clusterOps.Name {
+				s.admitted[item.Name] = struct{}{}
+				return true, 0, nil
+			}
+			counter.add(item)
+			continue
+		}
+		position++
+		if item.Name == clusterOps.Name {
+			return false, position, nil
+		}
+	}
+	// not in the cache yet, wait for it
+	return false, position + 1, nil
+}
+
+// SortQueue orders the queued ClusterOperations by spec.priority descend, then by creation time.
+func SortQueue(queue []*kubeonkubev1alpha1.ClusterOperation) {
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].Spec.Priority != queue[j].Spec.Priority {
+			return queue[i].Spec.Priority > queue[j].Spec.Priority
+		}
+		if !queue[i].CreationTimestamp.Equal(&queue[j].CreationTimestamp) {
+			return queue[i].CreationTimestamp.Before(&queue[j].CreationTimestamp)
+		}
+		return queue[i].Name < queue[j].Name
+	})
+}
+
+// queuedClusterOps maps a ClusterOperation event to the queued ClusterOperations, so they are scheduled again when a slot frees up.
+func (s *Scheduler) queuedClusterOps(obj client.Object) []reconcile.Request {
+	if s == nil {
+		return nil
+	}
+	clusterOps, ok := obj.(*kubeonkubev1alpha1.ClusterOperation)
+	if !ok || clusterOps.Status.Status == kubeonkubev1alpha1.QueuedStatus {
+		return nil
+	}
+	clusterOpsList := &kubeonkubev1alpha1.ClusterOperationList{}
+	if err := s.Client.List(context.Background(), clusterOpsList); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, item := range clusterOpsList.Items {
+		if item.Status.Status == kubeonkubev1alpha1.QueuedStatus {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Name: item.Name}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+)
+
+var created = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestClusterOps(name, cluster string, status kubeonkubev1alpha1.OpsStatus, priority int32, age time.Duration) *kubeonkubev1alpha1.ClusterOperation {
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Time{Time: created.Add(-age)}},
+		Spec:       kubeonkubev1alpha1.ClusterOperationSpec{Cluster: cluster, Priority: priority},
+		Status:     kubeonkubev1alpha1.ClusterOperationStatus{Status: status},
+	}
+}
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := kubeonkubev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+		WithIndex(&kubeonkubev1alpha1.ClusterOperation{}, ClusterOpsClusterField, clusterOpsClusterIndex).
+		Build()
+}
+
+func TestSortQueue(t *testing.T) {
+	queue := []*kubeonkubev1alpha1.ClusterOperation{
+		newTestClusterOps("low-old", "c1", "", 0, 3*time.Hour),
+		newTestClusterOps("high-new", "c1", "", 10, time.Hour),
+		newTestClusterOps("low-new-b", "c1", "", 0, time.Hour),
+		newTestClusterOps("low-new-a", "c1", "", 0, time.Hour),
+		newTestClusterOps("high-old", "c1", "", 10, 2*time.Hour),
+		newTestClusterOps("negative", "c1", "", -5, 4*time.Hour),
+	}
+	SortQueue(queue)
+	want := []string{"high-old", "high-new", "low-old", "low-new-a", "low-new-b", "negative"}
+	for i, item := range queue {
+		if item.Name != want[i] {
+			t.Fatalf("position %d: got %s, want %s", i, item.Name, want[i])
+		}
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	queued := kubeonkubev1alpha1.QueuedStatus
+	running := kubeonkubev1alpha1.RunningStatus
+	tests := []struct {
+		name         string
+		limits       config.Concurrency
+		objs         []*kubeonkubev1alpha1.ClusterOperation
+		admit        string
+		wantAdmitted bool
+		wantPosition int32
+	}{
+		{
+			name:         "unlimited",
+			objs:         []*kubeonkubev1alpha1.ClusterOperation{newTestClusterOps("a", "c1", running, 0, time.Hour)},
+			admit:        "b",
+			wantAdmitted: true,
+		},
+		{
+			name:   "global limit reached",
+			limits: config.Concurrency{MaxRunning: 1},
+			objs: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("running", "c1", running, 0, 2*time.Hour),
+				newTestClusterOps("a", "c2", queued, 0, time.Hour),
+			},
+			admit:        "a",
+			wantPosition: 1,
+		},
+		{
+			name:   "per cluster limit leaves other clusters",
+			limits: config.Concurrency{MaxRunningPerCluster: 1},
+			objs: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("running", "c1", running, 0, 2*time.Hour),
+				newTestClusterOps("a", "c2", queued, 0, time.Hour),
+			},
+			admit:        "a",
+			wantAdmitted: true,
+		},
+		{
+			name:   "higher priority goes first",
+			limits: config.Concurrency{MaxRunning: 1},
+			objs: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("old", "c1", queued, 0, 2*time.Hour),
+				newTestClusterOps("urgent", "c2", queued, 10, time.Hour),
+			},
+			admit:        "old",
+			wantPosition: 1,
+		},
+		{
+			name:   "a blocked op does not hold the others back",
+			limits: config.Concurrency{MaxRunning: 2, MaxRunningPerCluster: 1},
+			objs: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("running", "c1", running, 0, 3*time.Hour),
+				newTestClusterOps("blocked", "c1", queued, 0, 2*time.Hour),
+				newTestClusterOps("a", "c2", queued, 0, time.Hour),
+			},
+			admit:        "a",
+			wantAdmitted: true,
+		},
+		{
+			name:   "ops before the admission are left out",
+			limits: config.Concurrency{MaxRunning: 1},
+			objs: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("new", "c1", "", 0, 4*time.Hour),
+				newTestClusterOps("approval", "c1", kubeonkubev1alpha1.AwaitingApprovalStatus, 0, 3*time.Hour),
+				newTestClusterOps("window", "c1", kubeonkubev1alpha1.WaitingStatus, 0, 2*time.Hour),
+				newTestClusterOps("a", "c1", queued, 0, time.Hour),
+			},
+			admit:        "a",
+			wantAdmitted: true,
+		},
+		{
+			name:   "finished ops free the slots",
+			limits: config.Concurrency{MaxRunning: 1},
+			objs: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("succeeded", "c1", kubeonkubev1alpha1.SucceededStatus, 0, 3*time.Hour),
+				newTestClusterOps("failed", "c1", kubeonkubev1alpha1.FailedStatus, 0, 2*time.Hour),
+				newTestClusterOps("a", "c1", queued, 0, time.Hour),
+			},
+			admit:        "a",
+			wantAdmitted: true,
+		},
+		{
+			name:   "not in the cache yet",
+			limits: config.Concurrency{MaxRunning: 1},
+			objs: []*kubeonkubev1alpha1.ClusterOperation{
+				newTestClusterOps("running", "c1", running, 0, 2*time.Hour),
+				newTestClusterOps("queued", "c1", queued, 0, time.Hour),
+			},
+			admit:        "a",
+			wantPosition: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{}
+			var target *kubeonkubev1alpha1.ClusterOperation
+			for _, item := range tt.objs {
+				objs = append(objs, item)
+				if item.Name == tt.admit {
+					target = item
+				}
+			}
+			if target == nil {
+				target = newTestClusterOps(tt.admit, "c1", queued, 0, 0)
+			}
+			s := NewScheduler(newTestClient(t, objs...), config.NewProvider(&config.Config{Concurrency: tt.limits}, "test"))
+			admitted, position, err := s.Admit(context.Background(), target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if admitted != tt.wantAdmitted || position != tt.wantPosition {
+				t.Errorf("got admitted %v position %d, want admitted %v position %d", admitted, position, tt.wantAdmitted, tt.wantPosition)
+			}
+		})
+	}
+}
+
+func TestAdmitRemembersAdmitted(t *testing.T) {
+	first := newTestClusterOps("first", "c1", kubeonkubev1alpha1.QueuedStatus, 0, 2*time.Hour)
+	second := newTestClusterOps("second", "c1", kubeonkubev1alpha1.QueuedStatus, 0, time.Hour)
+	s := NewScheduler(newTestClient(t, first, second), config.NewProvider(&config.Config{Concurrency: config.Concurrency{MaxRunning: 1}}, "test"))
+
+	// the Job of the first one is not observed as Running yet, it still holds the slot
+	for _, tt := range []struct {
+		clusterOps *kubeonkubev1alpha1.ClusterOperation
+		want       bool
+	}{{first, true}, {second, false}, {first, true}} {
+		admitted, _, err := s.Admit(context.Background(), tt.clusterOps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if admitted != tt.want {
+			t.Errorf("%s: got admitted %v, want %v", tt.clusterOps.Name, admitted, tt.want)
+		}
+	}
+}
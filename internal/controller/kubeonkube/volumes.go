@@ -0,0 +1,189 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+var (
+	// ReservedVolumeNames are the volumes of the runner built by the operator.
+	ReservedVolumeNames = []string{"entrypoint", "hosts-conf", "vars-conf", "ssh-auth", "secret-vars", "vault-password", "extra-vars", "ansible-cfg"}
+	// ReservedMountPaths can not be mounted over, under or above by the volumes of the users.
+	ReservedMountPaths = []string{"/conf", "/auth", "/bin/entrypoint.sh"}
+)
+
+// ValidateRunnerVolumes checks the volumes and the mounts of the ClusterOperation, writablePaths are the emptyDirs of the hardened runner.
+func ValidateRunnerVolumes(clusterOps *kubeonkubev1alpha1.ClusterOperation, writablePaths []string) error {
+	names := map[string]struct{}{}
+	for _, volume := range clusterOps.Spec.Volumes {
+		if msgs := validation.IsDNS1123Label(volume.Name); len(msgs) > 0 {
+			return fmt.Errorf("volume %q: %s", volume.Name, msgs[0])
+		}
+		if _, ok := names[volume.Name]; ok {
+			return fmt.Errorf("volume %q is duplicated", volume.Name)
+		}
+		if contains(ReservedVolumeNames, volume.Name) || strings.HasPrefix(volume.Name, "writable-") {
+			return fmt.Errorf("volume %q is reserved by the operator", volume.Name)
+		}
+		sources := 0
+		if volume.ConfigMapRef != nil {
+			sources++
+		}
+		if volume.SecretRef != nil {
+			sources++
+		}
+		if volume.PersistentVolumeClaim != nil {
+			sources++
+		}
+		if volume.EmptyDir != nil {
+			sources++
+		}
+		if sources != 1 {
+			return fmt.Errorf("volume %q must have exactly one source", volume.Name)
+		}
+		if volume.PersistentVolumeClaim != nil && len(volume.PersistentVolumeClaim.ClaimName) == 0 {
+			return fmt.Errorf("volume %q persistentVolumeClaim must have a claimName", volume.Name)
+		}
+		names[volume.Name] = struct{}{}
+	}
+	mountPaths := map[string]struct{}{}
+	for _, mount := range clusterOps.Spec.VolumeMounts {
+		if _, ok := names[mount.Name]; !ok {
+			return fmt.Errorf("volumeMount %q refers to no volume", mount.Name)
+		}
+		if !path.IsAbs(mount.MountPath) {
+			return fmt.Errorf("volumeMount %q mountPath %q must be absolute", mount.Name, mount.MountPath)
+		}
+		mountPath := path.Clean(mount.MountPath)
+		for _, reserved := range ReservedMountPaths {
+			if mountPath == reserved || strings.HasPrefix(mountPath, reserved+"/") || strings.HasPrefix(reserved, strings.TrimSuffix(mountPath, "/")+"/") {
+				return fmt.Errorf("volumeMount %q mountPath %q collides with %s", mount.Name, mount.MountPath, reserved)
+			}
+		}
+		for _, writable := range writablePaths {
+			if mountPath == path.Clean(writable) {
+				return fmt.Errorf("volumeMount %q mountPath %q collides with the writable path of the runner", mount.Name, mount.MountPath)
+			}
+		}
+		if _, ok := mountPaths[mountPath]; ok {
+			return fmt.Errorf("volumeMount %q mountPath %q is duplicated", mount.Name, mount.MountPath)
+		}
+		mountPaths[mountPath] = struct{}{}
+	}
+	return nil
+}
+
+// CheckRunnerVolumeClaims makes sure the PersistentVolumeClaims of the volumes exist in the operations namespace,
+// the Job would stay pending without them. The error wraps the NotFound error of the missing claim.
+func (r *ClusterOperationReconciler) CheckRunnerVolumeClaims(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	namespace := r.OperationsNamespace(clusterOps)
+	for _, volume := range clusterOps.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		claim := &corev1.PersistentVolumeClaim{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: volume.PersistentVolumeClaim.ClaimName}, claim); err != nil {
+			return fmt.Errorf("volume %q persistentVolumeClaim %s/%s: %w", volume.Name, namespace, volume.PersistentVolumeClaim.ClaimName, err)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, item string) bool {
+	for _, value := range list {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+// BackUpVolumes copies the ConfigMaps and Secrets of the volumes one at a time, like BackUpDataRef.
+func (r *ClusterOperationReconciler) BackUpVolumes(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (bool, error) {
+	timestamp := fmt.Sprintf("-%d", time.Now().UnixMilli())
+	currentNS := r.OperationsNamespace(clusterOps)
+	for i := range clusterOps.Spec.Volumes {
+		volume := &clusterOps.Spec.Volumes[i]
+		if !volume.BackupRef.IsEmpty() {
+			continue
+		}
+		switch {
+		case volume.ConfigMapRef != nil:
+			newConfigMap, err := r.CopyConfigMap(ctx, clusterOps, volume.ConfigMapRef, volume.ConfigMapRef.Name+timestamp, currentNS)
+			if err != nil {
+				return false, err
+			}
+			volume.BackupRef = &api.DataRef{NameSpace: newConfigMap.Namespace, Name: newConfigMap.Name}
+		case volume.SecretRef != nil:
+			newSecret, err := r.CopySecret(ctx, clusterOps, volume.SecretRef, volume.SecretRef.Name+timestamp, currentNS)
+			if err != nil {
+				return false, err
+			}
+			volume.BackupRef = &api.DataRef{NameSpace: newSecret.Namespace, Name: newSecret.Name}
+		default:
+			continue
+		}
+		if err := r.Client.Update(ctx, clusterOps); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// applyRunnerVolumes adds the volumes and the mounts to the runner, the ConfigMaps and Secrets are mounted from their backups.
+func applyRunnerVolumes(podSpec *corev1.PodSpec, clusterOps *kubeonkubev1alpha1.ClusterOperation) {
+	for _, volume := range clusterOps.Spec.Volumes {
+		source := corev1.VolumeSource{
+			PersistentVolumeClaim: volume.PersistentVolumeClaim,
+			EmptyDir:              volume.EmptyDir,
+		}
+		name := ""
+		if volume.ConfigMapRef != nil {
+			name = volume.ConfigMapRef.Name
+		} else if volume.SecretRef != nil {
+			name = volume.SecretRef.Name
+		}
+		if !volume.BackupRef.IsEmpty() {
+			name = volume.BackupRef.Name
+		}
+		if volume.ConfigMapRef != nil {
+			source.ConfigMap = &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}
+		} else if volume.SecretRef != nil {
+			source.Secret = &corev1.SecretVolumeSource{SecretName: name}
+		}
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{Name: volume.Name, VolumeSource: source})
+	}
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == SprayJobPodName {
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, clusterOps.Spec.VolumeMounts...)
+		}
+	}
+}
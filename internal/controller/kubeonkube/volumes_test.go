@@ -0,0 +1,125 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+)
+
+func TestValidateRunnerVolumes(t *testing.T) {
+	emptyDir := func(name string) kubeonkubev1alpha1.RunnerVolume {
+		return kubeonkubev1alpha1.RunnerVolume{Name: name, EmptyDir: &corev1.EmptyDirVolumeSource{}}
+	}
+	mount := func(name, path string) corev1.VolumeMount {
+		return corev1.VolumeMount{Name: name, MountPath: path}
+	}
+	tests := []struct {
+		name    string
+		volumes []kubeonkubev1alpha1.RunnerVolume
+		mounts  []corev1.VolumeMount
+		wantErr string
+	}{
+		{
+			name: "valid",
+			volumes: []kubeonkubev1alpha1.RunnerVolume{
+				emptyDir("cache"),
+				{Name: "ca", ConfigMapRef: &api.ConfigMapRef{NameSpace: "ns", Name: "ca"}},
+				{Name: "repo", PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "repo"}},
+			},
+			mounts: []corev1.VolumeMount{mount("cache", "/cache"), mount("ca", "/etc/pki/ca"), mount("repo", "/repo")},
+		},
+		{name: "invalid name", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("Cache")}, wantErr: `volume "Cache"`},
+		{name: "duplicated", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a"), emptyDir("a")}, wantErr: "duplicated"},
+		{name: "reserved", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("hosts-conf")}, wantErr: "reserved"},
+		{name: "reserved writable", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("writable-0")}, wantErr: "reserved"},
+		{name: "no source", volumes: []kubeonkubev1alpha1.RunnerVolume{{Name: "a"}}, wantErr: "exactly one source"},
+		{
+			name: "two sources",
+			volumes: []kubeonkubev1alpha1.RunnerVolume{{
+				Name: "a", EmptyDir: &corev1.EmptyDirVolumeSource{}, SecretRef: &api.SecretRef{NameSpace: "ns", Name: "a"},
+			}},
+			wantErr: "exactly one source",
+		},
+		{
+			name:    "claim without name",
+			volumes: []kubeonkubev1alpha1.RunnerVolume{{Name: "a", PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{}}},
+			wantErr: "claimName",
+		},
+		{name: "unknown volume", mounts: []corev1.VolumeMount{mount("a", "/a")}, wantErr: "refers to no volume"},
+		{name: "relative path", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a")}, mounts: []corev1.VolumeMount{mount("a", "a")}, wantErr: "absolute"},
+		{name: "over /conf", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a")}, mounts: []corev1.VolumeMount{mount("a", "/conf/")}, wantErr: "collides with /conf"},
+		{name: "under /auth", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a")}, mounts: []corev1.VolumeMount{mount("a", "/auth/x")}, wantErr: "collides with /auth"},
+		{name: "above entrypoint", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a")}, mounts: []corev1.VolumeMount{mount("a", "/bin")}, wantErr: "collides with /bin/entrypoint.sh"},
+		{name: "root", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a")}, mounts: []corev1.VolumeMount{mount("a", "/")}, wantErr: "collides"},
+		{name: "writable path", volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a")}, mounts: []corev1.VolumeMount{mount("a", "/tmp/")}, wantErr: "writable path"},
+		{
+			name:    "duplicated mount path",
+			volumes: []kubeonkubev1alpha1.RunnerVolume{emptyDir("a"), emptyDir("b")},
+			mounts:  []corev1.VolumeMount{mount("a", "/data"), mount("b", "/data/")},
+			wantErr: "duplicated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterOps := &kubeonkubev1alpha1.ClusterOperation{Spec: kubeonkubev1alpha1.ClusterOperationSpec{Volumes: tt.volumes, VolumeMounts: tt.mounts}}
+			err := ValidateRunnerVolumes(clusterOps, config.DefaultWritablePaths)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckRunnerVolumeClaims(t *testing.T) {
+	claim := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "ops-ns", Name: "repo"}}
+	other := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "other-ns", Name: "cache"}}
+	r := &ClusterOperationReconciler{Client: newTestClient(t, claim, other)}
+	withClaims := func(names ...string) *kubeonkubev1alpha1.ClusterOperation {
+		clusterOps := &kubeonkubev1alpha1.ClusterOperation{Status: kubeonkubev1alpha1.ClusterOperationStatus{OperationsNamespace: "ops-ns"}}
+		clusterOps.Spec.Volumes = append(clusterOps.Spec.Volumes, kubeonkubev1alpha1.RunnerVolume{Name: "tmp", EmptyDir: &corev1.EmptyDirVolumeSource{}})
+		for _, name := range names {
+			clusterOps.Spec.Volumes = append(clusterOps.Spec.Volumes, kubeonkubev1alpha1.RunnerVolume{
+				Name: name, PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+			})
+		}
+		return clusterOps
+	}
+	ctx := context.Background()
+	if err := r.CheckRunnerVolumeClaims(ctx, withClaims("repo")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := r.CheckRunnerVolumeClaims(ctx, withClaims("repo", "cache"))
+	if !apierrors.IsNotFound(err) || !strings.Contains(err.Error(), "ops-ns/cache") {
+		t.Errorf("got %v, want the claim of another namespace reported as not found", err)
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/runnerimage"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// ClusterOperationWebhook records who creates and who approves a ClusterOperation from the user info of the request,
+// and rejects the approvals made by the creator and the runner images which do not support the ClusterOperation.
+type ClusterOperationWebhook struct {
+	Client client.Reader
+	// Config provides the approval rules and the runner image catalog, the defaults are used when it is nil.
+	Config *config.Provider
+	// ControllerUsername is the user the controller runs as, it creates ClusterOperations on behalf of their requester.
+	// Nobody is trusted to set the annotations when it is empty.
+	ControllerUsername string
+}
+
+// isController reports whether the request is made by the controller.
+func (w *ClusterOperationWebhook) isController(username string) bool {
+	return len(w.ControllerUsername) > 0 && username == w.ControllerUsername
+}
+
+//+kubebuilder:webhook:path=/mutate-kubeonkube-clay-io-v1alpha1-clusteroperation,mutating=true,failurePolicy=fail,sideEffects=None,groups=kubeonkube.clay.io,resources=clusteroperations,verbs=create;update,versions=v1alpha1,name=mclusteroperation.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-kubeonkube-clay-io-v1alpha1-clusteroperation,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubeonkube.clay.io,resources=clusteroperations,verbs=create;update,versions=v1alpha1,name=vclusteroperation.kb.io,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the mutating and validating webhooks of ClusterOperation.
+func (w *ClusterOperationWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&kubeonkubev1alpha1.ClusterOperation{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// Default stamps the requester on create and the approver when spec.approved turns true.
+// The annotations can not be set by the users themselves, they are always taken from the request or the old object,
+// except when the controller creates a ClusterOperation on behalf of the requester recorded in them.
+func (w *ClusterOperationWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	clusterOps, ok := obj.(*kubeonkubev1alpha1.ClusterOperation)
+	if !ok {
+		return fmt.Errorf("expected a ClusterOperation but got a %T", obj)
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if clusterOps.Annotations == nil {
+		clusterOps.Annotations = map[string]string{}
+	}
+	switch req.Operation {
+	case admissionv1.Create:
+		if w.isController(req.UserInfo.Username) && len(clusterOps.Annotations[util.RequestedByAnno]) > 0 {
+			return nil
+		}
+		clusterOps.Annotations[util.RequestedByAnno] = req.UserInfo.Username
+		delete(clusterOps.Annotations, util.ApprovedByAnno)
+	case admissionv1.Update:
+		oldClusterOps := &kubeonkubev1alpha1.ClusterOperation{}
+		if err := json.Unmarshal(req.OldObject.Raw, oldClusterOps); err != nil {
+			return err
+		}
+		for _, key := range []string{util.RequestedByAnno, util.ApprovedByAnno} {
+			if value, ok := oldClusterOps.Annotations[key]; ok {
+				clusterOps.Annotations[key] = value
+			} else {
+				delete(clusterOps.Annotations, key)
+			}
+		}
+		if !oldClusterOps.Spec.Approved && clusterOps.Spec.Approved {
+			clusterOps.Annotations[util.ApprovedByAnno] = req.UserInfo.Username
+		}
+	}
+	return nil
+}
+
+// ValidateCreate rejects a ClusterOperation whose runner image does not support it or whose runner service account is not allowed,
+// and a ClusterOperation requiring approval which is approved by its own creator.
+// Only the controller may create an approved ClusterOperation, carrying an approval made by another user than the requester.
+func (w *ClusterOperationWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	clusterOps, ok := obj.(*kubeonkubev1alpha1.ClusterOperation)
+	if !ok {
+		return nil
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	cluster := &kubeonkubev1alpha1.Cluster{}
+	if err := w.Client.Get(ctx, client.ObjectKey{Name: clusterOps.Spec.Cluster}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if err := w.checkRunnerImage(ctx, cluster, clusterOps); err != nil {
+		return err
+	}
+	if err := w.checkRunnerServiceAccount(cluster, clusterOps); err != nil {
+		return err
+	}
+	if clusterOps.Spec.Approved && w.Config.Get().Approval.Requires(clusterOps.Spec.Actions(), cluster.Labels) {
+		if w.isController(req.UserInfo.Username) && len(util.ApprovedBy(clusterOps.Annotations, true)) > 0 {
+			return nil
+		}
+		return fmt.Errorf("clusterOps %s requires approval, spec.approved must be set by a user other than its creator", clusterOps.Name)
+	}
+	return nil
+}
+
+// checkRunnerImage checks the runner image against the catalog of kubeonkube-config, the error suggests the images supporting the ClusterOperation.
+func (w *ClusterOperationWebhook) checkRunnerImage(ctx context.Context, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	catalog := w.Config.Get().RunnerImages
+	if len(catalog.Images) == 0 && !catalog.Strict {
+		return nil
+	}
+	target, err := runnerimage.Target(ctx, w.Client, cluster, clusterOps)
+	if err != nil {
+		return err
+	}
+	if err := catalog.Check(clusterOps.Spec.Image, target); err != nil {
+		return fmt.Errorf("clusterOps %s: %v", clusterOps.Name, err)
+	}
+	return nil
+}
+
+// checkRunnerServiceAccount rejects a runner service account which is not allowed by kubeonkube-config,
+// the one of the ClusterOperation overrides the one of the Cluster.
+func (w *ClusterOperationWebhook) checkRunnerServiceAccount(cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) error {
+	name := ""
+	if cluster != nil && cluster.Spec.Runner != nil {
+		name = cluster.Spec.Runner.ServiceAccountName
+	}
+	if clusterOps.Spec.Runner != nil && len(clusterOps.Spec.Runner.ServiceAccountName) > 0 {
+		name = clusterOps.Spec.Runner.ServiceAccountName
+	}
+	if err := w.Config.Get().CheckRunnerServiceAccount(name); err != nil {
+		return fmt.Errorf("clusterOps %s: %v", clusterOps.Name, err)
+	}
+	return nil
+}
+
+// ValidateUpdate rejects a new image which does not support the ClusterOperation before it runs, a runner service account which is not allowed, a self approval, the withdrawal of an approval and any change of the spec after the approval.
+func (w *ClusterOperationWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldClusterOps, ok := oldObj.(*kubeonkubev1alpha1.ClusterOperation)
+	if !ok {
+		return nil
+	}
+	clusterOps, ok := newObj.(*kubeonkubev1alpha1.ClusterOperation)
+	if !ok {
+		return nil
+	}
+	if oldClusterOps.Spec.Image != clusterOps.Spec.Image && len(clusterOps.Status.Status) == 0 {
+		cluster := &kubeonkubev1alpha1.Cluster{}
+		if err := w.Client.Get(ctx, client.ObjectKey{Name: clusterOps.Spec.Cluster}, cluster); err == nil {
+			if err := w.checkRunnerImage(ctx, cluster, clusterOps); err != nil {
+				return err
+			}
+		} else if !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	if clusterOps.Spec.Runner != nil && len(clusterOps.Spec.Runner.ServiceAccountName) > 0 &&
+		(oldClusterOps.Spec.Runner == nil || oldClusterOps.Spec.Runner.ServiceAccountName != clusterOps.Spec.Runner.ServiceAccountName) {
+		if err := w.checkRunnerServiceAccount(nil, clusterOps); err != nil {
+			return err
+		}
+	}
+	if !oldClusterOps.Spec.Approved {
+		if clusterOps.Spec.Approved && clusterOps.Annotations[util.ApprovedByAnno] == clusterOps.Annotations[util.RequestedByAnno] {
+			return fmt.Errorf("clusterOps %s was created by %s and must be approved by another user", clusterOps.Name, clusterOps.Annotations[util.RequestedByAnno])
+		}
+		return nil
+	}
+	if !clusterOps.Spec.Approved {
+		return fmt.Errorf("the approval of clusterOps %s can not be withdrawn, delete it instead", clusterOps.Name)
+	}
+	if !reflect.DeepEqual(userSpec(oldClusterOps), userSpec(clusterOps)) {
+		return fmt.Errorf("the spec of clusterOps %s can not be changed after it is approved", clusterOps.Name)
+	}
+	return nil
+}
+
+// userSpec drops the refs filled by the controller when it performs backup and renders entrypoint.sh and the extra vars.
+func userSpec(clusterOps *kubeonkubev1alpha1.ClusterOperation) *kubeonkubev1alpha1.ClusterOperationSpec {
+	spec := clusterOps.Spec.DeepCopy()
+	spec.HostsConfRef, spec.VarsConfRef, spec.SSHAuthRef, spec.SecretVarsRef, spec.VaultPasswordRef = nil, nil, nil, nil, nil
+	spec.EntrypointSHRef, spec.ExtraVarsRef, spec.RunnerBackup = nil, nil, nil
+	for i := range spec.Volumes {
+		spec.Volumes[i].BackupRef = nil
+	}
+	return spec
+}
+
+func (w *ClusterOperationWebhook) ValidateDelete(_ context.Context, _ runtime.Object) error {
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+)
+
+func newTestWebhook(t *testing.T, rules ...config.ApprovalRule) *ClusterOperationWebhook {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := kubeonkubev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cluster := &kubeonkubev1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c1", Labels: map[string]string{"env": "prod"}}}
+	cfg := config.Default()
+	cfg.Approval.Rules = rules
+	return &ClusterOperationWebhook{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster).Build(),
+		Config: config.NewProvider(cfg, "test"),
+	}
+}
+
+func newTestClusterOps(action string, approved bool, annotations map[string]string) *kubeonkubev1alpha1.ClusterOperation {
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops", Annotations: annotations},
+		Spec: kubeonkubev1alpha1.ClusterOperationSpec{
+			Cluster:    "c1",
+			ActionType: kubeonkubev1alpha1.PlaybookActionType,
+			Action:     action,
+			Approved:   approved,
+		},
+	}
+}
+
+func requestContext(t *testing.T, operation admissionv1.Operation, user string, old *kubeonkubev1alpha1.ClusterOperation) context.Context {
+	t.Helper()
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		UserInfo:  authenticationv1.UserInfo{Username: user},
+	}}
+	if old != nil {
+		raw, err := json.Marshal(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.OldObject = runtime.RawExtension{Raw: raw}
+	}
+	return admission.NewContextWithRequest(context.Background(), req)
+}
+
+func TestDefaultCreate(t *testing.T) {
+	w := newTestWebhook(t)
+	clusterOps := newTestClusterOps("reset.yml", false, map[string]string{
+		util.RequestedByAnno: "someone-else",
+		util.ApprovedByAnno:  "alice",
+	})
+	if err := w.Default(requestContext(t, admissionv1.Create, "alice", nil), clusterOps); err != nil {
+		t.Fatal(err)
+	}
+	if got := clusterOps.Annotations[util.RequestedByAnno]; got != "alice" {
+		t.Errorf("requested-by %q, want the request user", got)
+	}
+	if _, ok := clusterOps.Annotations[util.ApprovedByAnno]; ok {
+		t.Error("approved-by must be dropped on create")
+	}
+}
+
+func TestDefaultUpdate(t *testing.T) {
+	w := newTestWebhook(t)
+	old := newTestClusterOps("reset.yml", false, map[string]string{util.RequestedByAnno: "alice"})
+
+	// the annotations are restored from the old object
+	forged := newTestClusterOps("reset.yml", false, map[string]string{util.RequestedByAnno: "mallory", util.ApprovedByAnno: "bob"})
+	if err := w.Default(requestContext(t, admissionv1.Update, "mallory", old), forged); err != nil {
+		t.Fatal(err)
+	}
+	if forged.Annotations[util.RequestedByAnno] != "alice" {
+		t.Errorf("requested-by %q, want it restored", forged.Annotations[util.RequestedByAnno])
+	}
+	if _, ok := forged.Annotations[util.ApprovedByAnno]; ok {
+		t.Error("approved-by must not be forged")
+	}
+
+	// the approver is the user turning spec.approved true
+	approved := newTestClusterOps("reset.yml", true, nil)
+	if err := w.Default(requestContext(t, admissionv1.Update, "bob", old), approved); err != nil {
+		t.Fatal(err)
+	}
+	if approved.Annotations[util.ApprovedByAnno] != "bob" {
+		t.Errorf("approved-by %q, want bob", approved.Annotations[util.ApprovedByAnno])
+	}
+}
+
+func TestValidateCreateApproval(t *testing.T) {
+	w := newTestWebhook(t, config.ApprovalRule{Actions: []string{"reset.yml"}})
+	ctx := requestContext(t, admissionv1.Create, "alice", nil)
+
+	if err := w.ValidateCreate(ctx, newTestClusterOps("reset.yml", true, nil)); err == nil {
+		t.Error("a ClusterOperation requiring approval must not be approved by its creator")
+	}
+	if err := w.ValidateCreate(ctx, newTestClusterOps("reset.yml", false, nil)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := w.ValidateCreate(ctx, newTestClusterOps("scale.yml", true, nil)); err != nil {
+		t.Errorf("approved is ignored without approval: %v", err)
+	}
+
+	hooked := newTestClusterOps("scale.yml", true, nil)
+	hooked.Spec.PostHook = []kubeonkubev1alpha1.HookAction{{ActionType: kubeonkubev1alpha1.PlaybookActionType, Action: "reset.yml"}}
+	if err := w.ValidateCreate(ctx, hooked); err == nil {
+		t.Error("a hook action requiring approval must not be approved by its creator")
+	}
+}
+
+func TestValidateUpdateApproval(t *testing.T) {
+	w := newTestWebhook(t, config.ApprovalRule{Actions: []string{"reset.yml"}})
+	ctx := requestContext(t, admissionv1.Update, "bob", nil)
+	pending := newTestClusterOps("reset.yml", false, map[string]string{util.RequestedByAnno: "alice"})
+	approvedBy := func(approver string) *kubeonkubev1alpha1.ClusterOperation {
+		return newTestClusterOps("reset.yml", true, map[string]string{util.RequestedByAnno: "alice", util.ApprovedByAnno: approver})
+	}
+
+	if err := w.ValidateUpdate(ctx, pending, approvedBy("alice")); err == nil {
+		t.Error("self approval must be rejected")
+	}
+	if err := w.ValidateUpdate(ctx, pending, approvedBy("bob")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := w.ValidateUpdate(ctx, approvedBy("bob"), pending); err == nil {
+		t.Error("the approval must not be withdrawn")
+	}
+	changed := approvedBy("bob")
+	changed.Spec.ExtraArgs = "-e reset_confirmation=yes"
+	if err := w.ValidateUpdate(ctx, approvedBy("bob"), changed); err == nil {
+		t.Error("the spec must not change after the approval")
+	}
+	filled := approvedBy("bob")
+	filled.Spec.EntrypointSHRef = &api.ConfigMapRef{NameSpace: "kube-system", Name: "ops-entrypoint"}
+	if err := w.ValidateUpdate(ctx, approvedBy("bob"), filled); err != nil {
+		t.Errorf("the refs filled by the controller must be allowed: %v", err)
+	}
+}
+
+func TestControllerCreatesOnBehalfOfRequester(t *testing.T) {
+	const controller = "system:serviceaccount:system:controller-manager"
+	w := newTestWebhook(t, config.ApprovalRule{Actions: []string{"reset.yml"}})
+	w.ControllerUsername = controller
+	onBehalf := func(approved bool, approver string) *kubeonkubev1alpha1.ClusterOperation {
+		annotations := map[string]string{util.RequestedByAnno: "alice"}
+		if len(approver) > 0 {
+			annotations[util.ApprovedByAnno] = approver
+		}
+		return newTestClusterOps("reset.yml", approved, annotations)
+	}
+
+	clusterOps := onBehalf(true, "bob")
+	ctx := requestContext(t, admissionv1.Create, controller, nil)
+	if err := w.Default(ctx, clusterOps); err != nil {
+		t.Fatal(err)
+	}
+	if clusterOps.Annotations[util.RequestedByAnno] != "alice" || clusterOps.Annotations[util.ApprovedByAnno] != "bob" {
+		t.Errorf("the annotations set by the controller must be kept: %v", clusterOps.Annotations)
+	}
+	if err := w.ValidateCreate(ctx, clusterOps); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := w.ValidateCreate(ctx, onBehalf(true, "alice")); err == nil {
+		t.Error("a self approval must be rejected for the controller too")
+	}
+	if err := w.ValidateCreate(ctx, onBehalf(true, "")); err == nil {
+		t.Error("an approval without approver must be rejected")
+	}
+
+	// anybody else is overwritten as before
+	forged := onBehalf(true, "bob")
+	ctx = requestContext(t, admissionv1.Create, "mallory", nil)
+	if err := w.Default(ctx, forged); err != nil {
+		t.Fatal(err)
+	}
+	if forged.Annotations[util.RequestedByAnno] != "mallory" {
+		t.Errorf("requested-by %q, want the request user", forged.Annotations[util.RequestedByAnno])
+	}
+	if err := w.ValidateCreate(ctx, forged); err == nil {
+		t.Error("only the controller may create an approved ClusterOperation")
+	}
+
+	// without a known controller nobody is trusted
+	w.ControllerUsername = ""
+	unknown := onBehalf(false, "")
+	if err := w.Default(requestContext(t, admissionv1.Create, controller, nil), unknown); err != nil {
+		t.Fatal(err)
+	}
+	if unknown.Annotations[util.RequestedByAnno] != controller {
+		t.Errorf("requested-by %q, want the request user", unknown.Annotations[util.RequestedByAnno])
+	}
+}
+
+func TestValidateRunnerServiceAccount(t *testing.T) {
+	w := newTestWebhook(t)
+	cfg := config.Default()
+	cfg.RunnerServiceAccounts = []string{"kubespray-runner"}
+	w.Config = config.NewProvider(cfg, "test")
+	withServiceAccount := func(name string) *kubeonkubev1alpha1.ClusterOperation {
+		clusterOps := newTestClusterOps("cluster.yml", false, nil)
+		clusterOps.Spec.Runner = &kubeonkubev1alpha1.RunnerPodSpec{ServiceAccountName: name}
+		return clusterOps
+	}
+	ctx := requestContext(t, admissionv1.Create, "alice", nil)
+
+	if err := w.ValidateCreate(ctx, withServiceAccount("kubespray-runner")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := w.ValidateCreate(ctx, withServiceAccount("")); err != nil {
+		t.Errorf("the default service account must be allowed: %v", err)
+	}
+	if err := w.ValidateCreate(ctx, withServiceAccount("cluster-admin")); err == nil {
+		t.Error("a service account out of the list must be rejected")
+	}
+	if err := w.ValidateUpdate(ctx, withServiceAccount(""), withServiceAccount("cluster-admin")); err == nil {
+		t.Error("changing to a service account out of the list must be rejected")
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// ClusterOperationScheduleWebhook records who creates and who approves a ClusterOperationSchedule,
+// the ClusterOperations of the schedule are requested by its creator and approved by its approver.
+type ClusterOperationScheduleWebhook struct{}
+
+//+kubebuilder:webhook:path=/mutate-kubeonkube-clay-io-v1alpha1-clusteroperationschedule,mutating=true,failurePolicy=fail,sideEffects=None,groups=kubeonkube.clay.io,resources=clusteroperationschedules,verbs=create;update,versions=v1alpha1,name=mclusteroperationschedule.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-kubeonkube-clay-io-v1alpha1-clusteroperationschedule,mutating=false,failurePolicy=fail,sideEffects=None,groups=kubeonkube.clay.io,resources=clusteroperationschedules,verbs=create;update,versions=v1alpha1,name=vclusteroperationschedule.kb.io,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the mutating and validating webhooks of ClusterOperationSchedule.
+func (w *ClusterOperationScheduleWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&kubeonkubev1alpha1.ClusterOperationSchedule{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// Default stamps the requester on create and the approver when spec.approved turns true, and drops the approver when it is withdrawn.
+// The annotations can not be set by the users themselves, they are always taken from the request or the old object.
+func (w *ClusterOperationScheduleWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	schedule, ok := obj.(*kubeonkubev1alpha1.ClusterOperationSchedule)
+	if !ok {
+		return fmt.Errorf("expected a ClusterOperationSchedule but got a %T", obj)
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if schedule.Annotations == nil {
+		schedule.Annotations = map[string]string{}
+	}
+	switch req.Operation {
+	case admissionv1.Create:
+		schedule.Annotations[util.RequestedByAnno] = req.UserInfo.Username
+		delete(schedule.Annotations, util.ApprovedByAnno)
+	case admissionv1.Update:
+		oldSchedule := &kubeonkubev1alpha1.ClusterOperationSchedule{}
+		if err := json.Unmarshal(req.OldObject.Raw, oldSchedule); err != nil {
+			return err
+		}
+		for _, key := range []string{util.RequestedByAnno, util.ApprovedByAnno} {
+			if value, ok := oldSchedule.Annotations[key]; ok {
+				schedule.Annotations[key] = value
+			} else {
+				delete(schedule.Annotations, key)
+			}
+		}
+		if !schedule.Spec.Approved {
+			delete(schedule.Annotations, util.ApprovedByAnno)
+		} else if !oldSchedule.Spec.Approved {
+			schedule.Annotations[util.ApprovedByAnno] = req.UserInfo.Username
+		}
+	}
+	return nil
+}
+
+// ValidateCreate rejects a schedule approved by its own creator.
+func (w *ClusterOperationScheduleWebhook) ValidateCreate(_ context.Context, obj runtime.Object) error {
+	schedule, ok := obj.(*kubeonkubev1alpha1.ClusterOperationSchedule)
+	if !ok {
+		return nil
+	}
+	if schedule.Spec.Approved {
+		return fmt.Errorf("schedule %s: spec.approved must be set by a user other than its creator", schedule.Name)
+	}
+	return nil
+}
+
+// ValidateUpdate rejects a self approval and any change of the spec but suspend while the schedule is approved.
+func (w *ClusterOperationScheduleWebhook) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) error {
+	oldSchedule, ok := oldObj.(*kubeonkubev1alpha1.ClusterOperationSchedule)
+	if !ok {
+		return nil
+	}
+	schedule, ok := newObj.(*kubeonkubev1alpha1.ClusterOperationSchedule)
+	if !ok {
+		return nil
+	}
+	if !schedule.Spec.Approved {
+		return nil
+	}
+	if !oldSchedule.Spec.Approved {
+		if schedule.Annotations[util.ApprovedByAnno] == schedule.Annotations[util.RequestedByAnno] {
+			return fmt.Errorf("schedule %s was created by %s and must be approved by another user", schedule.Name, schedule.Annotations[util.RequestedByAnno])
+		}
+		return nil
+	}
+	oldSpec, spec := oldSchedule.Spec.DeepCopy(), schedule.Spec.DeepCopy()
+	oldSpec.Suspend, spec.Suspend = nil, nil
+	if !reflect.DeepEqual(oldSpec, spec) {
+		return fmt.Errorf("the spec of schedule %s can not be changed while it is approved, withdraw the approval first", schedule.Name)
+	}
+	return nil
+}
+
+func (w *ClusterOperationScheduleWebhook) ValidateDelete(_ context.Context, _ runtime.Object) error {
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+)
+
+func newTestSchedule(approved bool, annotations map[string]string) *kubeonkubev1alpha1.ClusterOperationSchedule {
+	return &kubeonkubev1alpha1.ClusterOperationSchedule{
+		ObjectMeta: metav1.ObjectMeta{Name: "weekly", Annotations: annotations},
+		Spec: kubeonkubev1alpha1.ClusterOperationScheduleSpec{
+			Schedule: "0 2 * * 6",
+			Approved: approved,
+			Template: kubeonkubev1alpha1.ClusterOperationTemplate{
+				Spec: kubeonkubev1alpha1.ClusterOperationSpec{Cluster: "c1", Action: "reset.yml"},
+			},
+		},
+	}
+}
+
+func scheduleRequestContext(t *testing.T, operation admissionv1.Operation, user string, old *kubeonkubev1alpha1.ClusterOperationSchedule) context.Context {
+	t.Helper()
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		UserInfo:  authenticationv1.UserInfo{Username: user},
+	}}
+	if old != nil {
+		raw, err := json.Marshal(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.OldObject = runtime.RawExtension{Raw: raw}
+	}
+	return admission.NewContextWithRequest(context.Background(), req)
+}
+
+func TestScheduleDefault(t *testing.T) {
+	w := &ClusterOperationScheduleWebhook{}
+
+	created := newTestSchedule(false, map[string]string{util.RequestedByAnno: "bob", util.ApprovedByAnno: "bob"})
+	if err := w.Default(scheduleRequestContext(t, admissionv1.Create, "alice", nil), created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Annotations[util.RequestedByAnno] != "alice" {
+		t.Errorf("requested-by %q, want the request user", created.Annotations[util.RequestedByAnno])
+	}
+	if _, ok := created.Annotations[util.ApprovedByAnno]; ok {
+		t.Error("approved-by must be dropped on create")
+	}
+
+	old := newTestSchedule(false, map[string]string{util.RequestedByAnno: "alice"})
+	approved := newTestSchedule(true, map[string]string{util.RequestedByAnno: "mallory", util.ApprovedByAnno: "mallory"})
+	if err := w.Default(scheduleRequestContext(t, admissionv1.Update, "bob", old), approved); err != nil {
+		t.Fatal(err)
+	}
+	if approved.Annotations[util.RequestedByAnno] != "alice" || approved.Annotations[util.ApprovedByAnno] != "bob" {
+		t.Errorf("got %v, want requested by alice and approved by bob", approved.Annotations)
+	}
+
+	// the approver is kept while approved and dropped when withdrawn
+	kept := newTestSchedule(true, nil)
+	if err := w.Default(scheduleRequestContext(t, admissionv1.Update, "carol", approved), kept); err != nil {
+		t.Fatal(err)
+	}
+	if kept.Annotations[util.ApprovedByAnno] != "bob" {
+		t.Errorf("approved-by %q, want bob", kept.Annotations[util.ApprovedByAnno])
+	}
+	withdrawn := newTestSchedule(false, nil)
+	if err := w.Default(scheduleRequestContext(t, admissionv1.Update, "alice", approved), withdrawn); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := withdrawn.Annotations[util.ApprovedByAnno]; ok {
+		t.Error("approved-by must be dropped when the approval is withdrawn")
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	w := &ClusterOperationScheduleWebhook{}
+	ctx := context.Background()
+	pending := newTestSchedule(false, map[string]string{util.RequestedByAnno: "alice"})
+	approvedBy := func(approver string) *kubeonkubev1alpha1.ClusterOperationSchedule {
+		return newTestSchedule(true, map[string]string{util.RequestedByAnno: "alice", util.ApprovedByAnno: approver})
+	}
+
+	if err := w.ValidateCreate(ctx, newTestSchedule(true, nil)); err == nil {
+		t.Error("a schedule must not be approved by its creator")
+	}
+	if err := w.ValidateCreate(ctx, pending); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := w.ValidateUpdate(ctx, pending, approvedBy("alice")); err == nil {
+		t.Error("self approval must be rejected")
+	}
+	if err := w.ValidateUpdate(ctx, pending, approvedBy("bob")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	changed := approvedBy("bob")
+	changed.Spec.Template.Spec.ExtraArgs = "-e reset_confirmation=yes"
+	if err := w.ValidateUpdate(ctx, approvedBy("bob"), changed); err == nil {
+		t.Error("the spec must not change while approved")
+	}
+	suspended := approvedBy("bob")
+	suspend := true
+	suspended.Spec.Suspend = &suspend
+	if err := w.ValidateUpdate(ctx, approvedBy("bob"), suspended); err != nil {
+		t.Errorf("suspend must be allowed while approved: %v", err)
+	}
+	if err := w.ValidateUpdate(ctx, approvedBy("bob"), pending); err != nil {
+		t.Errorf("the approval can be withdrawn: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// ClusterUpgradeWebhook records who creates a ClusterUpgrade, its ClusterOperations are requested by its creator
+// and must be approved by another user when they require approval.
+type ClusterUpgradeWebhook struct{}
+
+//+kubebuilder:webhook:path=/mutate-kubeonkube-clay-io-v1alpha1-clusterupgrade,mutating=true,failurePolicy=fail,sideEffects=None,groups=kubeonkube.clay.io,resources=clusterupgrades,verbs=create;update,versions=v1alpha1,name=mclusterupgrade.kb.io,admissionReviewVersions=v1
+
+// SetupWebhookWithManager registers the mutating webhook of ClusterUpgrade.
+func (w *ClusterUpgradeWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&kubeonkubev1alpha1.ClusterUpgrade{}).
+		WithDefaulter(w).
+		Complete()
+}
+
+// Default stamps the requester on create and keeps it on update, the annotation can not be set by the users themselves.
+func (w *ClusterUpgradeWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	upgrade, ok := obj.(*kubeonkubev1alpha1.ClusterUpgrade)
+	if !ok {
+		return fmt.Errorf("expected a ClusterUpgrade but got a %T", obj)
+	}
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if upgrade.Annotations == nil {
+		upgrade.Annotations = map[string]string{}
+	}
+	// the upgrade is never approved as a whole, its ClusterOperations are.
+	delete(upgrade.Annotations, util.ApprovedByAnno)
+	switch req.Operation {
+	case admissionv1.Create:
+		upgrade.Annotations[util.RequestedByAnno] = req.UserInfo.Username
+	case admissionv1.Update:
+		oldUpgrade := &kubeonkubev1alpha1.ClusterUpgrade{}
+		if err := json.Unmarshal(req.OldObject.Raw, oldUpgrade); err != nil {
+			return err
+		}
+		if value, ok := oldUpgrade.Annotations[util.RequestedByAnno]; ok {
+			upgrade.Annotations[util.RequestedByAnno] = value
+		} else {
+			delete(upgrade.Annotations, util.RequestedByAnno)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Clay.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeonkube
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+)
+
+func newTestUpgrade(annotations map[string]string) *kubeonkubev1alpha1.ClusterUpgrade {
+	return &kubeonkubev1alpha1.ClusterUpgrade{
+		ObjectMeta: metav1.ObjectMeta{Name: "to-1-28", Annotations: annotations},
+		Spec:       kubeonkubev1alpha1.ClusterUpgradeSpec{Cluster: "c1", KubeVersion: "v1.28.6"},
+	}
+}
+
+func upgradeRequestContext(t *testing.T, operation admissionv1.Operation, user string, old *kubeonkubev1alpha1.ClusterUpgrade) context.Context {
+	t.Helper()
+	req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: operation,
+		UserInfo:  authenticationv1.UserInfo{Username: user},
+	}}
+	if old != nil {
+		raw, err := json.Marshal(old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.OldObject = runtime.RawExtension{Raw: raw}
+	}
+	return admission.NewContextWithRequest(context.Background(), req)
+}
+
+func TestUpgradeDefault(t *testing.T) {
+	w := &ClusterUpgradeWebhook{}
+
+	created := newTestUpgrade(map[string]string{util.RequestedByAnno: "bob", util.ApprovedByAnno: "bob"})
+	if err := w.Default(upgradeRequestContext(t, admissionv1.Create, "alice", nil), created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Annotations[util.RequestedByAnno] != "alice" {
+		t.Errorf("requested-by %q, want the request user", created.Annotations[util.RequestedByAnno])
+	}
+	if _, ok := created.Annotations[util.ApprovedByAnno]; ok {
+		t.Error("approved-by must be dropped on create")
+	}
+
+	updated := newTestUpgrade(map[string]string{util.RequestedByAnno: "mallory", util.ApprovedByAnno: "mallory"})
+	if err := w.Default(upgradeRequestContext(t, admissionv1.Update, "mallory", created), updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Annotations[util.RequestedByAnno] != "alice" {
+		t.Errorf("requested-by %q, want it kept from the old object", updated.Annotations[util.RequestedByAnno])
+	}
+	if _, ok := updated.Annotations[util.ApprovedByAnno]; ok {
+		t.Error("approved-by must be dropped on update")
+	}
+
+	// an upgrade created before the webhook has no requester and can not get one
+	legacy := newTestUpgrade(map[string]string{util.RequestedByAnno: "mallory"})
+	if err := w.Default(upgradeRequestContext(t, admissionv1.Update, "mallory", newTestUpgrade(nil)), legacy); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := legacy.Annotations[util.RequestedByAnno]; ok {
+		t.Error("requested-by must not be set on update")
+	}
+}
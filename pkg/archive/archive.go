@@ -0,0 +1,245 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// RestoredAnno marks a ClusterOperation restored from the archive, the value is the archive key.
+	// The ClusterOperation controller never runs a restored ClusterOperation.
+	RestoredAnno = "clay.io/restored-from-archive"
+
+	redactedValue = "<redacted>"
+	// DefaultLogLimitBytes limits the logs archived for each pod.
+	DefaultLogLimitBytes = 10 * 1024 * 1024
+)
+
+// Bundle is everything archived for a ClusterOperation.
+type Bundle struct {
+	ArchivedAt       metav1.Time                          `json:"archivedAt"`
+	ClusterOperation *kubeonkubev1alpha1.ClusterOperation `json:"clusterOperation"`
+	// ConfigMaps are the backed up hosts / vars, the rendered entrypoint.sh and the action sources.
+	ConfigMaps []corev1.ConfigMap `json:"configMaps,omitempty"`
+	// Secrets only keep the keys, the values are redacted.
+	Secrets []corev1.Secret `json:"secrets,omitempty"`
+	Logs    string          `json:"logs,omitempty"`
+}
+
+// LogFetcher reads the logs of the Job which ran the ClusterOperation.
+type LogFetcher interface {
+	FetchLogs(ctx context.Context, namespace, jobName string) (string, error)
+}
+
+// Archiver stores the ClusterOperation bundles before they are pruned, and restores them on demand.
+type Archiver struct {
+	Store  Store
+	Client client.Client
+	// Logs is optional, the logs are not archived when it is nil.
+	Logs LogFetcher
+}
+
+// Key is the archive key of the ClusterOperation, <cluster>/<clusterOps>-<creation unix time>.yaml.
+func Key(clusterOps *kubeonkubev1alpha1.ClusterOperation) string {
+	return path.Join(clusterOps.Spec.Cluster, fmt.Sprintf("%s-%d.yaml", clusterOps.Name, clusterOps.CreationTimestamp.Unix()))
+}
+
+// Archive collects the bundle of the ClusterOperation and writes it to the store.
+func (a *Archiver) Archive(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (string, error) {
+	bundle, err := a.Collect(ctx, clusterOps)
+	if err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(bundle)
+	if err != nil {
+		return "", err
+	}
+	key := Key(clusterOps)
+	if err := a.Store.Put(ctx, key, data); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Collect builds the bundle of the ClusterOperation, missing data is skipped.
+func (a *Archiver) Collect(ctx context.Context, clusterOps *kubeonkubev1alpha1.ClusterOperation) (*Bundle, error) {
+	bundle := &Bundle{ArchivedAt: metav1.Now(), ClusterOperation: clusterOps.DeepCopy()}
+	bundle.ClusterOperation.ManagedFields = nil
+	bundle.ClusterOperation.SetGroupVersionKind(kubeonkubev1alpha1.SchemeGroupVersion.WithKind("ClusterOperation"))
+
+	for _, ref := range clusterOps.Spec.ConfigDataList() {
+		if ref.IsEmpty() {
+			continue
+		}
+		cm := &corev1.ConfigMap{}
+		if err := a.Client.Get(ctx, client.ObjectKey{Namespace: ref.NameSpace, Name: ref.Name}, cm); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		cm.ManagedFields = nil
+		bundle.ConfigMaps = append(bundle.ConfigMaps, *cm)
+	}
+	for _, ref := range clusterOps.Spec.SecretDataList() {
+		if ref.IsEmpty() {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := a.Client.Get(ctx, client.ObjectKey{Namespace: ref.NameSpace, Name: ref.Name}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		bundle.Secrets = append(bundle.Secrets, RedactSecret(secret))
+	}
+
+	if a.Logs != nil && !clusterOps.Status.JobRef.IsEmpty() {
+		logs, err := a.Logs.FetchLogs(ctx, clusterOps.Status.JobRef.NameSpace, clusterOps.Status.JobRef.Name)
+		if err != nil {
+			klog.Warningf("failed to fetch logs of clusterOps %s: %v", clusterOps.Name, err)
+			logs = fmt.Sprintf("logs unavailable: %v", err)
+		}
+		bundle.Logs = logs
+	}
+	return bundle, nil
+}
+
+// RedactSecret copies the metadata and keys of the Secret without its values.
+func RedactSecret(secret *corev1.Secret) corev1.Secret {
+	redacted := corev1.Secret{
+		ObjectMeta: *secret.ObjectMeta.DeepCopy(),
+		Type:       secret.Type,
+		Data:       map[string][]byte{},
+	}
+	redacted.ManagedFields = nil
+	for key := range secret.Data {
+		redacted.Data[key] = []byte(redactedValue)
+	}
+	return redacted
+}
+
+// List returns the archive keys of the cluster, or of all clusters when clusterName is empty.
+func (a *Archiver) List(ctx context.Context, clusterName string) ([]string, error) {
+	prefix := ""
+	if len(clusterName) > 0 {
+		prefix = clusterName + "/"
+	}
+	return a.Store.List(ctx, prefix)
+}
+
+// Load reads the bundle stored under key.
+func (a *Archiver) Load(ctx context.Context, key string) (*Bundle, error) {
+	data, err := a.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{}
+	if err := yaml.Unmarshal(data, bundle); err != nil {
+		return nil, err
+	}
+	if bundle.ClusterOperation == nil {
+		return nil, fmt.Errorf("archive %s has no clusterOperation", key)
+	}
+	return bundle, nil
+}
+
+// Restore recreates the ClusterOperation and its ConfigMaps from the archive as read-only records,
+// the ConfigMaps are controlled by the restored ClusterOperation and deleted with it.
+// Secrets are redacted in the archive and are not restored.
+func (a *Archiver) Restore(ctx context.Context, key string) (*kubeonkubev1alpha1.ClusterOperation, error) {
+	bundle, err := a.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterOps := bundle.ClusterOperation.DeepCopy()
+	status := clusterOps.Status
+	resetObjectMeta(&clusterOps.ObjectMeta)
+	if clusterOps.Annotations == nil {
+		clusterOps.Annotations = map[string]string{}
+	}
+	clusterOps.Annotations[RestoredAnno] = key
+	clusterOps.Status = kubeonkubev1alpha1.ClusterOperationStatus{}
+	if err := a.Client.Create(ctx, clusterOps); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		// resume an interrupted restore, a ClusterOperation of the same name not restored from key is left alone
+		if err := a.Client.Get(ctx, client.ObjectKeyFromObject(clusterOps), clusterOps); err != nil {
+			return nil, err
+		}
+		if clusterOps.Annotations[RestoredAnno] != key {
+			return nil, fmt.Errorf("clusterOperation %s already exists and is not restored from %s", clusterOps.Name, key)
+		}
+	}
+	clusterOps.Status = status
+	if err := a.Client.Status().Update(ctx, clusterOps); err != nil {
+		return nil, err
+	}
+
+	owner := *metav1.NewControllerRef(clusterOps, kubeonkubev1alpha1.SchemeGroupVersion.WithKind("ClusterOperation"))
+	for i := range bundle.ConfigMaps {
+		cm := bundle.ConfigMaps[i].DeepCopy()
+		resetObjectMeta(&cm.ObjectMeta)
+		cm.OwnerReferences = []metav1.OwnerReference{owner}
+		if err := a.Client.Create(ctx, cm); err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+	}
+	for _, secret := range bundle.Secrets {
+		klog.Warningf("secret %s/%s is redacted in the archive and not restored", secret.Namespace, secret.Name)
+	}
+	return clusterOps, nil
+}
+
+func resetObjectMeta(meta *metav1.ObjectMeta) {
+	meta.ResourceVersion = ""
+	meta.UID = ""
+	meta.CreationTimestamp = metav1.Time{}
+	meta.DeletionTimestamp = nil
+	meta.OwnerReferences = nil
+	meta.ManagedFields = nil
+	meta.Generation = 0
+}
+
+// PodLogFetcher reads the logs of the pods created by a Job.
+type PodLogFetcher struct {
+	ClientSet  kubernetes.Interface
+	LimitBytes int64
+}
+
+func (f *PodLogFetcher) FetchLogs(ctx context.Context, namespace, jobName string) (string, error) {
+	pods, err := f.ClientSet.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	if err != nil {
+		return "", err
+	}
+	limitBytes := f.LimitBytes
+	if limitBytes <= 0 {
+		limitBytes = DefaultLogLimitBytes
+	}
+	b := &strings.Builder{}
+	for _, pod := range pods.Items {
+		fmt.Fprintf(b, "==> pod %s <==\n", pod.Name)
+		raw, err := f.ClientSet.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{LimitBytes: &limitBytes}).DoRaw(ctx)
+		if err != nil {
+			fmt.Fprintf(b, "logs unavailable: %v\n", err)
+			continue
+		}
+		b.Write(raw)
+	}
+	return b.String(), nil
+}
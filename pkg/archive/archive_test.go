@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type fakeLogs struct {
+	logs string
+	err  error
+}
+
+func (f *fakeLogs) FetchLogs(_ context.Context, namespace, jobName string) (string, error) {
+	return fmt.Sprintf("%s/%s: %s", namespace, jobName, f.logs), f.err
+}
+
+func newTestClient(t *testing.T, objs ...client.Object) client.Client {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := kubeonkubev1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func newTestClusterOps() *kubeonkubev1alpha1.ClusterOperation {
+	return &kubeonkubev1alpha1.ClusterOperation{
+		ObjectMeta: metav1.ObjectMeta{Name: "ops", UID: "uid", CreationTimestamp: metav1.Unix(1700000000, 0)},
+		Spec: kubeonkubev1alpha1.ClusterOperationSpec{
+			Cluster:      "c1",
+			HostsConfRef: &api.ConfigMapRef{NameSpace: "jobs", Name: "hosts-1"},
+			VarsConfRef:  &api.ConfigMapRef{NameSpace: "jobs", Name: "missing"},
+			SSHAuthRef:   &api.SecretRef{NameSpace: "jobs", Name: "ssh-1"},
+			RunnerBackup: &kubeonkubev1alpha1.RunnerBackup{
+				NameSpace:     "jobs",
+				AnsibleCfgRef: &corev1.LocalObjectReference{Name: "cfg-1"},
+				EnvFrom: []corev1.EnvFromSource{
+					{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env-cm-1"}}},
+					{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "env-secret-1"}}},
+				},
+			},
+		},
+		Status: kubeonkubev1alpha1.ClusterOperationStatus{
+			Status: kubeonkubev1alpha1.SucceededStatus,
+			JobRef: &api.JobRef{NameSpace: "jobs", Name: "job-1"},
+		},
+	}
+}
+
+func newTestData() []client.Object {
+	return []client.Object{
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "hosts-1"}, Data: map[string]string{"hosts.yml": "all: {}"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "cfg-1"}, Data: map[string]string{"ansible.cfg": "[defaults]"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "env-cm-1"}, Data: map[string]string{"HTTP_PROXY": "http://proxy"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "ssh-1"}, Data: map[string][]byte{"ssh-privatekey": []byte("key")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "jobs", Name: "env-secret-1"}, Data: map[string][]byte{"TOKEN": []byte("token")}},
+	}
+}
+
+func TestKey(t *testing.T) {
+	if key := Key(newTestClusterOps()); key != "c1/ops-1700000000.yaml" {
+		t.Errorf("got %s", key)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	tests := []struct {
+		name     string
+		logs     LogFetcher
+		wantLogs string
+	}{
+		{name: "without logs"},
+		{name: "with logs", logs: &fakeLogs{logs: "done"}, wantLogs: "jobs/job-1: done"},
+		{name: "logs unavailable", logs: &fakeLogs{err: fmt.Errorf("pod gone")}, wantLogs: "logs unavailable: pod gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterOps := newTestClusterOps()
+			a := &Archiver{Client: newTestClient(t, newTestData()...), Logs: tt.logs}
+			bundle, err := a.Collect(context.Background(), clusterOps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bundle.ClusterOperation.Name != "ops" || bundle.ClusterOperation.Kind != "ClusterOperation" {
+				t.Errorf("unexpected clusterOperation %+v", bundle.ClusterOperation.ObjectMeta)
+			}
+			configMaps := []string{}
+			for _, cm := range bundle.ConfigMaps {
+				configMaps = append(configMaps, cm.Name)
+			}
+			// the missing vars is skipped, the runner backups are archived
+			if got := strings.Join(configMaps, ","); got != "hosts-1,cfg-1,env-cm-1" {
+				t.Errorf("configMaps %s", got)
+			}
+			secrets := []string{}
+			for _, secret := range bundle.Secrets {
+				secrets = append(secrets, secret.Name)
+				for key, value := range secret.Data {
+					if string(value) != redactedValue {
+						t.Errorf("secret %s key %s is not redacted", secret.Name, key)
+					}
+				}
+			}
+			if got := strings.Join(secrets, ","); got != "ssh-1,env-secret-1" {
+				t.Errorf("secrets %s", got)
+			}
+			if bundle.Logs != tt.wantLogs {
+				t.Errorf("logs %q, want %q", bundle.Logs, tt.wantLogs)
+			}
+		})
+	}
+}
+
+func TestArchiveAndRestore(t *testing.T) {
+	ctx := context.Background()
+	store := &FileStore{Dir: t.TempDir()}
+	clusterOps := newTestClusterOps()
+	archived := &Archiver{Store: store, Client: newTestClient(t, newTestData()...)}
+	key, err := archived.Archive(ctx, clusterOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := archived.List(ctx, "c1"); err != nil || len(keys) != 1 || keys[0] != key {
+		t.Fatalf("got %v %v, want %s", keys, err, key)
+	}
+	if keys, _ := archived.List(ctx, "c2"); len(keys) != 0 {
+		t.Errorf("got %v, want nothing archived for c2", keys)
+	}
+
+	// restore into a cluster where the ClusterOperation and its data are gone
+	c := newTestClient(t)
+	restorer := &Archiver{Store: store, Client: c}
+	restored, err := restorer.Restore(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Annotations[RestoredAnno] != key || restored.Status.Status != kubeonkubev1alpha1.SucceededStatus {
+		t.Errorf("unexpected restored clusterOps %+v", restored)
+	}
+	got := &kubeonkubev1alpha1.ClusterOperation{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "ops"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.UID == clusterOps.UID || got.Status.Status != kubeonkubev1alpha1.SucceededStatus {
+		t.Errorf("unexpected restored clusterOps %+v", got)
+	}
+	cms := &corev1.ConfigMapList{}
+	if err := c.List(ctx, cms); err != nil {
+		t.Fatal(err)
+	}
+	if len(cms.Items) != 3 {
+		t.Errorf("got %d configMaps, want 3", len(cms.Items))
+	}
+	for i := range cms.Items {
+		if !metav1.IsControlledBy(&cms.Items[i], got) {
+			t.Errorf("configMap %s must be controlled by the restored clusterOps", cms.Items[i].Name)
+		}
+	}
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets); err != nil || len(secrets.Items) != 0 {
+		t.Errorf("got %v %v, the redacted secrets must not be restored", secrets.Items, err)
+	}
+
+	// an interrupted restore is resumed
+	if _, err := restorer.Restore(ctx, key); err != nil {
+		t.Errorf("restore again: %v", err)
+	}
+
+	// a ClusterOperation of the same name is not overwritten
+	foreign := &kubeonkubev1alpha1.ClusterOperation{ObjectMeta: metav1.ObjectMeta{Name: "ops"}}
+	restorer.Client = newTestClient(t, foreign)
+	if _, err := restorer.Restore(ctx, key); err == nil {
+		t.Error("restore over a foreign clusterOps must fail")
+	}
+	if _, err := restorer.Restore(ctx, "c1/missing.yaml"); err == nil {
+		t.Error("restore of a missing key must fail")
+	}
+}
@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Store persists the archived ClusterOperation bundles by key.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// NewStore builds a Store from an URL. file:///path stores the bundles in a local directory such as a mounted PVC,
+// s3://bucket/prefix?endpoint=https://minio:9000&region=us-east-1&pathStyle=true stores them in an S3-compatible bucket
+// with the credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func NewStore(rawURL string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		if len(u.Path) == 0 {
+			return nil, fmt.Errorf("archive store %s has no path", rawURL)
+		}
+		return &FileStore{Dir: u.Path}, nil
+	case "s3":
+		if len(u.Host) == 0 {
+			return nil, fmt.Errorf("archive store %s has no bucket", rawURL)
+		}
+		query := u.Query()
+		store := &S3Store{
+			Endpoint:     query.Get("endpoint"),
+			Region:       query.Get("region"),
+			Bucket:       u.Host,
+			Prefix:       strings.Trim(u.Path, "/"),
+			PathStyle:    query.Get("pathStyle") == "true",
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if len(store.Region) == 0 {
+			store.Region = "us-east-1"
+		}
+		if len(store.Endpoint) == 0 {
+			store.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", store.Region)
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive store scheme %q, use file or s3", u.Scheme)
+	}
+}
+
+// FileStore keeps the bundles as files under Dir.
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid archive key %q", key)
+	}
+	return filepath.Join(s.Dir, cleaned), nil
+}
+
+func (s *FileStore) Put(_ context.Context, key string, data []byte) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	// write to a temporary file first, so a partial bundle is never listed
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+func (s *FileStore) Get(_ context.Context, key string) ([]byte, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(target)
+}
+
+func (s *FileStore) List(_ context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	err := filepath.WalkDir(s.Dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := &FileStore{Dir: filepath.Join(t.TempDir(), "archive")}
+
+	// an empty store lists nothing
+	keys, err := store.List(ctx, "")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("got %v %v, want no keys", keys, err)
+	}
+
+	for key, data := range map[string]string{
+		"c1/ops-b-2.yaml": "b",
+		"c1/ops-a-1.yaml": "a",
+		"c2/ops-c-3.yaml": "c",
+	} {
+		if err := store.Put(ctx, key, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(store.Dir, "c1", "ops-d-4.yaml.tmp"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		prefix string
+		want   []string
+	}{
+		{"", []string{"c1/ops-a-1.yaml", "c1/ops-b-2.yaml", "c2/ops-c-3.yaml"}},
+		{"c1/", []string{"c1/ops-a-1.yaml", "c1/ops-b-2.yaml"}},
+		{"c3/", []string{}},
+	} {
+		keys, err := store.List(ctx, tt.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("prefix %q: got %v, want %v", tt.prefix, keys, tt.want)
+		}
+	}
+
+	data, err := store.Get(ctx, "c1/ops-a-1.yaml")
+	if err != nil || string(data) != "a" {
+		t.Errorf("got %q %v, want a", data, err)
+	}
+	if err := store.Put(ctx, "c1/ops-a-1.yaml", []byte("overwritten")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Get(ctx, "c1/ops-a-1.yaml"); string(data) != "overwritten" {
+		t.Errorf("got %q, want the bundle overwritten", data)
+	}
+	if _, err := store.Get(ctx, "c1/missing.yaml"); !os.IsNotExist(err) {
+		t.Errorf("got %v, want not exist", err)
+	}
+}
+
+func TestFileStoreKeyStaysInDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := &FileStore{Dir: filepath.Join(dir, "archive")}
+	if err := store.Put(ctx, "../../escaped.yaml", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "escaped.yaml")); err != nil {
+		t.Errorf("the key must be kept under the dir: %v", err)
+	}
+	for _, key := range []string{"", "/", ".."} {
+		if err := store.Put(ctx, key, []byte("x")); err == nil {
+			t.Errorf("key %q must be invalid", key)
+		}
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    Store
+		wantErr bool
+	}{
+		{url: "file:///data/archive", want: &FileStore{Dir: "/data/archive"}},
+		{url: "file://", wantErr: true},
+		{url: "s3://", wantErr: true},
+		{url: "ftp://host/path", wantErr: true},
+	}
+	for _, tt := range tests {
+		store, err := NewStore(tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.url, err, tt.wantErr)
+			continue
+		}
+		if tt.want != nil && !reflect.DeepEqual(store, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.url, store, tt.want)
+		}
+	}
+	store, err := NewStore("s3://bucket/prefix/?endpoint=https://minio:9000&pathStyle=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3, ok := store.(*S3Store)
+	if !ok || s3.Bucket != "bucket" || s3.Prefix != "prefix" || s3.Endpoint != "https://minio:9000" || !s3.PathStyle || s3.Region != "us-east-1" {
+		t.Errorf("unexpected s3 store %+v", store)
+	}
+}
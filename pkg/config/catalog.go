@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+type RunnerImageCatalog struct {
+	// Strict rejects the images which are not in the catalog.
+	Strict bool `json:"strict,omitempty"`
+	// Images are the runner images with what their kubespray supports.
+	Images []RunnerImage `json:"images,omitempty"`
+}
+
+type RunnerImage struct {
+	// Image is the runner image such as quay.io/kubespray/kubespray:v2.23.1.
+	Image string `json:"image"`
+	// KubeVersions are the Kubernetes versions such as v1.28.6, v1.27 or v1.27.x matches every patch of the minor.
+	KubeVersions []string `json:"kubeVersions,omitempty"`
+	// OSFamilies are the OS families of the nodes such as RedHat and Debian, every family when empty.
+	OSFamilies []string `json:"osFamilies,omitempty"`
+	// Playbooks such as cluster.yml and upgrade-cluster.yml, every playbook when empty.
+	Playbooks []string `json:"playbooks,omitempty"`
+}
+
+// RunnerImageTarget is what a ClusterOperation requires from its runner image, the empty fields are not checked.
+type RunnerImageTarget struct {
+	KubeVersion string
+	OSFamilies  []string
+	Playbooks   []string
+}
+
+// Lookup returns the catalog entry of the image, nil when it is not in the catalog.
+func (c *RunnerImageCatalog) Lookup(image string) *RunnerImage {
+	for i := range c.Images {
+		if c.Images[i].Image == image {
+			return &c.Images[i]
+		}
+	}
+	return nil
+}
+
+// Check returns an error when the image does not support the target, suggesting the images which do.
+func (c *RunnerImageCatalog) Check(image string, target RunnerImageTarget) error {
+	entry := c.Lookup(image)
+	if entry == nil {
+		if c.Strict {
+			return fmt.Errorf("runner image %s is not in the catalog%s", image, c.suggestion(target))
+		}
+		return nil
+	}
+	if err := entry.Supports(target); err != nil {
+		return fmt.Errorf("runner image %s %v%s", image, err, c.suggestion(target))
+	}
+	return nil
+}
+
+// Suggest returns the images supporting the target in the order of the catalog.
+func (c *RunnerImageCatalog) Suggest(target RunnerImageTarget) []string {
+	images := []string{}
+	for _, entry := range c.Images {
+		if entry.Supports(target) == nil {
+			images = append(images, entry.Image)
+		}
+	}
+	return images
+}
+
+func (c *RunnerImageCatalog) suggestion(target RunnerImageTarget) string {
+	images := c.Suggest(target)
+	if len(images) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", use one of %s", strings.Join(images, ", "))
+}
+
+// Supports returns an error naming the first requirement of the target which the image does not support.
+func (i *RunnerImage) Supports(target RunnerImageTarget) error {
+	if len(target.KubeVersion) > 0 && len(i.KubeVersions) > 0 {
+		supported := false
+		for _, version := range i.KubeVersions {
+			if MatchKubeVersion(version, target.KubeVersion) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("does not support kube_version %s", target.KubeVersion)
+		}
+	}
+	if len(i.OSFamilies) > 0 {
+		for _, family := range target.OSFamilies {
+			if !containsFold(i.OSFamilies, family) {
+				return fmt.Errorf("does not support os family %s", family)
+			}
+		}
+	}
+	if len(i.Playbooks) > 0 {
+		for _, playbook := range target.Playbooks {
+			if !contains(i.Playbooks, strings.TrimSpace(playbook)) {
+				return fmt.Errorf("does not provide playbook %s", playbook)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchKubeVersion matches the version against v1.28.6, v1.27 or v1.27.x, the leading v is optional on both.
+func MatchKubeVersion(pattern, version string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(pattern), "v"), ".x")
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	return version == pattern || strings.HasPrefix(version, pattern+".")
+}
+
+func containsFold(list []string, item string) bool {
+	for _, value := range list {
+		if strings.EqualFold(value, item) {
+			return true
+		}
+	}
+	return false
+}
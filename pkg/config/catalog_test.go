@@ -0,0 +1,113 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testCatalog(strict bool) *RunnerImageCatalog {
+	return &RunnerImageCatalog{
+		Strict: strict,
+		Images: []RunnerImage{
+			{
+				Image:        "kubespray:v2.22.1",
+				KubeVersions: []string{"v1.26.x", "v1.25.11"},
+				OSFamilies:   []string{"RedHat", "Debian"},
+				Playbooks:    []string{"cluster.yml", "upgrade-cluster.yml"},
+			},
+			{
+				Image:        "kubespray:v2.23.1",
+				KubeVersions: []string{"v1.27", "1.28.x"},
+			},
+		},
+	}
+}
+
+func TestMatchKubeVersion(t *testing.T) {
+	tests := []struct {
+		pattern, version string
+		want             bool
+	}{
+		{"v1.28.6", "v1.28.6", true},
+		{"v1.28.6", "1.28.6", true},
+		{"v1.28.6", "v1.28.7", false},
+		{"v1.28", "v1.28.7", true},
+		{"v1.28.x", "1.28.0", true},
+		{"v1.2", "v1.28.0", false},
+		{"v1.28.x", "v1.29.0", false},
+	}
+	for _, tt := range tests {
+		if got := MatchKubeVersion(tt.pattern, tt.version); got != tt.want {
+			t.Errorf("MatchKubeVersion(%q, %q) = %v, want %v", tt.pattern, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestCatalogCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		image   string
+		target  RunnerImageTarget
+		wantErr string
+	}{
+		{name: "supported", image: "kubespray:v2.22.1", target: RunnerImageTarget{KubeVersion: "v1.26.5", OSFamilies: []string{"redhat"}, Playbooks: []string{" cluster.yml"}}},
+		{name: "empty target", image: "kubespray:v2.22.1"},
+		{name: "unknown image", image: "custom:latest", target: RunnerImageTarget{KubeVersion: "v1.30.0"}},
+		{
+			name: "unknown image strict", strict: true, image: "custom:latest", target: RunnerImageTarget{KubeVersion: "v1.27.3"},
+			wantErr: "runner image custom:latest is not in the catalog, use one of kubespray:v2.23.1",
+		},
+		{
+			name: "kube version", image: "kubespray:v2.22.1", target: RunnerImageTarget{KubeVersion: "v1.28.1"},
+			wantErr: "runner image kubespray:v2.22.1 does not support kube_version v1.28.1, use one of kubespray:v2.23.1",
+		},
+		{
+			name: "os family", image: "kubespray:v2.22.1", target: RunnerImageTarget{OSFamilies: []string{"Debian", "Suse"}},
+			wantErr: "does not support os family Suse, use one of kubespray:v2.23.1",
+		},
+		{
+			name: "playbook", image: "kubespray:v2.22.1", target: RunnerImageTarget{Playbooks: []string{"reset.yml"}},
+			wantErr: "does not provide playbook reset.yml, use one of kubespray:v2.23.1",
+		},
+		{
+			name: "no suggestion", image: "kubespray:v2.23.1", target: RunnerImageTarget{KubeVersion: "v1.30.0"},
+			wantErr: "does not support kube_version v1.30.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testCatalog(tt.strict).Check(tt.image, tt.target)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want it to end with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCatalogSuggest(t *testing.T) {
+	catalog := testCatalog(false)
+	for _, tt := range []struct {
+		target RunnerImageTarget
+		want   []string
+	}{
+		{target: RunnerImageTarget{}, want: []string{"kubespray:v2.22.1", "kubespray:v2.23.1"}},
+		{target: RunnerImageTarget{KubeVersion: "v1.25.11"}, want: []string{"kubespray:v2.22.1"}},
+		{target: RunnerImageTarget{KubeVersion: "v1.27.2", OSFamilies: []string{"Suse"}}, want: []string{"kubespray:v2.23.1"}},
+		{target: RunnerImageTarget{KubeVersion: "v1.25.12"}, want: []string{}},
+	} {
+		if got := catalog.Suggest(tt.target); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Suggest(%+v) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+	if catalog.Lookup("kubespray:v2.23.1") != &catalog.Images[1] || catalog.Lookup("missing") != nil {
+		t.Error("Lookup must return the entry of the image in the catalog")
+	}
+}
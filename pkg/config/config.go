@@ -0,0 +1,413 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultConfigMapName is the ConfigMap in the controller namespace holding the configuration.
+	DefaultConfigMapName = "kubeonkube-config"
+	// ConfigKey is the key of the typed configuration in the ConfigMap.
+	ConfigKey = "config.yaml"
+
+	DefaultClusterOperationsBackEndLimit = 30
+	MaxClusterOperationsBackEndLimit     = 200
+)
+
+// Config is the controller configuration, loaded from a file or the kubeonkube-config ConfigMap.
+type Config struct {
+	// DefaultRunnerImage runs the ClusterOperations created by the controller when no image is given, such as the reset on deletion.
+	DefaultRunnerImage string `json:"defaultRunnerImage,omitempty"`
+	// DefaultResources applies to the runner container when the ClusterOperation sets no resources.
+	DefaultResources corev1.ResourceRequirements `json:"defaultResources,omitempty"`
+	// JobNamespace holds the Jobs, entrypoint ConfigMaps and backups, it defaults to the namespace the controller runs in.
+	// Cluster spec.operationsNamespace overrides it.
+	JobNamespace string `json:"jobNamespace,omitempty"`
+	// Retention is the global ClusterOperation retention, Cluster spec.opsRetention overrides it.
+	Retention Retention `json:"retention,omitempty"`
+	// Concurrency limits the controllers.
+	Concurrency Concurrency `json:"concurrency,omitempty"`
+	// Timeouts of the runner Jobs.
+	Timeouts Timeouts `json:"timeouts,omitempty"`
+	// RegistryMirrors rewrites the registry of the runner image, such as docker.io: mirror.example.com.
+	RegistryMirrors map[string]string `json:"registryMirrors,omitempty"`
+	// Approval holds the matching ClusterOperations until another user approves them.
+	Approval Approval `json:"approval,omitempty"`
+	// RunnerServiceAccounts are the service accounts of the operations namespaces the runner pods may use through
+	// spec.runner.serviceAccountName, the ClusterOperations and Clusters naming any other one are refused.
+	// The default service account is always allowed.
+	RunnerServiceAccounts []string `json:"runnerServiceAccounts,omitempty"`
+	// RunnerSecurity hardens the runner pods by image, the first matching profile applies.
+	// The pods of the images matching no profile keep the security context of the container runtime.
+	RunnerSecurity []RunnerSecurityProfile `json:"runnerSecurity,omitempty"`
+	// RunnerImages is the catalog of the runner images, the ClusterOperations are validated against it.
+	RunnerImages RunnerImageCatalog `json:"runnerImages,omitempty"`
+	// RunnerBackend runs the ClusterOperations, it only takes effect on restart.
+	RunnerBackend RunnerBackend `json:"runnerBackend,omitempty"`
+}
+
+type Retention struct {
+	// BackEndLimit keeps at most N ClusterOperations for each Cluster.
+	BackEndLimit int `json:"backEndLimit,omitempty"`
+	// SucceededLimit keeps the last N succeeded ClusterOperations, unlimited when unset.
+	SucceededLimit *int `json:"succeededLimit,omitempty"`
+	// FailedLimit keeps the last N failed ClusterOperations, unlimited when unset.
+	FailedLimit *int `json:"failedLimit,omitempty"`
+	// TTL deletes the finished ClusterOperations older than it, zero keeps them.
+	TTL metav1.Duration `json:"ttl,omitempty"`
+}
+
+type Concurrency struct {
+	// MaxConcurrentReconciles of each controller, it only takes effect on restart.
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+	// MaxRunning limits the running ClusterOperations of all clusters, zero is unlimited.
+	MaxRunning int `json:"maxRunning,omitempty"`
+	// MaxRunningPerCluster limits the running ClusterOperations of each cluster, zero is unlimited.
+	MaxRunningPerCluster int `json:"maxRunningPerCluster,omitempty"`
+	// GroupLabel is the Cluster label grouping the clusters, such as their datacenter.
+	GroupLabel string `json:"groupLabel,omitempty"`
+	// MaxRunningPerGroup limits the running ClusterOperations of each group, zero is unlimited.
+	MaxRunningPerGroup int `json:"maxRunningPerGroup,omitempty"`
+	// GroupLimits overrides MaxRunningPerGroup by the value of GroupLabel.
+	GroupLimits map[string]int `json:"groupLimits,omitempty"`
+}
+
+// GroupLimit is the limit of the group, zero is unlimited.
+func (c *Concurrency) GroupLimit(group string) int {
+	if limit, ok := c.GroupLimits[group]; ok {
+		return limit
+	}
+	return c.MaxRunningPerGroup
+}
+
+// Limited reports whether any limit on the running ClusterOperations is set.
+func (c *Concurrency) Limited() bool {
+	return c.MaxRunning > 0 || c.MaxRunningPerCluster > 0 || (len(c.GroupLabel) > 0 && (c.MaxRunningPerGroup > 0 || len(c.GroupLimits) > 0))
+}
+
+type Approval struct {
+	// Rules select the ClusterOperations requiring approval, a ClusterOperation matching any rule requires it.
+	Rules []ApprovalRule `json:"rules,omitempty"`
+}
+
+type ApprovalRule struct {
+	// Actions such as reset.yml and remove-node.yml, every action when empty.
+	Actions []string `json:"actions,omitempty"`
+	// ClusterSelector matches the labels of the Cluster, every Cluster when unset.
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+}
+
+// Requires reports whether any of the actions on a Cluster with the labels requires approval.
+// A rule whose clusterSelector is invalid matches every Cluster, so a typo never skips the approval.
+func (a *Approval) Requires(actions []string, clusterLabels map[string]string) bool {
+	for _, rule := range a.Rules {
+		if len(rule.Actions) > 0 && !containsAny(rule.Actions, actions) {
+			continue
+		}
+		if rule.ClusterSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(rule.ClusterSelector)
+			if err == nil && !selector.Matches(labels.Set(clusterLabels)) {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func containsAny(list []string, items []string) bool {
+	for _, item := range items {
+		if contains(list, strings.TrimSpace(item)) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, item string) bool {
+	for _, value := range list {
+		if value == item {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultWritablePaths are where ansible and ssh write as root.
+var DefaultWritablePaths = []string{"/tmp", "/root/.ansible", "/root/.ssh"}
+
+// RunnerSecurityProfile hardens the runner pods of the matching images. Every runner drops all capabilities,
+// forbids privilege escalation and uses the RuntimeDefault seccomp profile unless it is disabled, which works with the
+// kubespray images running as root. A read-only root filesystem and runAsNonRoot are opt-in per image.
+type RunnerSecurityProfile struct {
+	// Image is a prefix of the runner image such as wangzhichidocker/kubeonkube, empty matches every image.
+	Image string `json:"image,omitempty"`
+	// Disabled leaves the security context to the container runtime, for images which can not run without capabilities.
+	Disabled bool `json:"disabled,omitempty"`
+	// RunAsUser runs the runner as the user, a non-zero user also sets runAsNonRoot. It defaults to the user of the image.
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	// RunAsGroup runs the runner as the group.
+	RunAsGroup *int64 `json:"runAsGroup,omitempty"`
+	// FSGroup owns the mounted volumes.
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+	// RunAsNonRoot makes the kubelet refuse to start the runner as root, for images with a non-root user.
+	RunAsNonRoot bool `json:"runAsNonRoot,omitempty"`
+	// ReadOnlyRootFilesystem mounts the root filesystem read-only, only WritablePaths stay writable.
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+	// WritablePaths are mounted as emptyDirs on the read-only root filesystem, it defaults to DefaultWritablePaths.
+	WritablePaths []string `json:"writablePaths,omitempty"`
+}
+
+// SecurityProfile returns the first profile matching the image, the baseline profile when none matches.
+func (c *Config) SecurityProfile(image string) RunnerSecurityProfile {
+	for _, profile := range c.RunnerSecurity {
+		if strings.HasPrefix(image, profile.Image) {
+			return profile
+		}
+	}
+	return RunnerSecurityProfile{}
+}
+
+const (
+	// RunnerBackendJob runs every ClusterOperation as a Job, it is the default.
+	RunnerBackendJob = "job"
+	// RunnerBackendLocal runs the entrypoint on the controller host, for development and tests only.
+	RunnerBackendLocal = "local"
+)
+
+type RunnerBackend struct {
+	// Type is job or local, it defaults to job.
+	Type string `json:"type,omitempty"`
+	// WorkDir holds the files and logs of the local runs, it defaults to kubeonkube under the temp dir.
+	WorkDir string `json:"workDir,omitempty"`
+	// KubesprayDir is the kubespray checkout used by the local runs, it defaults to /kubespray as in the runner image.
+	KubesprayDir string `json:"kubesprayDir,omitempty"`
+}
+
+type Timeouts struct {
+	// ActiveDeadline limits the runner Job when the ClusterOperation sets no activeDeadlineSeconds, zero is unlimited.
+	ActiveDeadline metav1.Duration `json:"activeDeadline,omitempty"`
+}
+
+// Default returns the configuration used when nothing is configured.
+func Default() *Config {
+	return &Config{
+		Retention:   Retention{BackEndLimit: DefaultClusterOperationsBackEndLimit},
+		Concurrency: Concurrency{MaxConcurrentReconciles: 1},
+	}
+}
+
+// CheckRunnerServiceAccount returns an error unless the runner may use the service account, empty is the default one.
+func (c *Config) CheckRunnerServiceAccount(name string) error {
+	if len(name) == 0 || name == "default" {
+		return nil
+	}
+	for _, allowed := range c.RunnerServiceAccounts {
+		if allowed == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("runner service account %s is not in runnerServiceAccounts of the controller config", name)
+}
+
+// Validate reports every invalid field of the configuration.
+func (c *Config) Validate() error {
+	errs := []string{}
+	if c.Retention.BackEndLimit <= 0 || c.Retention.BackEndLimit > MaxClusterOperationsBackEndLimit {
+		errs = append(errs, fmt.Sprintf("retention.backEndLimit must be in [1, %d]", MaxClusterOperationsBackEndLimit))
+	}
+	if c.Retention.SucceededLimit != nil && *c.Retention.SucceededLimit < 0 {
+		errs = append(errs, "retention.succeededLimit must not be negative")
+	}
+	if c.Retention.FailedLimit != nil && *c.Retention.FailedLimit < 0 {
+		errs = append(errs, "retention.failedLimit must not be negative")
+	}
+	if c.Retention.TTL.Duration < 0 {
+		errs = append(errs, "retention.ttl must not be negative")
+	}
+	if c.Concurrency.MaxConcurrentReconciles <= 0 {
+		errs = append(errs, "concurrency.maxConcurrentReconciles must be positive")
+	}
+	if c.Concurrency.MaxRunning < 0 || c.Concurrency.MaxRunningPerCluster < 0 || c.Concurrency.MaxRunningPerGroup < 0 {
+		errs = append(errs, "concurrency limits must not be negative")
+	}
+	for group, limit := range c.Concurrency.GroupLimits {
+		if limit < 0 {
+			errs = append(errs, fmt.Sprintf("concurrency.groupLimits %s must not be negative", group))
+		}
+	}
+	if len(c.Concurrency.GroupLimits) > 0 && len(c.Concurrency.GroupLabel) == 0 {
+		errs = append(errs, "concurrency.groupLimits requires concurrency.groupLabel")
+	}
+	if c.Timeouts.ActiveDeadline.Duration < 0 {
+		errs = append(errs, "timeouts.activeDeadline must not be negative")
+	}
+	if len(c.JobNamespace) > 0 {
+		for _, msg := range validation.IsDNS1123Label(c.JobNamespace) {
+			errs = append(errs, fmt.Sprintf("jobNamespace: %s", msg))
+		}
+	}
+	for registry, mirror := range c.RegistryMirrors {
+		if len(registry) == 0 || len(mirror) == 0 {
+			errs = append(errs, fmt.Sprintf("registryMirrors %q: %q must not be empty", registry, mirror))
+		}
+	}
+	for i, rule := range c.Approval.Rules {
+		if rule.ClusterSelector == nil {
+			continue
+		}
+		if _, err := metav1.LabelSelectorAsSelector(rule.ClusterSelector); err != nil {
+			errs = append(errs, fmt.Sprintf("approval.rules[%d].clusterSelector: %v", i, err))
+		}
+	}
+	for i, name := range c.RunnerServiceAccounts {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			errs = append(errs, fmt.Sprintf("runnerServiceAccounts[%d]: %s", i, msg))
+		}
+	}
+	for i, profile := range c.RunnerSecurity {
+		for _, path := range profile.WritablePaths {
+			if !strings.HasPrefix(path, "/") {
+				errs = append(errs, fmt.Sprintf("runnerSecurity[%d].writablePaths %q must be absolute", i, path))
+			}
+		}
+		if len(profile.WritablePaths) > 0 && !profile.ReadOnlyRootFilesystem {
+			errs = append(errs, fmt.Sprintf("runnerSecurity[%d].writablePaths requires readOnlyRootFilesystem", i))
+		}
+		if profile.RunAsUser != nil && *profile.RunAsUser < 0 {
+			errs = append(errs, fmt.Sprintf("runnerSecurity[%d].runAsUser must not be negative", i))
+		}
+	}
+	images := map[string]struct{}{}
+	for i, entry := range c.RunnerImages.Images {
+		if len(entry.Image) == 0 {
+			errs = append(errs, fmt.Sprintf("runnerImages.images[%d].image must not be empty", i))
+		}
+		if _, ok := images[entry.Image]; ok {
+			errs = append(errs, fmt.Sprintf("runnerImages.images[%d].image %s is duplicated", i, entry.Image))
+		}
+		images[entry.Image] = struct{}{}
+		for _, version := range entry.KubeVersions {
+			if len(strings.Trim(strings.TrimSpace(version), "v.x")) == 0 {
+				errs = append(errs, fmt.Sprintf("runnerImages.images[%d].kubeVersions %q is invalid", i, version))
+			}
+		}
+	}
+	switch c.RunnerBackend.Type {
+	case "", RunnerBackendJob, RunnerBackendLocal:
+	default:
+		errs = append(errs, fmt.Sprintf("runnerBackend.type %q must be %s or %s", c.RunnerBackend.Type, RunnerBackendJob, RunnerBackendLocal))
+	}
+	if len(c.RunnerBackend.WorkDir) > 0 && !strings.HasPrefix(c.RunnerBackend.WorkDir, "/") {
+		errs = append(errs, fmt.Sprintf("runnerBackend.workDir %q must be absolute", c.RunnerBackend.WorkDir))
+	}
+	if len(c.RunnerBackend.KubesprayDir) > 0 && !strings.HasPrefix(c.RunnerBackend.KubesprayDir, "/") {
+		errs = append(errs, fmt.Sprintf("runnerBackend.kubesprayDir %q must be absolute", c.RunnerBackend.KubesprayDir))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Namespace is the namespace of the Jobs, entrypoint ConfigMaps and backups.
+func (c *Config) Namespace() string {
+	if len(c.JobNamespace) > 0 {
+		return c.JobNamespace
+	}
+	return util.GetCurrentNSOrDefault()
+}
+
+// MirrorImage replaces the registry of the image with its mirror, images without a registry belong to docker.io.
+func (c *Config) MirrorImage(image string) string {
+	if len(c.RegistryMirrors) == 0 {
+		return image
+	}
+	registry, repository := "docker.io", image
+	if parts := strings.SplitN(image, "/", 2); len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		registry, repository = parts[0], parts[1]
+	}
+	mirror, ok := c.RegistryMirrors[registry]
+	if !ok {
+		return image
+	}
+	return strings.TrimSuffix(mirror, "/") + "/" + repository
+}
+
+// Parse reads the YAML configuration on top of the defaults and validates it.
+func Parse(data []byte) (*Config, error) {
+	c := Default()
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadFile reads the configuration from a file.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// FromConfigMap reads the configuration from the config.yaml key of the ConfigMap.
+// The legacy CLUSTER_OPERATIONS_* keys are still honoured and override the retention.
+func FromConfigMap(cm *corev1.ConfigMap) (*Config, error) {
+	c, err := Parse([]byte(cm.Data[ConfigKey]))
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := cm.Data["CLUSTER_OPERATIONS_BACKEND_LIMIT"]; ok {
+		limit, _ := strconv.Atoi(value)
+		switch {
+		case limit <= 0:
+			klog.Warningf("GetClusterOperationsBackEndLimit and use default value %d", DefaultClusterOperationsBackEndLimit)
+			limit = DefaultClusterOperationsBackEndLimit
+		case limit > MaxClusterOperationsBackEndLimit:
+			klog.Warningf("GetClusterOperationsBackEndLimit and use max value %d", MaxClusterOperationsBackEndLimit)
+			limit = MaxClusterOperationsBackEndLimit
+		}
+		c.Retention.BackEndLimit = limit
+	}
+	if value, ok := cm.Data["CLUSTER_OPERATIONS_SUCCEEDED_LIMIT"]; ok {
+		c.Retention.SucceededLimit = parseLegacyLimit(value)
+	}
+	if value, ok := cm.Data["CLUSTER_OPERATIONS_FAILED_LIMIT"]; ok {
+		c.Retention.FailedLimit = parseLegacyLimit(value)
+	}
+	if value, ok := cm.Data["CLUSTER_OPERATIONS_TTL"]; ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid CLUSTER_OPERATIONS_TTL %s", value)
+		}
+		c.Retention.TTL = metav1.Duration{Duration: ttl}
+	}
+	return c, nil
+}
+
+func parseLegacyLimit(value string) *int {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		klog.Warningf("ignore invalid retention limit %s", value)
+		return nil
+	}
+	return &limit
+}
@@ -0,0 +1,252 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDefault(t *testing.T) {
+	c := Default()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("the defaults are invalid: %v", err)
+	}
+	if c.Retention.BackEndLimit != DefaultClusterOperationsBackEndLimit {
+		t.Errorf("backEndLimit %d, want %d", c.Retention.BackEndLimit, DefaultClusterOperationsBackEndLimit)
+	}
+	if c.Concurrency.Limited() {
+		t.Error("the defaults must not limit the concurrency")
+	}
+	if len(c.Approval.Rules) > 0 {
+		t.Error("the defaults must not require approval")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{name: "defaults", modify: func(c *Config) {}},
+		{
+			name:    "backEndLimit zero",
+			modify:  func(c *Config) { c.Retention.BackEndLimit = 0 },
+			wantErr: "retention.backEndLimit must be in",
+		},
+		{
+			name:    "backEndLimit over max",
+			modify:  func(c *Config) { c.Retention.BackEndLimit = MaxClusterOperationsBackEndLimit + 1 },
+			wantErr: "retention.backEndLimit must be in",
+		},
+		{
+			name:    "negative succeeded limit",
+			modify:  func(c *Config) { c.Retention.SucceededLimit = &negative },
+			wantErr: "retention.succeededLimit must not be negative",
+		},
+		{
+			name:    "negative concurrency",
+			modify:  func(c *Config) { c.Concurrency.MaxRunningPerCluster = -1 },
+			wantErr: "concurrency limits must not be negative",
+		},
+		{
+			name:    "group limits without label",
+			modify:  func(c *Config) { c.Concurrency.GroupLimits = map[string]int{"dc1": 1} },
+			wantErr: "concurrency.groupLimits requires concurrency.groupLabel",
+		},
+		{
+			name:    "job namespace",
+			modify:  func(c *Config) { c.JobNamespace = "Not_A_Namespace" },
+			wantErr: "jobNamespace",
+		},
+		{
+			name: "approval selector",
+			modify: func(c *Config) {
+				c.Approval.Rules = []ApprovalRule{{ClusterSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Bogus"}},
+				}}}
+			},
+			wantErr: "approval.rules[0].clusterSelector",
+		},
+		{
+			name: "relative writable path",
+			modify: func(c *Config) {
+				c.RunnerSecurity = []RunnerSecurityProfile{{ReadOnlyRootFilesystem: true, WritablePaths: []string{"tmp"}}}
+			},
+			wantErr: `runnerSecurity[0].writablePaths "tmp" must be absolute`,
+		},
+		{
+			name:    "writable paths on a writable root filesystem",
+			modify:  func(c *Config) { c.RunnerSecurity = []RunnerSecurityProfile{{WritablePaths: []string{"/tmp"}}} },
+			wantErr: "runnerSecurity[0].writablePaths requires readOnlyRootFilesystem",
+		},
+		{
+			name:    "runner service account",
+			modify:  func(c *Config) { c.RunnerServiceAccounts = []string{"Runner_SA"} },
+			wantErr: "runnerServiceAccounts[0]",
+		},
+		{
+			name:    "runner backend",
+			modify:  func(c *Config) { c.RunnerBackend.Type = "ssh" },
+			wantErr: `runnerBackend.type "ssh"`,
+		},
+		{
+			name: "all errors are reported",
+			modify: func(c *Config) {
+				c.Retention.BackEndLimit = 0
+				c.Concurrency.MaxConcurrentReconciles = 0
+			},
+			wantErr: "concurrency.maxConcurrentReconciles must be positive",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+			err := c.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte("concurrency:\n  maxRunning: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Concurrency.MaxRunning != 2 || c.Concurrency.MaxConcurrentReconciles != 1 {
+		t.Errorf("the file is not applied on top of the defaults: %+v", c.Concurrency)
+	}
+	if c.Retention.BackEndLimit != DefaultClusterOperationsBackEndLimit {
+		t.Errorf("backEndLimit %d, want the default", c.Retention.BackEndLimit)
+	}
+	if _, err := Parse([]byte("unknownField: 1\n")); err == nil {
+		t.Error("unknown fields must be rejected")
+	}
+	if _, err := Parse([]byte("retention:\n  backEndLimit: -1\n")); err == nil {
+		t.Error("invalid values must be rejected")
+	}
+}
+
+func TestFromConfigMapLegacyKeys(t *testing.T) {
+	c, err := FromConfigMap(&corev1.ConfigMap{Data: map[string]string{
+		ConfigKey:                            "retention:\n  backEndLimit: 10\n",
+		"CLUSTER_OPERATIONS_BACKEND_LIMIT":   "100000",
+		"CLUSTER_OPERATIONS_SUCCEEDED_LIMIT": "3",
+		"CLUSTER_OPERATIONS_FAILED_LIMIT":    "-2",
+		"CLUSTER_OPERATIONS_TTL":             "24h",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Retention.BackEndLimit != MaxClusterOperationsBackEndLimit {
+		t.Errorf("backEndLimit %d, want it capped at %d", c.Retention.BackEndLimit, MaxClusterOperationsBackEndLimit)
+	}
+	if c.Retention.SucceededLimit == nil || *c.Retention.SucceededLimit != 3 {
+		t.Errorf("succeededLimit %v, want 3", c.Retention.SucceededLimit)
+	}
+	if c.Retention.FailedLimit != nil {
+		t.Errorf("failedLimit %v, want the invalid value ignored", *c.Retention.FailedLimit)
+	}
+	if c.Retention.TTL.Hours() != 24 {
+		t.Errorf("ttl %s, want 24h", c.Retention.TTL.Duration)
+	}
+	if _, err := FromConfigMap(&corev1.ConfigMap{Data: map[string]string{"CLUSTER_OPERATIONS_TTL": "soon"}}); err == nil {
+		t.Error("an invalid ttl must be rejected")
+	}
+}
+
+func TestMirrorImage(t *testing.T) {
+	c := &Config{RegistryMirrors: map[string]string{
+		"docker.io":       "mirror.local/dockerhub/",
+		"registry.k8s.io": "mirror.local/k8s",
+	}}
+	tests := map[string]string{
+		"kubespray:v2.23":                  "mirror.local/dockerhub/kubespray:v2.23",
+		"library/kubespray:v2.23":          "mirror.local/dockerhub/library/kubespray:v2.23",
+		"registry.k8s.io/pause:3.9":        "mirror.local/k8s/pause:3.9",
+		"quay.io/kubespray/kubespray:v2.2": "quay.io/kubespray/kubespray:v2.2",
+	}
+	for image, want := range tests {
+		if got := c.MirrorImage(image); got != want {
+			t.Errorf("MirrorImage(%s) = %s, want %s", image, got, want)
+		}
+	}
+}
+
+func TestApprovalRequires(t *testing.T) {
+	approval := &Approval{Rules: []ApprovalRule{
+		{Actions: []string{"reset.yml", "remove-node.yml"}},
+		{Actions: []string{"upgrade-cluster.yml"}, ClusterSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}},
+		{Actions: []string{"scale.yml"}, ClusterSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Bogus"}},
+		}},
+	}}
+	prod := map[string]string{"env": "prod"}
+	tests := []struct {
+		name    string
+		actions []string
+		labels  map[string]string
+		want    bool
+	}{
+		{name: "action", actions: []string{"reset.yml"}, want: true},
+		{name: "not listed", actions: []string{"cluster.yml"}, want: false},
+		{name: "hook action", actions: []string{"cluster.yml", " remove-node.yml "}, want: true},
+		{name: "selector matches", actions: []string{"upgrade-cluster.yml"}, labels: prod, want: true},
+		{name: "selector does not match", actions: []string{"upgrade-cluster.yml"}, labels: map[string]string{"env": "dev"}, want: false},
+		{name: "invalid selector fails closed", actions: []string{"scale.yml"}, want: true},
+	}
+	for _, tt := range tests {
+		if got := approval.Requires(tt.actions, tt.labels); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if (&Approval{Rules: []ApprovalRule{{}}}).Requires([]string{"anything.yml"}, nil) != true {
+		t.Error("a rule without actions and selector matches everything")
+	}
+}
+
+func TestCheckRunnerServiceAccount(t *testing.T) {
+	c := &Config{RunnerServiceAccounts: []string{"kubespray-runner"}}
+	for _, name := range []string{"", "default", "kubespray-runner"} {
+		if err := c.CheckRunnerServiceAccount(name); err != nil {
+			t.Errorf("%q: unexpected error: %v", name, err)
+		}
+	}
+	if err := c.CheckRunnerServiceAccount("cluster-admin"); err == nil {
+		t.Error("a service account out of the list must be refused")
+	}
+	if err := Default().CheckRunnerServiceAccount("kubespray-runner"); err == nil {
+		t.Error("only the default service account is allowed by default")
+	}
+}
+
+func TestSecurityProfile(t *testing.T) {
+	if profile := Default().SecurityProfile("quay.io/kubespray/kubespray:v2.23.1"); profile.Disabled || profile.ReadOnlyRootFilesystem || profile.RunAsNonRoot {
+		t.Errorf("got %+v, want the baseline profile without a matching one", profile)
+	}
+	c := &Config{RunnerSecurity: []RunnerSecurityProfile{
+		{Image: "registry.example.com/legacy", Disabled: true},
+		{Image: "registry.example.com/", ReadOnlyRootFilesystem: true, WritablePaths: []string{"/tmp"}},
+	}}
+	if !c.SecurityProfile("registry.example.com/legacy-runner:v1").Disabled {
+		t.Error("the first matching profile applies")
+	}
+	if profile := c.SecurityProfile("registry.example.com/runner:v1"); profile.Disabled || !profile.ReadOnlyRootFilesystem || len(profile.WritablePaths) != 1 {
+		t.Errorf("got %+v, want the read-only profile", profile)
+	}
+	if profile := c.SecurityProfile("quay.io/kubespray/kubespray:v2.23.1"); profile.Disabled || profile.ReadOnlyRootFilesystem {
+		t.Errorf("got %+v, want the baseline profile for an image matching no profile", profile)
+	}
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// FilePollInterval is how often a config file is checked for changes.
+const FilePollInterval = 10 * time.Second
+
+// Provider holds the current configuration and swaps it when the source changes.
+// An invalid new configuration is rejected and the previous one stays in use.
+type Provider struct {
+	mu        sync.RWMutex
+	config    *Config
+	source    string
+	loadedAt  time.Time
+	lastError string
+}
+
+// NewProvider returns a provider serving the configuration loaded from source.
+func NewProvider(c *Config, source string) *Provider {
+	return &Provider{config: c, source: source, loadedAt: time.Now()}
+}
+
+// Get returns the current configuration, the defaults when the provider is nil.
+// The returned Config must not be modified.
+func (p *Provider) Get() *Config {
+	if p == nil {
+		return Default()
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.config
+}
+
+// Update swaps the configuration, or records err and keeps the current one.
+func (p *Provider) Update(c *Config, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		klog.ErrorS(err, "reject the new config and keep the current one", "source", p.source)
+		p.lastError = err.Error()
+		return
+	}
+	klog.Infof("reload config from %s", p.source)
+	p.config = c
+	p.loadedAt = time.Now()
+	p.lastError = ""
+}
+
+// ServeHTTP exposes the current configuration for debugging.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"source":    p.source,
+		"loadedAt":  p.loadedAt,
+		"lastError": p.lastError,
+		"config":    p.config,
+	})
+}
+
+// WatchFile reloads the configuration when the modification time of the file changes.
+func (p *Provider) WatchFile(path string) manager.Runnable {
+	return manager.RunnableFunc(func(ctx context.Context) error {
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		ticker := time.NewTicker(FilePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+				info, err := os.Stat(path)
+				if err != nil {
+					p.Update(nil, err)
+					continue
+				}
+				if info.ModTime().Equal(modTime) {
+					continue
+				}
+				modTime = info.ModTime()
+				p.Update(LoadFile(path))
+			}
+		}
+	})
+}
+
+// LoadConfigMap reads the configuration from the ConfigMap, the defaults are used when it does not exist.
+func LoadConfigMap(ctx context.Context, reader client.Reader, namespace, name string) (*Config, error) {
+	cm := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return Default(), nil
+		}
+		return nil, err
+	}
+	return FromConfigMap(cm)
+}
+
+// SetupConfigMapWatch reloads the configuration when the ConfigMap changes.
+func (p *Provider) SetupConfigMapWatch(mgr ctrl.Manager, namespace, name string) error {
+	isConfig := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == namespace && obj.GetName() == name
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("config").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(isConfig)).
+		Complete(reconcile.Func(func(ctx context.Context, _ reconcile.Request) (reconcile.Result, error) {
+			p.Update(LoadConfigMap(ctx, mgr.GetClient(), namespace, name))
+			return reconcile.Result{}, nil
+		}))
+}
@@ -0,0 +1,19 @@
+package util
+
+const (
+	// RequestedByAnno records the user who created a ClusterOperation, it is set by the admission webhook.
+	// The controller creates the promoted, scheduled and upgrade ClusterOperations on behalf of their requester,
+	// the webhook keeps the annotations only when the controller itself creates the ClusterOperation.
+	RequestedByAnno = "clay.io/requested-by"
+	// ApprovedByAnno records the user who set spec.approved of a ClusterOperation, it is set by the admission webhook.
+	ApprovedByAnno = "clay.io/approved-by"
+)
+
+// ApprovedBy returns the approver recorded by the webhook, empty when the approval is missing or self-made.
+func ApprovedBy(annotations map[string]string, approved bool) string {
+	approver := annotations[ApprovedByAnno]
+	if !approved || len(approver) == 0 || approver == annotations[RequestedByAnno] {
+		return ""
+	}
+	return approver
+}
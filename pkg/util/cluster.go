@@ -2,19 +2,34 @@ package util
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/clay-wangzhi/kube-on-kube/api"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ClusterRefLabelPrefix marks the ConfigMaps and Secrets referenced by a Cluster, the label name is the Cluster name.
+	ClusterRefLabelPrefix = "ref.clay.io/"
+	// AdoptDataAnno opts a ConfigMap or Secret in to be owned by the Clusters which reference it.
+	AdoptDataAnno = "clay.io/adopt-by-cluster"
 )
 
 var ServiceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 
+var ServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
 // GetCurrentNS fetch namespace the current pod running in. reference to client-go (config *inClusterClientConfig) Namespace() (string, bool, error).
 func GetCurrentNS() (string, error) {
 	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
@@ -29,6 +44,33 @@ func GetCurrentNS() (string, error) {
 	return "", fmt.Errorf("can not get namespace where pods running in")
 }
 
+// GetCurrentUsername returns the user name of the service account the current pod runs as, read from the subject of its token,
+// such as system:serviceaccount:kube-system:controller-manager.
+func GetCurrentUsername() (string, error) {
+	data, err := os.ReadFile(ServiceAccountTokenFile)
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(strings.TrimSpace(string(data)), ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("service account token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid service account token: %w", err)
+	}
+	claims := struct {
+		Subject string `json:"sub"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("invalid service account token: %w", err)
+	}
+	if !strings.HasPrefix(claims.Subject, "system:serviceaccount:") {
+		return "", fmt.Errorf("service account token has an unexpected subject %q", claims.Subject)
+	}
+	return claims.Subject, nil
+}
+
 func GetCurrentNSOrDefault() string {
 	ns, err := GetCurrentNS()
 	if err != nil {
@@ -37,45 +79,235 @@ func GetCurrentNSOrDefault() string {
 	return ns
 }
 
-func UpdateOwnReference(client kubernetes.Interface, configMapList []*api.ConfigMapRef, secretList []*api.SecretRef, belongToReference metav1.OwnerReference) error {
-	for _, ref := range configMapList {
-		if ref.IsEmpty() {
-			continue
+// ClusterRefLabelKey returns the label marking the ConfigMaps and Secrets referenced by the Cluster,
+// it is empty when the Cluster name can not be used as a label name.
+func ClusterRefLabelKey(clusterName string) string {
+	key := ClusterRefLabelPrefix + clusterName
+	if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+		return ""
+	}
+	return key
+}
+
+// ReferencingClusters lists the Clusters which reference the ConfigMap or Secret.
+func ReferencingClusters(obj client.Object) []string {
+	clusters := []string{}
+	for key := range obj.GetLabels() {
+		if strings.HasPrefix(key, ClusterRefLabelPrefix) {
+			clusters = append(clusters, strings.TrimPrefix(key, ClusterRefLabelPrefix))
 		}
-		cm, err := client.CoreV1().ConfigMaps(ref.NameSpace).Get(context.Background(), ref.Name, metav1.GetOptions{})
-		if err != nil {
-			if apierrors.IsNotFound(err) {
-				continue
+	}
+	return clusters
+}
+
+// TrackDataRef labels the referenced ConfigMaps and Secrets with the Cluster and releases the ones it no longer references.
+// The Cluster becomes an owner only when adopt is true or the object is annotated with AdoptDataAnno, and it is set as
+// controller only when no other Cluster references the object, so shared data is collected with the last Cluster.
+func TrackDataRef(ctx context.Context, c client.Client, configMapList []*api.ConfigMapRef, secretList []*api.SecretRef, belongToReference metav1.OwnerReference, adopt bool) error {
+	objs, err := fetchDataRef(ctx, c, configMapList, secretList)
+	if err != nil {
+		return err
+	}
+	labelKey := ClusterRefLabelKey(belongToReference.Name)
+	if len(labelKey) == 0 {
+		klog.Warningf("cluster %s name is too long to label the configData and secretData", belongToReference.Name)
+	}
+	tracked := map[string]struct{}{}
+	for _, obj := range objs {
+		tracked[objectKey(obj)] = struct{}{}
+		changed := false
+		if len(labelKey) != 0 && obj.GetLabels()[labelKey] != "true" {
+			labels := obj.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[labelKey] = "true"
+			obj.SetLabels(labels)
+			changed = true
+		}
+		if adopt || obj.GetAnnotations()[AdoptDataAnno] == "true" {
+			changed = addOwnerReference(obj, belongToReference) || changed
+		} else {
+			// release the data adopted without opt-in
+			changed = removeOwnerReference(obj, belongToReference.UID) || changed
+		}
+		if changed {
+			if err := c.Update(ctx, obj); err != nil {
+				return err
 			}
+		}
+	}
+	staleObjs, err := listTrackedDataRef(ctx, c, labelKey)
+	if err != nil {
+		return err
+	}
+	for _, obj := range staleObjs {
+		if _, ok := tracked[objectKey(obj)]; ok {
+			continue
+		}
+		if err := untrack(ctx, c, obj, labelKey, belongToReference.UID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UntrackDataRef removes the label and owner reference of the Cluster from the ConfigMaps and Secrets it references or has referenced.
+func UntrackDataRef(ctx context.Context, c client.Client, configMapList []*api.ConfigMapRef, secretList []*api.SecretRef, clusterName string, clusterUID types.UID) error {
+	objs, err := fetchDataRef(ctx, c, configMapList, secretList)
+	if err != nil {
+		return err
+	}
+	labelKey := ClusterRefLabelKey(clusterName)
+	staleObjs, err := listTrackedDataRef(ctx, c, labelKey)
+	if err != nil {
+		return err
+	}
+	untracked := map[string]struct{}{}
+	for _, obj := range append(objs, staleObjs...) {
+		// the referenced data is labeled as well, untrack it once
+		if _, ok := untracked[objectKey(obj)]; ok {
+			continue
+		}
+		untracked[objectKey(obj)] = struct{}{}
+		if err := untrack(ctx, c, obj, labelKey, clusterUID); err != nil {
 			return err
 		}
-		if len(cm.OwnerReferences) != 0 {
+	}
+	return nil
+}
+
+// DeleteDataRef deletes the referenced ConfigMaps and Secrets. Data still referenced by other Clusters is only untracked.
+func DeleteDataRef(ctx context.Context, c client.Client, configMapList []*api.ConfigMapRef, secretList []*api.SecretRef, clusterName string, clusterUID types.UID) error {
+	objs, err := fetchDataRef(ctx, c, configMapList, secretList)
+	if err != nil {
+		return err
+	}
+	labelKey := ClusterRefLabelKey(clusterName)
+	for _, obj := range objs {
+		shared := false
+		for _, name := range ReferencingClusters(obj) {
+			if name != clusterName {
+				shared = true
+			}
+		}
+		if shared {
+			klog.Warningf("%s %s/%s is referenced by other clusters and will not be deleted", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetNamespace(), obj.GetName())
+			if err := untrack(ctx, c, obj, labelKey, clusterUID); err != nil {
+				return err
+			}
 			continue
 		}
-		// cm belongs to `Cluster`
-		cm.OwnerReferences = append(cm.OwnerReferences, belongToReference)
-		if _, err := client.CoreV1().ConfigMaps(ref.NameSpace).Update(context.Background(), cm, metav1.UpdateOptions{}); err != nil {
+		if err := c.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
 			return err
 		}
 	}
+	return UntrackDataRef(ctx, c, nil, nil, clusterName, clusterUID)
+}
+
+// fetchDataRef gets the referenced ConfigMaps and Secrets, missing ones are ignored.
+func fetchDataRef(ctx context.Context, c client.Client, configMapList []*api.ConfigMapRef, secretList []*api.SecretRef) ([]client.Object, error) {
+	objs := []client.Object{}
+	for _, ref := range configMapList {
+		if ref.IsEmpty() {
+			continue
+		}
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: ref.NameSpace, Name: ref.Name}, cm); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		cm.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		objs = append(objs, cm)
+	}
 	for _, ref := range secretList {
 		if ref.IsEmpty() {
 			continue
 		}
-		secret, err := client.CoreV1().Secrets(ref.NameSpace).Get(context.Background(), ref.Name, metav1.GetOptions{})
-		if err != nil {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: ref.NameSpace, Name: ref.Name}, secret); err != nil {
 			if apierrors.IsNotFound(err) { // ignore
 				continue
 			}
-			return err // not ignore
+			return nil, err // not ignore
 		}
-		if len(secret.OwnerReferences) != 0 {
-			continue // do nothing
+		secret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		objs = append(objs, secret)
+	}
+	return objs, nil
+}
+
+// listTrackedDataRef lists the ConfigMaps and Secrets labeled with labelKey.
+func listTrackedDataRef(ctx context.Context, c client.Client, labelKey string) ([]client.Object, error) {
+	if len(labelKey) == 0 {
+		return nil, nil
+	}
+	objs := []client.Object{}
+	configMaps := &corev1.ConfigMapList{}
+	if err := c.List(ctx, configMaps, client.HasLabels{labelKey}); err != nil {
+		return nil, err
+	}
+	for i := range configMaps.Items {
+		configMaps.Items[i].SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		objs = append(objs, &configMaps.Items[i])
+	}
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.HasLabels{labelKey}); err != nil {
+		return nil, err
+	}
+	for i := range secrets.Items {
+		secrets.Items[i].SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		objs = append(objs, &secrets.Items[i])
+	}
+	return objs, nil
+}
+
+func untrack(ctx context.Context, c client.Client, obj client.Object, labelKey string, clusterUID types.UID) error {
+	changed := removeOwnerReference(obj, clusterUID)
+	if _, ok := obj.GetLabels()[labelKey]; ok && len(labelKey) != 0 {
+		labels := obj.GetLabels()
+		delete(labels, labelKey)
+		obj.SetLabels(labels)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return client.IgnoreNotFound(c.Update(ctx, obj))
+}
+
+func addOwnerReference(obj client.Object, ownerReference metav1.OwnerReference) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == ownerReference.UID {
+			return false
 		}
-		secret.OwnerReferences = append(secret.OwnerReferences, belongToReference)
-		if _, err := client.CoreV1().Secrets(ref.NameSpace).Update(context.Background(), secret, metav1.UpdateOptions{}); err != nil {
-			return err
+	}
+	if len(ReferencingClusters(obj)) > 1 || metav1.GetControllerOfNoCopy(obj) != nil {
+		// shared by several clusters, none of them is the controller
+		ownerReference.Controller = nil
+		ownerReference.BlockOwnerDeletion = nil
+	}
+	obj.SetOwnerReferences(append(obj.GetOwnerReferences(), ownerReference))
+	return true
+}
+
+func removeOwnerReference(obj client.Object, uid types.UID) bool {
+	ownerReferences := obj.GetOwnerReferences()
+	kept := make([]metav1.OwnerReference, 0, len(ownerReferences))
+	for _, ref := range ownerReferences {
+		if ref.UID != uid {
+			kept = append(kept, ref)
 		}
 	}
-	return nil
+	if len(kept) == len(ownerReferences) {
+		return false
+	}
+	obj.SetOwnerReferences(kept)
+	return true
+}
+
+func objectKey(obj client.Object) string {
+	return fmt.Sprintf("%s/%s/%s", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetNamespace(), obj.GetName())
 }
@@ -0,0 +1,207 @@
+package util
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clay-wangzhi/kube-on-kube/api"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetCurrentUsername(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	defer func(old string) { ServiceAccountTokenFile = old }(ServiceAccountTokenFile)
+	ServiceAccountTokenFile = file
+
+	token := func(payload string) string {
+		return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".signature\n"
+	}
+	tests := []struct {
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{token: token(`{"sub":"system:serviceaccount:system:controller-manager"}`), want: "system:serviceaccount:system:controller-manager"},
+		{token: token(`{"sub":"alice"}`), wantErr: true},
+		{token: token(`not json`), wantErr: true},
+		{token: "not-a-jwt", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(file, []byte(tt.token), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := GetCurrentUsername()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("token %q: got %q %v, want %q", tt.token, got, err, tt.want)
+		}
+	}
+}
+
+func newDataConfigMap(name string, labels map[string]string, annotations map[string]string, owners ...metav1.OwnerReference) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "ns", Name: name, Labels: labels, Annotations: annotations, OwnerReferences: owners,
+	}}
+}
+
+func clusterOwner(name string) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: "kubeonkube.clay.io/v1alpha1", Kind: "Cluster", Name: name, UID: types.UID(name + "-uid"),
+		Controller: &controller, BlockOwnerDeletion: &controller,
+	}
+}
+
+// dataState is the label and owner reference of the cluster c1 on a ConfigMap, or deleted.
+type dataState struct {
+	deleted    bool
+	labeled    bool
+	owned      bool
+	controlled bool
+}
+
+func getDataState(t *testing.T, c client.Client, name string) dataState {
+	t.Helper()
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: name}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return dataState{deleted: true}
+		}
+		t.Fatal(err)
+	}
+	state := dataState{labeled: cm.Labels[ClusterRefLabelPrefix+"c1"] == "true"}
+	for _, ref := range cm.OwnerReferences {
+		if ref.UID == "c1-uid" {
+			state.owned = true
+			state.controlled = ref.Controller != nil && *ref.Controller
+		}
+	}
+	return state
+}
+
+func TestTrackDataRef(t *testing.T) {
+	c1Label := map[string]string{ClusterRefLabelPrefix + "c1": "true"}
+	sharedLabels := map[string]string{ClusterRefLabelPrefix + "c1": "true", ClusterRefLabelPrefix + "c2": "true"}
+	tests := []struct {
+		name  string
+		obj   *corev1.ConfigMap
+		ref   bool
+		adopt bool
+		want  dataState
+	}{
+		{name: "labeled without opt-in", obj: newDataConfigMap("hosts", nil, nil), ref: true, want: dataState{labeled: true}},
+		{name: "adopted", obj: newDataConfigMap("hosts", nil, nil), ref: true, adopt: true, want: dataState{labeled: true, owned: true, controlled: true}},
+		{
+			name: "adopted by annotation",
+			obj:  newDataConfigMap("hosts", nil, map[string]string{AdoptDataAnno: "true"}),
+			ref:  true,
+			want: dataState{labeled: true, owned: true, controlled: true},
+		},
+		{name: "shared data is not controlled", obj: newDataConfigMap("hosts", sharedLabels, nil), ref: true, adopt: true, want: dataState{labeled: true, owned: true}},
+		{name: "released without opt-in", obj: newDataConfigMap("hosts", c1Label, nil, clusterOwner("c1")), ref: true, want: dataState{labeled: true}},
+		{name: "no longer referenced", obj: newDataConfigMap("old-hosts", c1Label, nil, clusterOwner("c1")), adopt: true},
+		{name: "others are left alone", obj: newDataConfigMap("other", map[string]string{ClusterRefLabelPrefix + "c2": "true"}, nil, clusterOwner("c2"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithObjects(tt.obj).Build()
+			refs := []*api.ConfigMapRef{{NameSpace: "ns", Name: "missing"}, nil}
+			if tt.ref {
+				refs = append(refs, &api.ConfigMapRef{NameSpace: "ns", Name: tt.obj.Name})
+			}
+			if err := TrackDataRef(context.Background(), c, refs, []*api.SecretRef{{NameSpace: "ns", Name: "missing"}}, clusterOwner("c1"), tt.adopt); err != nil {
+				t.Fatal(err)
+			}
+			if got := getDataState(t, c, tt.obj.Name); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUntrackAndDeleteDataRef(t *testing.T) {
+	c1Label := map[string]string{ClusterRefLabelPrefix + "c1": "true"}
+	sharedLabels := map[string]string{ClusterRefLabelPrefix + "c1": "true", ClusterRefLabelPrefix + "c2": "true"}
+	newObjs := func() []client.Object {
+		return []client.Object{
+			newDataConfigMap("hosts", c1Label, nil, clusterOwner("c1")),
+			newDataConfigMap("shared", sharedLabels, nil, clusterOwner("c1")),
+			newDataConfigMap("stale", c1Label, nil),
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "ssh", Labels: c1Label}},
+		}
+	}
+	configMaps := []*api.ConfigMapRef{{NameSpace: "ns", Name: "hosts"}, {NameSpace: "ns", Name: "shared"}, {NameSpace: "ns", Name: "missing"}}
+	secrets := []*api.SecretRef{{NameSpace: "ns", Name: "ssh"}}
+
+	tests := []struct {
+		name          string
+		remove        func(c client.Client) error
+		want          map[string]dataState
+		wantSecretDel bool
+	}{
+		{
+			name: "untrack",
+			remove: func(c client.Client) error {
+				return UntrackDataRef(context.Background(), c, configMaps, secrets, "c1", "c1-uid")
+			},
+			want: map[string]dataState{"hosts": {}, "shared": {}, "stale": {}},
+		},
+		{
+			name: "delete",
+			remove: func(c client.Client) error {
+				return DeleteDataRef(context.Background(), c, configMaps, secrets, "c1", "c1-uid")
+			},
+			// the shared data is only untracked, the stale one is no longer referenced and kept
+			want:          map[string]dataState{"hosts": {deleted: true}, "shared": {}, "stale": {}},
+			wantSecretDel: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithObjects(newObjs()...).Build()
+			if err := tt.remove(c); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.want {
+				if got := getDataState(t, c, name); got != want {
+					t.Errorf("%s: got %+v, want %+v", name, got, want)
+				}
+			}
+			shared := &corev1.ConfigMap{}
+			if err := c.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: "shared"}, shared); err != nil {
+				t.Fatal(err)
+			}
+			if shared.Labels[ClusterRefLabelPrefix+"c2"] != "true" {
+				t.Error("the label of the other cluster must be kept")
+			}
+			secret := &corev1.Secret{}
+			err := c.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: "ssh"}, secret)
+			if deleted := apierrors.IsNotFound(err); deleted != tt.wantSecretDel {
+				t.Errorf("secret deleted %v, want %v", deleted, tt.wantSecretDel)
+			} else if !deleted && len(secret.Labels) != 0 {
+				t.Errorf("secret labels %v, want untracked", secret.Labels)
+			}
+		})
+	}
+}
+
+func TestClusterRefLabelKey(t *testing.T) {
+	if key := ClusterRefLabelKey("c1"); key != ClusterRefLabelPrefix+"c1" {
+		t.Errorf("got %s", key)
+	}
+	long := make([]byte, 64)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if key := ClusterRefLabelKey(string(long)); len(key) != 0 {
+		t.Errorf("got %s, want empty for a name too long for a label", key)
+	}
+}
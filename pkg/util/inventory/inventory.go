@@ -0,0 +1,80 @@
+package inventory
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// HostsKey is the key of the inventory in the hosts ConfigMap.
+	HostsKey = "hosts.yml"
+	// GroupVarsKey is the key of the vars in the vars ConfigMap.
+	GroupVarsKey = "group_vars.yml"
+	// KubeVersionVar is the kubespray var of the Kubernetes version.
+	KubeVersionVar = "kube_version"
+)
+
+type group struct {
+	Hosts    map[string]interface{} `json:"hosts"`
+	Children map[string]*group      `json:"children"`
+}
+
+// Hosts returns the names of all the hosts in the yaml inventory, including the hosts of the child groups.
+func Hosts(data string) (map[string]struct{}, error) {
+	groups := map[string]*group{}
+	if err := yaml.Unmarshal([]byte(data), &groups); err != nil {
+		return nil, fmt.Errorf("invalid inventory: %w", err)
+	}
+	hosts := map[string]struct{}{}
+	var walk func(g *group)
+	walk = func(g *group) {
+		if g == nil {
+			return
+		}
+		for name := range g.Hosts {
+			hosts[name] = struct{}{}
+		}
+		for _, child := range g.Children {
+			walk(child)
+		}
+	}
+	for _, g := range groups {
+		walk(g)
+	}
+	return hosts, nil
+}
+
+// CheckHosts returns an error naming the nodes which are not hosts of the inventory.
+func CheckHosts(data string, nodes []string) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	hosts, err := Hosts(data)
+	if err != nil {
+		return err
+	}
+	unknown := []string{}
+	for _, node := range nodes {
+		if _, ok := hosts[node]; !ok {
+			unknown = append(unknown, node)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("nodes %v are not in the inventory", unknown)
+	}
+	return nil
+}
+
+// KubeVersion returns kube_version of the yaml vars, empty when it is not set.
+func KubeVersion(data string) (string, error) {
+	vars := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(data), &vars); err != nil {
+		return "", fmt.Errorf("invalid vars: %w", err)
+	}
+	version, ok := vars[KubeVersionVar]
+	if !ok || version == nil {
+		return "", nil
+	}
+	return fmt.Sprint(version), nil
+}
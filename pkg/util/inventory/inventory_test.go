@@ -0,0 +1,84 @@
+package inventory
+
+import (
+	"strings"
+	"testing"
+)
+
+const testHosts = `
+all:
+  hosts:
+    node1:
+      ansible_host: 10.0.0.1
+    node2:
+  children:
+    kube_control_plane:
+      hosts:
+        node1:
+    kube_node:
+      hosts:
+        node2:
+      children:
+        gpu:
+          hosts:
+            node3:
+    etcd:
+`
+
+func TestHosts(t *testing.T) {
+	hosts, err := Hosts(testHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"node1", "node2", "node3"} {
+		if _, ok := hosts[name]; !ok {
+			t.Errorf("%s is not found", name)
+		}
+	}
+	if len(hosts) != 3 {
+		t.Errorf("got %v, want 3 hosts", hosts)
+	}
+	if _, err := Hosts("all: ["); err == nil {
+		t.Error("an invalid inventory must be rejected")
+	}
+}
+
+func TestCheckHosts(t *testing.T) {
+	if err := CheckHosts(testHosts, nil); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+	if err := CheckHosts("not: [valid", nil); err != nil {
+		t.Errorf("the inventory is not parsed without limit: %v", err)
+	}
+	if err := CheckHosts(testHosts, []string{"node1", "node3"}); err != nil {
+		t.Errorf("hosts of child groups: %v", err)
+	}
+	err := CheckHosts(testHosts, []string{"node1", "node4", "kube_node"})
+	if err == nil || !strings.Contains(err.Error(), "[node4 kube_node]") {
+		t.Errorf("got %v, want the unknown nodes named", err)
+	}
+	if err := CheckHosts("all: [", []string{"node1"}); err == nil {
+		t.Error("an invalid inventory must be rejected")
+	}
+}
+
+func TestKubeVersion(t *testing.T) {
+	tests := map[string]string{
+		"kube_version: v1.28.6\n":  "v1.28.6",
+		"kube_network_plugin: x\n": "",
+		"kube_version:\n":          "",
+		"":                         "",
+	}
+	for data, want := range tests {
+		got, err := KubeVersion(data)
+		if err != nil {
+			t.Errorf("KubeVersion(%q): %v", data, err)
+		}
+		if got != want {
+			t.Errorf("KubeVersion(%q) = %q, want %q", data, got, want)
+		}
+	}
+	if _, err := KubeVersion("- a\n"); err == nil {
+		t.Error("vars must be a map")
+	}
+}
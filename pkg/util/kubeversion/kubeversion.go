@@ -0,0 +1,81 @@
+package kubeversion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a Kubernetes version such as v1.28.6, the pre-release and build of v1.28.6+k3s1 are dropped.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// Parse parses v1.28.6 or 1.28.6.
+func Parse(s string) (Version, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(trimmed, "-+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+	parts := strings.Split(trimmed, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("invalid kubernetes version %q", s)
+	}
+	numbers := [3]int{}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return Version{}, fmt.Errorf("invalid kubernetes version %q", s)
+		}
+		numbers[i] = number
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 when v is older than, equal to or newer than other.
+func (v Version) Compare(other Version) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		}
+		if diff > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Equal reports whether a and b are the same version, both must be valid.
+func Equal(a, b string) bool {
+	va, err := Parse(a)
+	if err != nil {
+		return false
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return false
+	}
+	return va.Compare(vb) == 0
+}
+
+// CheckUpgrade returns an error when from can not be upgraded to to: a downgrade, the same version,
+// another major version or more than maxMinorSkew minor versions at once.
+func CheckUpgrade(from, to Version, maxMinorSkew int) error {
+	switch {
+	case to.Compare(from) == 0:
+		return fmt.Errorf("the cluster is already at %s", to)
+	case to.Compare(from) < 0:
+		return fmt.Errorf("downgrading from %s to %s is not supported", from, to)
+	case to.Major != from.Major:
+		return fmt.Errorf("upgrading from %s to %s across major versions is not supported", from, to)
+	case to.Minor-from.Minor > maxMinorSkew:
+		return fmt.Errorf("upgrading from %s to %s moves %d minor versions at once, at most %d is allowed", from, to, to.Minor-from.Minor, maxMinorSkew)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package kubeversion
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for input, want := range map[string]Version{
+		"v1.28.6":      {Major: 1, Minor: 28, Patch: 6},
+		"1.28.6":       {Major: 1, Minor: 28, Patch: 6},
+		" v1.27.10 ":   {Major: 1, Minor: 27, Patch: 10},
+		"v1.28.6+k3s1": {Major: 1, Minor: 28, Patch: 6},
+		"v1.29.0-rc.1": {Major: 1, Minor: 29, Patch: 0},
+	} {
+		got, err := Parse(input)
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Parse(%q) = %v, want %v", input, got, want)
+		}
+	}
+	for _, input := range []string{"", "v1.28", "v1.28.6.1", "v1.x.6", "v1.-1.6", "latest"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q): want an error", input)
+		}
+	}
+}
+
+func TestCompareAndEqual(t *testing.T) {
+	v := Version{Major: 1, Minor: 28, Patch: 6}
+	for other, want := range map[Version]int{
+		{Major: 1, Minor: 28, Patch: 6}: 0,
+		{Major: 1, Minor: 28, Patch: 7}: -1,
+		{Major: 1, Minor: 27, Patch: 9}: 1,
+		{Major: 2, Minor: 0, Patch: 0}:  -1,
+	} {
+		if got := v.Compare(other); got != want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", v, other, got, want)
+		}
+	}
+	if v.String() != "v1.28.6" {
+		t.Errorf("String() = %s", v)
+	}
+	if !Equal("v1.28.6", "1.28.6") {
+		t.Error("v1.28.6 and 1.28.6 must be equal")
+	}
+	if Equal("v1.28.6", "v1.28.7") || Equal("v1.28.6", "invalid") {
+		t.Error("different or invalid versions must not be equal")
+	}
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	from := Version{Major: 1, Minor: 27, Patch: 5}
+	tests := []struct {
+		to      Version
+		skew    int
+		wantErr string
+	}{
+		{to: Version{Major: 1, Minor: 27, Patch: 6}, skew: 1},
+		{to: Version{Major: 1, Minor: 28, Patch: 0}, skew: 1},
+		{to: Version{Major: 1, Minor: 29, Patch: 0}, skew: 2},
+		{to: Version{Major: 1, Minor: 29, Patch: 0}, skew: 1, wantErr: "moves 2 minor versions at once, at most 1"},
+		{to: from, skew: 1, wantErr: "already at v1.27.5"},
+		{to: Version{Major: 1, Minor: 27, Patch: 4}, skew: 1, wantErr: "downgrading"},
+		{to: Version{Major: 1, Minor: 26, Patch: 9}, skew: 1, wantErr: "downgrading"},
+		{to: Version{Major: 2, Minor: 0, Patch: 0}, skew: 1, wantErr: "across major versions"},
+	}
+	for _, tt := range tests {
+		err := CheckUpgrade(from, tt.to, tt.skew)
+		if len(tt.wantErr) == 0 {
+			if err != nil {
+				t.Errorf("%v to %v: unexpected error: %v", from, tt.to, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v to %v: got error %v, want it to contain %q", from, tt.to, err, tt.wantErr)
+		}
+	}
+}
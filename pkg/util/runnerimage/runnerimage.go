@@ -0,0 +1,59 @@
+package runnerimage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/clay-wangzhi/kube-on-kube/pkg/config"
+	"github.com/clay-wangzhi/kube-on-kube/pkg/util/inventory"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubeonkubev1alpha1 "github.com/clay-wangzhi/kube-on-kube/api/kubeonkube/v1alpha1"
+)
+
+// Target resolves what the ClusterOperation requires from its runner image: kube_version of spec.extraVars or else
+// of the vars of the ClusterOperation or its Cluster, the OS families of the Cluster and the builtin playbooks it runs.
+func Target(ctx context.Context, reader client.Reader, cluster *kubeonkubev1alpha1.Cluster, clusterOps *kubeonkubev1alpha1.ClusterOperation) (config.RunnerImageTarget, error) {
+	target := config.RunnerImageTarget{OSFamilies: cluster.Spec.OSFamilies}
+	if version, ok := clusterOps.Spec.ExtraVars[inventory.KubeVersionVar]; ok {
+		if err := json.Unmarshal(version.Raw, &target.KubeVersion); err != nil {
+			return target, fmt.Errorf("extraVars %s must be a string: %w", inventory.KubeVersionVar, err)
+		}
+	} else {
+		varsConfRef := cluster.Spec.VarsConfRef
+		if !clusterOps.Spec.VarsConfRef.IsEmpty() {
+			varsConfRef = clusterOps.Spec.VarsConfRef
+		}
+		if !varsConfRef.IsEmpty() {
+			varsConf := &corev1.ConfigMap{}
+			err := reader.Get(ctx, client.ObjectKey{Namespace: varsConfRef.NameSpace, Name: varsConfRef.Name}, varsConf)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return target, err
+			}
+			if err == nil {
+				if target.KubeVersion, err = inventory.KubeVersion(varsConf.Data[inventory.GroupVarsKey]); err != nil {
+					return target, err
+				}
+			}
+		}
+	}
+	target.Playbooks = builtinPlaybooks(clusterOps.Spec.ActionType, clusterOps.Spec.Action, clusterOps.Spec.ActionSource)
+	for _, hooks := range [][]kubeonkubev1alpha1.HookAction{clusterOps.Spec.PreHook, clusterOps.Spec.PostHook} {
+		for _, hook := range hooks {
+			target.Playbooks = append(target.Playbooks, builtinPlaybooks(hook.ActionType, hook.Action, hook.ActionSource)...)
+		}
+	}
+	return target, nil
+}
+
+// builtinPlaybooks returns the playbook of the image run by the action, the playbooks of ConfigMaps are not in the image.
+func builtinPlaybooks(actionType kubeonkubev1alpha1.ActionType, action string, source *kubeonkubev1alpha1.ActionSource) []string {
+	if actionType != kubeonkubev1alpha1.PlaybookActionType || (source != nil && *source == kubeonkubev1alpha1.ConfigMapActionSource) {
+		return nil
+	}
+	return []string{action}
+}